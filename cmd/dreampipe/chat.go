@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+)
+
+// runChatCommand implements `dreampipe chat [--provider NAME] [--model NAME]
+// [--context FILE] [FILE...]` and returns the exit status.
+func runChatCommand(args []string, debugMode bool) int {
+	chatCmd := flag.NewFlagSet("chat", flag.ExitOnError)
+	providerFlag := chatCmd.String("provider", "", "Override LLM provider (e.g., ollama, gemini)")
+	modelFlag := chatCmd.String("model", "", "Override the provider's model")
+	contextFlag := chatCmd.String("context", "", "Provide context from a file or process substitution")
+	chatCmd.Parse(args)
+
+	cfg, err := config.LoadWithFlags(debugMode, config.Flags{Provider: *providerFlag, Model: *modelFlag})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+	return runChat(cfg, debugMode, chatCmd.Args(), *contextFlag, "")
+}
+
+// runChat starts an interactive chat about files, or stdin when there are no
+// files, and returns the exit status.
+func runChat(cfg config.Config, debugMode bool, files []string, contextFile, instruction string) int {
+	// Instructions come from the terminal; stdin carries the input when piped.
+	noInput := len(files) == 0 && iohandler.IsTerminal(os.Stdin)
+	terminal := os.Stdin
+	if !iohandler.IsTerminal(os.Stdin) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: chat needs a terminal to read instructions from: %v\n", err)
+			return 1
+		}
+		defer tty.Close()
+		terminal = tty
+	}
+
+	var contextData string
+	if contextFile != "" {
+		contextBytes, err := os.ReadFile(contextFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading context file '%s': %v\n", contextFile, err)
+			return 1
+		}
+		contextData = string(contextBytes)
+	}
+
+	runner := app.NewRunner(cfg, iohandler.DefaultOSStreams(), debugMode)
+	err := runner.Chat(app.ChatOptions{
+		Files:       files,
+		NoInput:     noInput,
+		Context:     contextData,
+		Instruction: instruction,
+		Terminal:    terminal,
+	})
+	if err != nil {
+		if errors.Is(err, app.ErrLimitExceeded) {
+			return exitLimitExceeded
+		}
+		return 1
+	}
+	return 0
+}
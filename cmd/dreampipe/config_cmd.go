@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// Exit statuses for `dreampipe config validate`, so provisioning scripts can
+// tell a broken file apart from an unreachable provider.
+const (
+	exitConfigInvalid = 4 // The configuration file is missing or cannot be parsed
+	exitChecksFailed  = 5 // The file is valid but a provider check failed
+)
+
+var (
+	errConfigInvalid = errors.New("configuration is invalid")
+	errChecksFailed  = errors.New("configuration checks failed")
+)
+
+// validateTimeout bounds the online checks of `dreampipe config validate`.
+const validateTimeout = 30 * time.Second
+
+// runConfigCommand implements `dreampipe config [init|validate|show|providers]`.
+// Without a subcommand the configuration file is opened in an editor.
+func runConfigCommand(args []string, debugMode bool) error {
+	if len(args) == 0 {
+		return openConfigEditor(debugMode)
+	}
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:], debugMode)
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	case "providers":
+		return runConfigProviders(args[1:])
+	default:
+		return fmt.Errorf("unknown config command %q (available: init, validate, show, providers)", args[0])
+	}
+}
+
+// runConfigInit creates the configuration file, interactively or from flags.
+func runConfigInit(args []string, debugMode bool) error {
+	initCmd := flag.NewFlagSet("config init", flag.ExitOnError)
+	var opts config.InitOptions
+	initCmd.StringVar(&opts.Provider, "provider", "", "Provider to configure: "+strings.Join(llm.Providers(), ", "))
+	initCmd.StringVar(&opts.BaseURL, "base-url", "", "Ollama base URL (default http://localhost:11434)")
+	command := initCmd.String("command", "", "Program and arguments of the command provider, split at spaces")
+	initCmd.StringVar(&opts.Model, "model", "", "Model to use instead of the provider default")
+	initCmd.StringVar(&opts.APIKey, "api-key", "", "API key (stored in the configuration file)")
+	initCmd.StringVar(&opts.APIKeyCmd, "api-key-cmd", "", "Command that prints the API key")
+	initCmd.StringVar(&opts.APIKeyEnv, "api-key-env", "", "Environment variable holding the API key")
+	initCmd.StringVar(&opts.APIKeyFile, "api-key-file", "", "File containing the API key")
+	initCmd.BoolVar(&opts.Force, "force", false, "Overwrite an existing configuration file")
+	nonInteractive := initCmd.Bool("non-interactive", false, "Never prompt; configure from flags only")
+	initCmd.Parse(args)
+	opts.Command = strings.Fields(*command)
+
+	cfgPath, err := config.GetConfigFilePath()
+	if err != nil {
+		return fmt.Errorf("could not get config file path: %w", err)
+	}
+
+	if !*nonInteractive && opts.Provider == "" {
+		if _, err := os.Stat(cfgPath); err == nil && !opts.Force {
+			return fmt.Errorf("configuration file already exists at %s (use --force to overwrite)", cfgPath)
+		}
+		if !iohandler.IsTerminal(os.Stdin) {
+			return errors.New("stdin is not a terminal; use --non-interactive --provider NAME")
+		}
+		_, err := config.InitInteractive(cfgPath, debugMode)
+		return err
+	}
+
+	if opts.Provider == "" {
+		return errors.New("--provider is required with --non-interactive")
+	}
+	if _, err := config.Init(cfgPath, opts); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Configuration file created at %s with default provider %s\n", cfgPath, opts.Provider)
+	return nil
+}
+
+// runConfigValidate checks the configuration file and, unless --offline is
+// given, that each configured provider is reachable and its model exists.
+func runConfigValidate(args []string) error {
+	validateCmd := flag.NewFlagSet("config validate", flag.ExitOnError)
+	offline := validateCmd.Bool("offline", false, "Only check the file, do not contact providers")
+	validateCmd.Parse(args)
+
+	cfg, _, err := config.LoadWithOrigins(config.Flags{})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return errConfigInvalid
+	}
+	fmt.Printf("✅ Configuration is valid, default provider %s\n", cfg.DefaultProvider)
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	failed := 0
+	for _, check := range llm.ValidateConfig(ctx, cfg, *offline) {
+		symbol := "✅"
+		switch check.Status {
+		case llm.CheckWarn:
+			symbol = "⚠️ "
+		case llm.CheckFail:
+			symbol = "❌"
+			failed++
+		}
+		fmt.Printf("%s %s: %s\n", symbol, check.Provider, check.Message)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d problem(s) found", errChecksFailed, failed)
+	}
+	return nil
+}
+
+// runConfigShow prints the configuration in effect with API keys masked.
+// With --origin it lists each key with the layer that set it instead.
+func runConfigShow(args []string) error {
+	showCmd := flag.NewFlagSet("config show", flag.ExitOnError)
+	origin := showCmd.Bool("origin", false, "Show which file, environment variable or default set each value")
+	showCmd.Parse(args)
+
+	cfg, origins, err := config.LoadWithOrigins(config.Flags{})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConfigInvalid, err)
+	}
+	if !*origin {
+		return toml.NewEncoder(os.Stdout).Encode(cfg.Masked())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, o := range origins {
+		value := o.Masked().Value
+		if s, ok := value.(string); ok {
+			value = strconv.Quote(s)
+		}
+		fmt.Fprintf(w, "%s = %v\t# %s\n", o.Key, value, o.Source)
+	}
+	return w.Flush()
+}
+
+// runConfigProviders lists the registered providers, the plugin providers on
+// the PATH, and what each configured [llms] entry uses.
+func runConfigProviders(args []string) error {
+	providersCmd := flag.NewFlagSet("config providers", flag.ExitOnError)
+	providersCmd.Parse(args)
+
+	plugins := llm.PluginsOnPath()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Built-in providers:\n")
+	for _, name := range llm.Providers() {
+		fmt.Fprintf(w, "  %s\n", name)
+	}
+	fmt.Fprintf(w, "Plugins on PATH (%s*):\n", llm.PluginPrefix)
+	if len(plugins) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	pluginNames := make([]string, 0, len(plugins))
+	for name := range plugins {
+		pluginNames = append(pluginNames, name)
+	}
+	sort.Strings(pluginNames)
+	for _, name := range pluginNames {
+		fmt.Fprintf(w, "  %s\t%s\n", name, plugins[name])
+	}
+
+	cfg, _, err := config.LoadWithOrigins(config.Flags{})
+	if err != nil {
+		w.Flush()
+		return fmt.Errorf("%w: %v", errConfigInvalid, err)
+	}
+	fmt.Fprintf(w, "Configured entries:\n")
+	for _, name := range llm.ConfiguredProviders(cfg) {
+		llmCfg := cfg.LLMs[name]
+		providerType := llm.ProviderType(name, llmCfg)
+		fmt.Fprintf(w, "  %s\t%s\n", name, describeProviderSource(providerType, llmCfg, plugins))
+	}
+	return w.Flush()
+}
+
+// describeProviderSource says what serves an [llms] entry of providerType.
+func describeProviderSource(providerType string, llmCfg config.LLMConfig, plugins map[string]string) string {
+	if llmCfg.Plugin != "" {
+		return "plugin " + llmCfg.PluginPath()
+	}
+	for _, name := range llm.Providers() {
+		if name == providerType {
+			return "built-in " + providerType
+		}
+	}
+	if llmCfg.Type == "" {
+		return fmt.Sprintf("❌ unknown provider, set type = %q to use a plugin", providerType)
+	}
+	if path, ok := plugins[providerType]; ok {
+		return "plugin " + path
+	}
+	return "❌ no provider or plugin named " + providerType
+}
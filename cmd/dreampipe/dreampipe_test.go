@@ -3,7 +3,9 @@ package main // Assuming main is in the root, or adjust if main is cmd/dreampipe
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,8 +18,27 @@ import (
 	"github.com/hiway/dreampipe/internal/config"
 	"github.com/hiway/dreampipe/internal/iohandler"
 	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+	"github.com/hiway/dreampipe/internal/prompt"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/tokens"
+	"github.com/hiway/dreampipe/internal/usage"
 )
 
+// TestMain keeps the usage ledger and last run of every test out of the
+// real state directory.
+func TestMain(m *testing.M) {
+	stateDir, err := os.MkdirTemp("", "dreampipe-test-state")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create temp state dir: %v\n", err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_STATE_HOME", stateDir)
+	code := m.Run()
+	os.RemoveAll(stateDir)
+	os.Exit(code)
+}
+
 // --- Fake LLM Client ---
 
 type fakeLLMClient struct {
@@ -25,6 +46,7 @@ type fakeLLMClient struct {
 	generateFunc func(ctx context.Context, prompt string) (string, error)
 	providerName string
 	promptsSent  []string // Store prompts for assertion
+	chatsSent    [][]llm.Message
 }
 
 func newFakeLLMClient(providerName string, genFunc func(ctx context.Context, prompt string) (string, error)) *fakeLLMClient {
@@ -34,15 +56,24 @@ func newFakeLLMClient(providerName string, genFunc func(ctx context.Context, pro
 	}
 }
 
-func (f *fakeLLMClient) Generate(ctx context.Context, prompt string) (string, error) {
+func (f *fakeLLMClient) Generate(ctx context.Context, prompt string) (llm.Response, error) {
 	f.mu.Lock()
 	f.promptsSent = append(f.promptsSent, prompt)
 	f.mu.Unlock()
 	if f.generateFunc != nil {
-		return f.generateFunc(ctx, prompt)
+		text, err := f.generateFunc(ctx, prompt)
+		return llm.Response{Text: text}, err
 	}
 	// Default behavior if no specific func is provided
-	return fmt.Sprintf("Fake LLM processed: %s", prompt), nil
+	return llm.Response{Text: fmt.Sprintf("Fake LLM processed: %s", prompt)}, nil
+}
+
+// Chat records the conversation and answers it like Generate answers the last message.
+func (f *fakeLLMClient) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	f.mu.Lock()
+	f.chatsSent = append(f.chatsSent, append([]llm.Message(nil), messages...))
+	f.mu.Unlock()
+	return f.Generate(ctx, messages[len(messages)-1].Content)
 }
 
 func (f *fakeLLMClient) ProviderName() string {
@@ -73,12 +104,16 @@ func createTempConfigFile(t *testing.T, content string) (string, func()) {
 		t.Fatalf("Failed to write temp config file: %v", err)
 	}
 
-	// Override XDG_CONFIG_HOME for this test
+	// Override XDG_CONFIG_HOME for this test, and XDG_STATE_HOME so the
+	// usage ledger is written to the temp dir
 	originalXDG := os.Getenv("XDG_CONFIG_HOME")
+	originalXDGState := os.Getenv("XDG_STATE_HOME")
 	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, ".config"))
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tmpDir, ".local", "state"))
 
 	cleanup := func() {
 		os.Setenv("XDG_CONFIG_HOME", originalXDG)
+		os.Setenv("XDG_STATE_HOME", originalXDGState)
 		// TempDir will be cleaned up automatically by t.TempDir()
 	}
 	return configFile, cleanup
@@ -794,3 +829,731 @@ func TestDreampipe_MissingProviderConfig(t *testing.T) {
 // To test the -version flag, you would typically run the compiled binary.
 // However, we can simulate the main function's flag parsing part if needed,
 // but it's often simpler to test the underlying components.
+
+func TestDreampipe_ContextOverflow_Chunk(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		ContextOverflow:       config.ContextOverflowChunk,
+		LLMs: map[string]config.LLMConfig{
+			"fakeLLM": {APIKey: "fakekey", ContextWindow: 200},
+		},
+	}
+
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		return "chunk summary", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{
+		In:  strings.NewReader(strings.Repeat("a line of log output\n", 100)),
+		Out: &stdoutBuf,
+		Err: &stderrBuf,
+	}
+	runner := app.NewRunner(cfg, streams, false)
+
+	if err := runner.Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if len(fakeLLM.promptsSent) < 2 {
+		t.Errorf("Expected input to be split into several prompts, got %d", len(fakeLLM.promptsSent))
+	}
+	if got := strings.Count(stdoutBuf.String(), "chunk summary"); got != len(fakeLLM.promptsSent) {
+		t.Errorf("Expected one output per chunk (%d), got %d in: %s", len(fakeLLM.promptsSent), got, stdoutBuf.String())
+	}
+
+	// The error strategy refuses to send oversized prompts at all.
+	fakeLLM.promptsSent = nil
+	cfg.ContextOverflow = config.ContextOverflowError
+	streams.In = strings.NewReader(strings.Repeat("a line of log output\n", 100))
+	stdoutBuf.Reset()
+	stderrBuf.Reset()
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err == nil {
+		t.Errorf("Expected error for oversized prompt with context_overflow = error")
+	}
+	if len(fakeLLM.promptsSent) != 0 {
+		t.Errorf("Expected no prompts to be sent, got %d", len(fakeLLM.promptsSent))
+	}
+}
+
+func TestDreampipe_ContextOverflow_EntryType(t *testing.T) {
+	// The entry has no context_window of its own; its type's default applies.
+	cfg := config.Config{
+		DefaultProvider:       "work",
+		RequestTimeoutSeconds: 5,
+		ContextOverflow:       config.ContextOverflowError,
+		LLMs:                  map[string]config.LLMConfig{"work": {Type: "groq", APIKey: "fakekey"}},
+	}
+	fakeLLM := newFakeLLMClient("work", func(ctx context.Context, prompt string) (string, error) {
+		return "summary", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	streams := &iohandler.Streams{In: strings.NewReader(strings.Repeat("a line of log output\n", 3000)), Out: io.Discard, Err: io.Discard}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err == nil {
+		t.Errorf("Expected error for a prompt larger than Groq's context window")
+	}
+	if len(fakeLLM.promptsSent) != 0 {
+		t.Errorf("Expected no prompts to be sent, got %d", len(fakeLLM.promptsSent))
+	}
+}
+
+func TestDreampipe_ProgressWriter(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey"}},
+	}
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		out := llmtypes.ProgressWriter(ctx)
+		if out == nil {
+			return "", errors.New("no progress writer in the request's context")
+		}
+		fmt.Fprintln(out, "Pulling model tiny...")
+		return "done", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("input"), Out: io.Discard, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if !strings.Contains(stderrBuf.String(), "Pulling model tiny...") {
+		t.Errorf("Stderr %q does not contain the client's progress", stderrBuf.String())
+	}
+}
+
+func TestDreampipe_ContextOverflow_MapReduce(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		ContextOverflow:       config.ContextOverflowMapReduce,
+		LLMs: map[string]config.LLMConfig{
+			"fakeLLM": {APIKey: "fakekey", ContextWindow: 400},
+		},
+	}
+
+	var mu sync.Mutex // Chunks are sent in parallel
+	var maps, reduces int
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Contains(prompt, "partial results") {
+			reduces++
+			return "```\ncombined summary\n```", nil
+		}
+		maps++
+		return "partial summary", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{
+		In:  strings.NewReader(strings.Repeat("a line of log output\n", 100)),
+		Out: &stdoutBuf,
+		Err: &stderrBuf,
+	}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if maps < 2 || reduces < 1 {
+		t.Errorf("Expected several map requests and at least one reduce, got %d maps and %d reduces", maps, reduces)
+	}
+	if got, want := stdoutBuf.String(), "combined summary\n"; got != want {
+		t.Errorf("Expected output %q, got %q", want, got)
+	}
+
+	// Input that fits is sent as is, without reducing.
+	maps, reduces = 0, 0
+	streams.In = strings.NewReader("a short log")
+	stdoutBuf.Reset()
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v", err)
+	}
+	if maps != 1 || reduces != 0 {
+		t.Errorf("Expected a single request for input that fits, got %d maps and %d reduces", maps, reduces)
+	}
+
+	// SetMapReduce splits the input even when it would fit, with its own reduce instruction.
+	maps, reduces = 0, 0
+	cfg.ContextOverflow = config.ContextOverflowWarn
+	streams.In = strings.NewReader(strings.Repeat("a line of log output\n", 20))
+	stdoutBuf.Reset()
+	runner := app.NewRunner(cfg, streams, false)
+	runner.SetMapReduce(script.MapReduce{Reduce: "Merge the partial results.", Parallel: 2, ChunkTokens: 20})
+	if err := runner.Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v", err)
+	}
+	if maps < 2 || reduces < 1 {
+		t.Errorf("Expected forced map-reduce, got %d maps and %d reduces", maps, reduces)
+	}
+}
+
+func TestDreampipe_Limits(t *testing.T) {
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		return "should not be sent", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	tests := []struct {
+		name    string
+		limits  config.Limits
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "Max input bytes",
+			limits:  config.Limits{MaxInputBytes: 10},
+			input:   "more than ten bytes of input",
+			wantErr: "max_input_bytes",
+		},
+		{
+			name:    "Max tokens per request",
+			limits:  config.Limits{MaxTokensPerRequest: 20},
+			input:   strings.Repeat("word ", 50),
+			wantErr: "max_tokens_per_request",
+		},
+		{
+			name:    "Max requests per run",
+			limits:  config.Limits{MaxRequestsPerRun: 2},
+			input:   strings.Repeat("a line of log output\n", 100), // Chunked into more than two requests
+			wantErr: "max_requests_per_run",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeLLM.promptsSent = nil
+			cfg := config.Config{
+				DefaultProvider:       "fakeLLM",
+				RequestTimeoutSeconds: 5,
+				ContextOverflow:       config.ContextOverflowChunk,
+				Limits:                tt.limits,
+				LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey", ContextWindow: 200}},
+			}
+			var stdoutBuf, stderrBuf bytes.Buffer
+			streams := &iohandler.Streams{In: strings.NewReader(tt.input), Out: &stdoutBuf, Err: &stderrBuf}
+
+			err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", "")
+			if !errors.Is(err, app.ErrLimitExceeded) {
+				t.Fatalf("Expected ErrLimitExceeded, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error to mention %s, got: %v", tt.wantErr, err)
+			}
+			if len(fakeLLM.promptsSent) != 0 {
+				t.Errorf("Expected no request to be sent, got %d", len(fakeLLM.promptsSent))
+			}
+		})
+	}
+}
+
+func TestDreampipe_CommandTimeout(t *testing.T) {
+	// The command's own timeout replaces request_timeout_seconds, so slow
+	// local models can run longer than HTTP requests are allowed to.
+	cfg := config.Config{
+		DefaultProvider:       "local",
+		RequestTimeoutSeconds: 1,
+		LLMs: map[string]config.LLMConfig{
+			"local": {Type: "command", Command: []string{"sh", "-c", "sleep 1.5; echo done"}, Timeout: "10s"},
+		},
+	}
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("input"), Out: &stdoutBuf, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if got := strings.TrimSpace(stdoutBuf.String()); got != "done" {
+		t.Errorf("Expected the command's output, got %q", got)
+	}
+}
+
+func TestDreampipe_DailySpendPerEntry(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	// Two entries of the mock provider with their own caps: the request costs
+	// about $0.01, over the cap of cheap but not of pricey.
+	cfg := config.Config{
+		RequestTimeoutSeconds: 5,
+		RecordUsage:           true,
+		Limits:                config.Limits{DailySpendUSD: map[string]float64{"cheap": 0.001, "pricey": 10}},
+		Prices:                map[string]config.ModelPrice{"m": {InputPerMillion: 1000, OutputPerMillion: 1000}},
+		LLMs: map[string]config.LLMConfig{
+			"cheap":  {Type: "mock", Model: "m"},
+			"pricey": {Type: "mock", Model: "m"},
+		},
+	}
+
+	run := func(provider string) error {
+		cfg.DefaultProvider = provider
+		streams := &iohandler.Streams{In: strings.NewReader("Some input to summarize"), Out: io.Discard, Err: io.Discard}
+		return app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", "")
+	}
+	if err := run("cheap"); !errors.Is(err, app.ErrLimitExceeded) {
+		t.Errorf("run with cheap: error = %v, want its daily_spend_usd enforced", err)
+	}
+	if err := run("pricey"); err != nil {
+		t.Fatalf("run with pricey: error = %v, want it under its cap", err)
+	}
+
+	ledgerPath, err := usage.DefaultLedgerPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := usage.NewLedger(ledgerPath).Records()
+	if err != nil || len(records) != 1 || records[0].Provider != "pricey" || records[0].CostUSD == 0 {
+		t.Errorf("ledger = %+v, %v; want one priced record for pricey", records, err)
+	}
+}
+
+func TestDreampipe_MapReduceDailySpend(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	// At $1 a token the cap leaves room for one chunk's prompt but not two;
+	// chunks are sent in parallel, before any of them is recorded.
+	oneChunk := tokens.Estimate(prompt.Build(app.AgentPrompt, "Summarize", "", ""))
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		RecordUsage:           true,
+		Limits:                config.Limits{DailySpendUSD: map[string]float64{"fakeLLM": float64(oneChunk) * 1.9}},
+		Prices:                map[string]config.ModelPrice{"m": {InputPerMillion: 1000000}},
+		LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey", Model: "m"}},
+	}
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "partial summary", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	streams := &iohandler.Streams{In: strings.NewReader(strings.Repeat("a line of log output\n", 20)), Out: io.Discard, Err: io.Discard}
+	runner := app.NewRunner(cfg, streams, false)
+	runner.SetMapReduce(script.MapReduce{Parallel: 4, ChunkTokens: 20})
+	if err := runner.Run(app.ModeAdHoc, "Summarize", ""); !errors.Is(err, app.ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, got: %v", err)
+	}
+	if len(fakeLLM.promptsSent) != 1 {
+		t.Errorf("Expected one chunk to be sent within the cap, got %d", len(fakeLLM.promptsSent))
+	}
+}
+
+func TestDreampipe_ClientPanic(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey"}},
+	}
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		panic("client bug")
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	streams := &iohandler.Streams{In: strings.NewReader("input"), Out: io.Discard, Err: io.Discard}
+	runner := app.NewRunner(cfg, streams, false)
+	// The client's panic is the only failure: the runner's locks stay usable.
+	defer func() {
+		if recovered := recover(); recovered != "client bug" {
+			t.Errorf("recover() = %v, want the client's panic", recovered)
+		}
+	}()
+	runner.Run(app.ModeAdHoc, "Summarize", "")
+}
+
+func TestDreampipe_MapReduceResultsTooLarge(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		ContextOverflow:       config.ContextOverflowMapReduce,
+		LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey", ContextWindow: 400}},
+	}
+	// Every partial result is longer than its chunk, so no two fit together.
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		return strings.Repeat("a very long partial summary ", 40), nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	streams := &iohandler.Streams{In: strings.NewReader(strings.Repeat("a line of log output\n", 100)), Out: io.Discard, Err: io.Discard}
+	err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", "")
+	if err == nil || !strings.Contains(err.Error(), "partial results") {
+		t.Errorf("Expected an error about partial results too large to combine, got: %v", err)
+	}
+	for _, sent := range fakeLLM.promptsSent {
+		if strings.Contains(sent, "a very long partial summary") {
+			t.Errorf("Expected no reduce prompt larger than the context window to be sent")
+			break
+		}
+	}
+}
+
+func TestDreampipe_MapReduceFailureCancels(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "fakeLLM",
+		RequestTimeoutSeconds: 5,
+		LLMs:                  map[string]config.LLMConfig{"fakeLLM": {APIKey: "fakekey"}},
+	}
+	// The first chunk fails; the others wait until they are canceled.
+	fakeLLM := newFakeLLMClient("fakeLLM", func(ctx context.Context, prompt string) (string, error) {
+		if strings.Contains(prompt, "line 0 ") {
+			return "", fmt.Errorf("model overloaded")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(5 * time.Second):
+			return "partial summary", nil
+		}
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var input strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&input, "line %d of log output\n", i)
+	}
+	var stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader(input.String()), Out: io.Discard, Err: &stderrBuf}
+	runner := app.NewRunner(cfg, streams, false)
+	runner.SetMapReduce(script.MapReduce{Parallel: 2, ChunkTokens: 10})
+
+	start := time.Now()
+	err := runner.Run(app.ModeAdHoc, "Summarize", "")
+	if err == nil || !strings.Contains(err.Error(), "model overloaded") {
+		t.Errorf("Expected the failing chunk's error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the other chunks to be canceled, run took %v", elapsed)
+	}
+	if sent := len(fakeLLM.promptsSent); sent > 2 {
+		t.Errorf("Expected no chunks to be sent after the failure, got %d requests", sent)
+	}
+	if strings.Contains(stderrBuf.String(), "context canceled") {
+		t.Errorf("Expected canceled chunks not to be reported, stderr: %s", stderrBuf.String())
+	}
+}
+
+func TestDreampipe_Redaction(t *testing.T) {
+	redactOff := false
+	cfg := config.Config{
+		DefaultProvider:       "groq",
+		RequestTimeoutSeconds: 5,
+		Redaction:             config.RedactionConfig{Enabled: true, Restore: true},
+		LLMs: map[string]config.LLMConfig{
+			"groq":   {APIKey: "fakekey"},
+			"ollama": {BaseURL: "http://localhost:11434", Redact: &redactOff},
+		},
+	}
+
+	fakeLLM := newFakeLLMClient("groq", func(ctx context.Context, prompt string) (string, error) {
+		if cfg.DefaultProvider == "groq" && strings.Contains(prompt, "alice@example.com") {
+			return "", fmt.Errorf("prompt contained an unredacted email address")
+		}
+		return "Reply sent to [REDACTED_EMAIL_1]", nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("Mail from alice@example.com"), Out: &stdoutBuf, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if !strings.Contains(stdoutBuf.String(), "Reply sent to alice@example.com") {
+		t.Errorf("Expected redacted value to be restored in output, got: %s", stdoutBuf.String())
+	}
+
+	// Redaction turned off for a local provider sends the input as is.
+	cfg.DefaultProvider = "ollama"
+	stdoutBuf.Reset()
+	streams.In = strings.NewReader("Mail from alice@example.com")
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeAdHoc, "Summarize", ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v", err)
+	}
+	if !strings.Contains(fakeLLM.GetLastPrompt(), "alice@example.com") {
+		t.Errorf("Expected input to be sent unredacted to ollama, got: %s", fakeLLM.GetLastPrompt())
+	}
+}
+
+func TestDreampipe_ScriptSteps(t *testing.T) {
+	scriptPath := createTempScriptFile(t, `#!/usr/bin/env dreampipe
++++
+[[steps]]
+name = "facts"
+instruction = "Extract the facts."
+model = "small"
+
+[[steps]]
+instruction = "Translate to French."
+provider = "groq"
+
+[[steps]]
+instruction = "Format as JSON."
+context = ["facts"]
+filters = ["trim_space"]
++++
+`)
+
+	cfg := config.Config{
+		DefaultProvider:       "ollama",
+		RequestTimeoutSeconds: 5,
+		LLMs: map[string]config.LLMConfig{
+			"ollama": {BaseURL: "http://localhost:11434", Model: "big"},
+			"groq":   {APIKey: "fakekey"},
+		},
+	}
+
+	var used []string
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) {
+		used = append(used, c.DefaultProvider+"/"+c.LLMs[c.DefaultProvider].Model)
+		return newFakeLLMClient(c.DefaultProvider, func(ctx context.Context, prompt string) (string, error) {
+			switch {
+			case strings.Contains(prompt, "Extract the facts."):
+				return "the sky is blue", nil
+			case strings.Contains(prompt, "Translate to French."):
+				if !strings.Contains(prompt, "Input:\n\nthe sky is blue") {
+					return "", fmt.Errorf("step 2 did not get the output of step 1: %s", prompt)
+				}
+				return "```\nle ciel est bleu\n```", nil
+			default:
+				if !strings.Contains(prompt, "Input:\n\nle ciel est bleu") || !strings.Contains(prompt, "facts:\n\nthe sky is blue") {
+					return "", fmt.Errorf("step 3 did not get its input and context: %s", prompt)
+				}
+				return "  {\"fr\": \"le ciel est bleu\"}\n\n", nil
+			}
+		}), nil
+	}
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("The sky is blue today."), Out: &stdoutBuf, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeScript, scriptPath, ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if got, want := stdoutBuf.String(), "{\"fr\": \"le ciel est bleu\"}\n"; got != want {
+		t.Errorf("Expected output %q, got %q", want, got)
+	}
+	if got, want := strings.Join(used, ","), "ollama/small,groq/,ollama/big"; got != want {
+		t.Errorf("Expected steps to use %s, got %s", want, got)
+	}
+}
+
+func TestDreampipe_ScriptStepsRedaction(t *testing.T) {
+	// The script's provider doesn't redact, but its second step goes to one
+	// that does, so the secret must not reach either.
+	scriptPath := createTempScriptFile(t, `#!/usr/bin/env dreampipe
++++
+[[steps]]
+instruction = "Extract the facts."
+
+[[steps]]
+instruction = "Summarize."
+provider = "groq"
++++
+`)
+	redactOn := true
+	cfg := config.Config{
+		DefaultProvider:       "ollama",
+		RequestTimeoutSeconds: 5,
+		LLMs: map[string]config.LLMConfig{
+			"ollama": {BaseURL: "http://localhost:11434"},
+			"groq":   {APIKey: "fakekey", Redact: &redactOn},
+		},
+	}
+
+	var prompts []string
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) {
+		return newFakeLLMClient(c.DefaultProvider, func(ctx context.Context, prompt string) (string, error) {
+			prompts = append(prompts, c.DefaultProvider+": "+prompt)
+			return "Mail from [REDACTED_EMAIL_1]", nil
+		}), nil
+	}
+	defer func() { llm.GetClient = originalGetClient }()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("Mail from alice@example.com"), Out: &stdoutBuf, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Run(app.ModeScript, scriptPath, ""); err != nil {
+		t.Fatalf("runner.Run() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(prompts))
+	}
+	for _, prompt := range prompts {
+		if strings.Contains(prompt, "alice@example.com") {
+			t.Errorf("Expected the email address to be redacted, got: %s", prompt)
+		}
+	}
+}
+
+func TestDreampipe_Chat(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "ollama",
+		RequestTimeoutSeconds: 5,
+		LLMs:                  map[string]config.LLMConfig{"ollama": {BaseURL: "http://localhost:11434", Model: "llama3"}},
+	}
+
+	replies := 0
+	var models []string
+	fakeLLM := newFakeLLMClient("ollama", func(ctx context.Context, prompt string) (string, error) {
+		replies++
+		return fmt.Sprintf("reply %d to %s", replies, prompt), nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) {
+		models = append(models, c.LLMs["ollama"].Model)
+		return fakeLLM, nil
+	}
+	defer func() { llm.GetClient = originalGetClient }()
+
+	savePath := filepath.Join(t.TempDir(), "reply.txt")
+	terminal := strings.NewReader("count errors\n/retry\n/model phi3\nonly warnings\n/bogus\n/save " + savePath + "\n")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("ERROR one\nWARN two\n"), Out: &stdoutBuf, Err: &stderrBuf}
+	err := app.NewRunner(cfg, streams, false).Chat(app.ChatOptions{Instruction: "summarize", Terminal: terminal})
+	if err != nil {
+		t.Fatalf("runner.Chat() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+
+	wantOutput := "reply 1 to summarize\nreply 2 to count errors\nreply 3 to count errors\nreply 4 to only warnings\n"
+	if stdoutBuf.String() != wantOutput {
+		t.Errorf("Chat output = %q, want %q", stdoutBuf.String(), wantOutput)
+	}
+
+	// The input is sent once as the system message, followed by the history;
+	// the retried reply replaces the first reply to "count errors".
+	last := fakeLLM.chatsSent[len(fakeLLM.chatsSent)-1]
+	var roles []string
+	for _, m := range last {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user,assistant,user" {
+		t.Errorf("Conversation roles = %s", got)
+	}
+	if !strings.Contains(last[0].Content, "ERROR one") || last[4].Content != "reply 3 to count errors" {
+		t.Errorf("Unexpected conversation: %+v", last)
+	}
+
+	if strings.Join(models, ",") != "llama3,phi3" {
+		t.Errorf("Clients created for models %v, want llama3 then phi3", models)
+	}
+	if !strings.Contains(stderrBuf.String(), "Unknown command /bogus") {
+		t.Errorf("Expected unknown command message, got: %s", stderrBuf.String())
+	}
+	saved, err := os.ReadFile(savePath)
+	if err != nil || string(saved) != "reply 4 to only warnings\n" {
+		t.Errorf("Saved reply = %q (%v)", saved, err)
+	}
+}
+
+func TestDreampipe_ChatTrimsHistory(t *testing.T) {
+	cfg := config.Config{
+		DefaultProvider:       "ollama",
+		RequestTimeoutSeconds: 5,
+		Limits:                config.Limits{MaxTokensPerRequest: 300},
+		LLMs:                  map[string]config.LLMConfig{"ollama": {BaseURL: "http://localhost:11434", Model: "llama3"}},
+	}
+	// Each reply is about 100 tokens, so the history soon outgrows the limit.
+	fakeLLM := newFakeLLMClient("ollama", func(ctx context.Context, prompt string) (string, error) {
+		return strings.Repeat("long reply ", 50), nil
+	})
+	originalGetClient := llm.GetClient
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeLLM, nil }
+	defer func() { llm.GetClient = originalGetClient }()
+
+	terminal := strings.NewReader("second\nthird\nfourth\n")
+	var stderrBuf bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader("some input\n"), Out: io.Discard, Err: &stderrBuf}
+	if err := app.NewRunner(cfg, streams, false).Chat(app.ChatOptions{Instruction: "first", Terminal: terminal}); err != nil {
+		t.Fatalf("runner.Chat() failed: %v. Stderr: %s", err, stderrBuf.String())
+	}
+	if len(fakeLLM.chatsSent) != 4 {
+		t.Fatalf("Expected every instruction to be sent, got %d requests", len(fakeLLM.chatsSent))
+	}
+	last := fakeLLM.chatsSent[3]
+	if last[0].Role != llm.RoleSystem || last[len(last)-1].Content != "fourth" || last[1].Content == "first" {
+		t.Errorf("Expected the oldest exchanges to be dropped, got %+v", last)
+	}
+	if !strings.Contains(stderrBuf.String(), "Warning: dropped the") {
+		t.Errorf("Expected a warning about the dropped history, got: %s", stderrBuf.String())
+	}
+}
+
+func TestModels_ListAndSetDefault(t *testing.T) {
+	cfgPath, cleanup := createTempConfigFile(t, "# Test models\ndefault_provider = \"mock\"\n\n[llms.mock]\nmodel = \"m1\" # the small one\n")
+	defer cleanup()
+	cfg, err := config.LoadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	listed, err := listModels(context.Background(), &out, &errOut, cfg, []string{"mock"}, false)
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("listModels() = %v, %v; want the mock's model", listed, err)
+	}
+	if !strings.Contains(out.String(), "m1 (default)") {
+		t.Errorf("Expected the default model to be marked, got:\n%s", out.String())
+	}
+
+	// The environment overrides the user file, which is worth saying.
+	t.Setenv("DREAMPIPE_MOCK_MODEL", "m3")
+	out.Reset()
+	choice := providerModel{provider: "mock", model: llm.ModelInfo{Name: "m2"}}
+	if err := saveDefaultModel(&out, cfgPath, choice); err != nil {
+		t.Fatalf("saveDefaultModel() error = %v", err)
+	}
+	content, _ := os.ReadFile(cfgPath)
+	if want := "# Test models\ndefault_provider = \"mock\"\n\n[llms.mock]\nmodel = \"m2\" # the small one\n"; string(content) != want {
+		t.Errorf("config.toml = %q, want %q", content, want)
+	}
+	if !strings.Contains(out.String(), "llms.mock.model = m3 from environment DREAMPIPE_MOCK_MODEL") {
+		t.Errorf("Expected a warning about the environment override, got:\n%s", out.String())
+	}
+}
+
+func TestInputSource(t *testing.T) {
+	editor := filepath.Join(t.TempDir(), "editor")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\nprintf \"$EDITOR_TEXT\" > \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", editor)
+
+	input, err := inputSource(true, false, false)
+	if err != nil {
+		t.Fatalf("inputSource(noInput) error = %v", err)
+	}
+	if data, _ := io.ReadAll(input); len(data) != 0 {
+		t.Errorf("inputSource(noInput) read %q, want nothing", data)
+	}
+	if _, err := inputSource(true, true, false); err == nil {
+		t.Errorf("inputSource() accepted --no-input with --edit")
+	}
+
+	t.Setenv("EDITOR_TEXT", "composed input\n")
+	if text, err := composeInput(false); err != nil || text != "composed input\n" {
+		t.Errorf("composeInput() = %q, %v, want the text written in the editor", text, err)
+	}
+	t.Setenv("EDITOR_TEXT", "  \n")
+	if _, err := composeInput(false); !errors.Is(err, errEmptyInput) {
+		t.Errorf("composeInput() error = %v, want errEmptyInput for a blank file", err)
+	}
+}
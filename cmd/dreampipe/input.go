@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/iohandler"
+)
+
+// errEmptyInput is returned when the input composed in the editor is empty,
+// which is taken as a change of mind, as with an empty commit message.
+var errEmptyInput = errors.New("the input is empty, nothing to do")
+
+// inputSource returns where a run reads its input from: nothing with noInput,
+// and otherwise stdin. When stdin is a terminal, edit opens the editor to
+// compose the input instead, and without it a hint is printed, so waiting for
+// the input doesn't look like a hang.
+func inputSource(noInput, edit, debugMode bool) (io.Reader, error) {
+	switch {
+	case noInput && edit:
+		return nil, fmt.Errorf("--no-input and --edit can't be used together")
+	case noInput:
+		return strings.NewReader(""), nil
+	case !iohandler.IsTerminal(os.Stdin):
+		if edit {
+			return nil, fmt.Errorf("--edit needs stdin to be a terminal, but input is piped")
+		}
+		return os.Stdin, nil
+	case edit:
+		text, err := composeInput(debugMode)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(text), nil
+	}
+	fmt.Fprintf(os.Stderr, "Type the input, then press %s to finish (--no-input to run without input, --edit to use your editor)\n", eofKeys())
+	return os.Stdin, nil
+}
+
+// composeInput opens an empty file in the editor and returns what was
+// written to it.
+func composeInput(debugMode bool) (string, error) {
+	f, err := os.CreateTemp("", "dreampipe-input-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a file for the input: %w", err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	if err := openInEditor(path, debugMode); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the input: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", errEmptyInput
+	}
+	return string(data), nil
+}
+
+// eofKeys returns the keys that end input on the terminal.
+func eofKeys() string {
+	if runtime.GOOS == "windows" {
+		return "Ctrl-Z then Enter"
+	}
+	return "Ctrl-D"
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -13,29 +14,55 @@ import (
 	"github.com/hiway/dreampipe/internal/app"
 	"github.com/hiway/dreampipe/internal/config"
 	"github.com/hiway/dreampipe/internal/iohandler"
+	_ "github.com/hiway/dreampipe/internal/llm/builtin" // Registers the built-in providers
+	"github.com/hiway/dreampipe/internal/script"
 )
 
 // version is set during build time (e.g., using ldflags)
 var version = "dev"
 
+// exitLimitExceeded is the exit status when a limit from [limits] in the
+// configuration stopped the run, so scripts can tell it apart from other failures.
+const exitLimitExceeded = 3
+
 func main() {
 	// --- Command Line Flags ---
-	// Subcommands
-	configCmd := flag.NewFlagSet("config", flag.ExitOnError)
-
 	versionFlag := flag.Bool("version", false, "Print version information and exit")
 	debugFlagShort := flag.Bool("d", false, "Enable debug mode (shorthand)")
 	debugFlagLong := flag.Bool("debug", false, "Enable debug mode")
 	contextFlag := flag.String("context", "", "Provide context from a file or process substitution")
-	// Add other potential flags here later (e.g., -provider, -config)
-	// providerFlag := flag.String("provider", "", "Override LLM provider (e.g., ollama, gemini)")
+	saveFlag := flag.String("save", "", "After a successful ad-hoc run, save the instruction as script `NAME`")
+	interactiveFlag := flag.Bool("i", false, "Chat about the input interactively (same as `dreampipe chat`)")
+	providerFlag := flag.String("provider", "", "Override LLM provider (e.g., ollama, gemini)")
+	modelFlag := flag.String("model", "", "Override the provider's model")
+	mapReduceFlag := flag.Bool("map-reduce", false, "Split the input into chunks, apply the instruction to each, then combine the results")
+	reduceFlag := flag.String("reduce", "", "Instruction combining the partial results of --map-reduce (implies --map-reduce)")
+	parallelFlag := flag.Int("parallel", 0, "Chunks processed at the same time with --map-reduce (implies --map-reduce)")
+	chunkTokensFlag := flag.Int("chunk-tokens", 0, "Input tokens per chunk with --map-reduce (implies --map-reduce)")
+	noInputFlag := flag.Bool("no-input", false, "Run without input instead of reading stdin, e.g. to generate text from the instruction and context")
+	editFlag := flag.Bool("edit", false, "Compose the input in your editor instead of typing it on the terminal")
+	noProgressFlag := flag.Bool("no-progress", false, "Don't show the status line on stderr while running")
 
 	// Customize flag usage message
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  dreampipe [flags] \"Your natural language instruction\"\n")
 		fmt.Fprintf(os.Stderr, "  dreampipe script /path/to/your_script_with_dreampipe_shebang\n")
-		fmt.Fprintf(os.Stderr, "  dreampipe config   # Open the configuration file in your editor\n\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe run [--context FILE] [--param NAME=VALUE...] [--no-input|--edit] NAME  # Run a script from the library or search paths\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe scripts list|show|edit|new|install  # Manage the script library\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe test [--record|--replay] [--update] [PATH|NAME...]  # Run the test cases next to scripts\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe save [--force] NAME  # Save the last ad-hoc instruction as a script\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe chat [--provider NAME] [--model NAME] [--context FILE] [FILE...]  # Chat about stdin or files (or: dreampipe -i)\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe config   # Open the configuration file in your editor\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe config init [--non-interactive --provider NAME ...]  # Create the configuration file\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe config validate [--offline]  # Check the configuration and providers\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe config show [--origin]  # Print the configuration with API keys masked\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe config providers  # List built-in providers and plugins\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe models [--provider NAME] [--set-default]  # List available models\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe serve [--addr ADDR] [--scripts DIR] [--token TOKEN]  # Serve scripts and providers over HTTP\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe mcp [--scripts DIR]  # Serve scripts as tools to MCP clients over stdio\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe watch --input FILE --out FILE [--script NAME] [\"instruction\"]  # Rewrite a file each time its input changes\n")
+		fmt.Fprintf(os.Stderr, "  dreampipe usage [--by day|provider|model|script] [--days N]  # Report token usage and cost\n\n")
 		fmt.Fprintf(os.Stderr, "Global Flags:\n")
 		flag.PrintDefaults()
 		// To print subcommand help: dreampipe config -h (not automatically handled by simple flag.Usage)
@@ -47,12 +74,66 @@ func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "config":
-			configCmd.Parse(os.Args[2:]) // Parse flags for config subcommand
 			// Determine debug mode for openConfigEditor as well, in case it calls config.Load
 			debugModeForConfig := *debugFlagShort || *debugFlagLong
-			err := openConfigEditor(debugModeForConfig)
+			err := runConfigCommand(os.Args[2:], debugModeForConfig)
 			if err != nil {
-				log.Fatalf("Error opening config: %v", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				switch {
+				case errors.Is(err, errConfigInvalid):
+					os.Exit(exitConfigInvalid)
+				case errors.Is(err, errChecksFailed):
+					os.Exit(exitChecksFailed)
+				}
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "chat":
+			os.Exit(runChatCommand(os.Args[2:], *debugFlagShort || *debugFlagLong))
+		case "run":
+			os.Exit(runRunCommand(os.Args[2:], *debugFlagShort || *debugFlagLong))
+		case "scripts":
+			if err := runScriptsCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			os.Exit(0)
+		case "test":
+			if err := runTestCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				if errors.Is(err, errTestsFailed) {
+					os.Exit(exitTestsFailed)
+				}
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "save":
+			if err := runSaveCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error saving script: %v", err)
+			}
+			os.Exit(0)
+		case "models":
+			if err := runModelsCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error listing models: %v", err)
+			}
+			os.Exit(0)
+		case "serve":
+			if err := runServeCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			os.Exit(0)
+		case "watch":
+			if err := runWatchCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			os.Exit(0)
+		case "mcp":
+			if err := runMCPCommand(os.Args[2:], *debugFlagShort || *debugFlagLong); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			os.Exit(0)
+		case "usage":
+			if err := runUsageCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error reporting usage: %v", err)
 			}
 			os.Exit(0)
 		}
@@ -70,7 +151,7 @@ func main() {
 	// --- Load Configuration ---
 	// Placeholder: Implement loading from environment variables, config files etc.
 	// The config should contain API keys, default provider, timeouts, etc.
-	cfg, err := config.Load(debugMode)
+	cfg, err := config.LoadWithFlags(debugMode, config.Flags{Provider: *providerFlag, Model: *modelFlag})
 	if err != nil {
 		// Use log.Fatalf for critical startup errors
 		// If debug mode is on, print more info, otherwise, config.Load already prints to Stderr.
@@ -79,10 +160,11 @@ func main() {
 		}
 		log.Fatalf("Error loading configuration: %v (run with -d or --debug for more details if available)", err)
 	}
-	// Example: Override provider from flag if implemented
-	// if *providerFlag != "" {
-	//     cfg.LLMProvider = *providerFlag
-	// }
+
+	// --- Interactive Chat ---
+	if *interactiveFlag {
+		os.Exit(runChat(cfg, debugMode, nil, *contextFlag, strings.Join(flag.Args(), " ")))
+	}
 
 	// --- Determine Mode & Instruction ---
 	var mode app.RunMode
@@ -129,16 +211,42 @@ func main() {
 		instruction = strings.Join(args, " ")
 	}
 
+	if *saveFlag != "" {
+		// Check before the run, so a bad name doesn't waste a request.
+		if mode != app.ModeAdHoc {
+			fmt.Fprintf(os.Stderr, "Error: --save only works with an ad-hoc instruction\n")
+			os.Exit(1)
+		}
+		if err := script.ValidateName(*saveFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// --- Initialize I/O Handler ---
 	// Pass standard OS streams to the application core
+	input, err := inputSource(*noInputFlag, *editFlag, debugMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	stdio := &iohandler.Streams{
-		In:  os.Stdin,
+		In:  input,
 		Out: os.Stdout,
 		Err: os.Stderr,
 	}
 
 	// --- Create and Run Application ---
 	runner := app.NewRunner(cfg, stdio, debugMode) // Inject dependencies
+	runner.SetProgress(!*noProgressFlag)
+	if *mapReduceFlag || *reduceFlag != "" || *parallelFlag != 0 || *chunkTokensFlag != 0 {
+		mr := script.MapReduce{Reduce: *reduceFlag, Parallel: *parallelFlag, ChunkTokens: *chunkTokensFlag}
+		if err := mr.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		runner.SetMapReduce(mr)
+	}
 
 	// Read context if provided
 	var contextData string
@@ -155,9 +263,19 @@ func main() {
 	err = runner.Run(mode, instruction, contextData)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, app.ErrLimitExceeded) {
+			os.Exit(exitLimitExceeded)
+		}
 		os.Exit(1)
 	}
 
+	if *saveFlag != "" {
+		if err := saveScript(cfg.ScriptsDirPath(), *saveFlag, *runner.LastRun(), false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving script: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// --- Exit ---
 	os.Exit(0) // Success
 }
@@ -188,6 +306,11 @@ func openConfigEditor(debugMode bool) error {
 		}
 	}
 
+	return openInEditor(cfgPath, debugMode)
+}
+
+// findEditor returns $EDITOR, or the first common editor found on $PATH.
+func findEditor() (string, error) {
 	editor := os.Getenv("EDITOR")
 	preferredEditors := []string{"nano", "vim", "emacs", "vi"} // Common terminal editors
 	// VS Code is handled separately due to '--wait'
@@ -202,13 +325,22 @@ func openConfigEditor(debugMode bool) error {
 		// If no terminal editor found, try VS Code
 		if editor == "" {
 			if path, err := exec.LookPath("code"); err == nil {
-				editor = path // Will be 'code', args handled below
+				editor = path // Will be 'code', args handled in openInEditor
 			}
 		}
 	}
 
 	if editor == "" {
-		return fmt.Errorf("no suitable editor found. Please set your $EDITOR environment variable or install nano, vim, emacs, vi, or VS Code (code)")
+		return "", fmt.Errorf("no suitable editor found. Please set your $EDITOR environment variable or install nano, vim, emacs, vi, or VS Code (code)")
+	}
+	return editor, nil
+}
+
+// openInEditor opens path in the user's editor and waits for it to exit.
+func openInEditor(path string, debugMode bool) error {
+	editor, err := findEditor()
+	if err != nil {
+		return err
 	}
 
 	var cmdArgs []string
@@ -218,9 +350,9 @@ func openConfigEditor(debugMode bool) error {
 	if filepath.Base(editor) == "code" {
 		// Check if 'code' is actually VS Code and supports --wait
 		// For simplicity, we assume 'code' is VS Code and add '--wait'
-		cmdArgs = append(cmdArgs, "--wait", cfgPath)
+		cmdArgs = append(cmdArgs, "--wait", path)
 	} else {
-		cmdArgs = append(cmdArgs, cfgPath)
+		cmdArgs = append(cmdArgs, path)
 	}
 
 	cmd := exec.Command(cmdName, cmdArgs...)
@@ -229,7 +361,7 @@ func openConfigEditor(debugMode bool) error {
 	cmd.Stderr = os.Stderr
 
 	if debugMode {
-		fmt.Printf("Opening %s with %s...\n", cfgPath, editor)
+		fmt.Printf("Opening %s with %s...\n", path, editor)
 	}
 	return cmd.Run()
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/mcp"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// runMCPCommand implements `dreampipe mcp`, serving scripts as tools to an
+// MCP client over stdin and stdout until the client disconnects.
+func runMCPCommand(args []string, debugMode bool) error {
+	mcpCmd := flag.NewFlagSet("mcp", flag.ExitOnError)
+	scriptsDir := mcpCmd.String("scripts", "", "Directory of scripts to serve (default: the script library and search paths)")
+	mcpCmd.Parse(args)
+	if mcpCmd.NArg() != 0 {
+		return fmt.Errorf("usage: dreampipe mcp [--scripts DIR]")
+	}
+
+	// Stdout carries the protocol, so the configuration is loaded without
+	// prompting or printing.
+	cfg, _, err := config.LoadWithOrigins(config.Flags{})
+	if errors.Is(err, config.ErrNoConfig) {
+		return fmt.Errorf("%w; create one with `dreampipe config init` first", err)
+	}
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	library := &script.Library{Dirs: []string{*scriptsDir}}
+	if *scriptsDir == "" {
+		if library, err = script.NewLibrary(cfg.ScriptSearchPaths()...); err != nil {
+			return err
+		}
+	} else if info, err := os.Stat(*scriptsDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("scripts directory %s not found", *scriptsDir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := mcp.New(cfg, library, mcp.Options{Version: version, Debug: debugMode, LogOutput: os.Stderr})
+	return srv.Serve(ctx, os.Stdin, os.Stdout)
+}
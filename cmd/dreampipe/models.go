@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// listModelsTimeout bounds how long `dreampipe models` waits for all providers.
+const listModelsTimeout = 60 * time.Second
+
+// providerModel is a model listed by a provider, for numbering in --set-default.
+type providerModel struct {
+	provider string
+	model    llm.ModelInfo
+}
+
+// runModelsCommand implements `dreampipe models`, listing the models each
+// configured provider offers, and with --set-default picking the default one.
+func runModelsCommand(args []string, debugMode bool) error {
+	modelsCmd := flag.NewFlagSet("models", flag.ExitOnError)
+	providerFlag := modelsCmd.String("provider", "", "Only list models of this provider")
+	setDefault := modelsCmd.Bool("set-default", false, "Choose the default provider and model interactively")
+	modelsCmd.Parse(args)
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	providers := llm.ConfiguredProviders(cfg)
+	if *providerFlag != "" {
+		if _, ok := cfg.LLMs[*providerFlag]; !ok {
+			return fmt.Errorf("provider %q has no [llms] entry in the configuration", *providerFlag)
+		}
+		providers = []string{*providerFlag}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+
+	listed, err := listModels(ctx, os.Stdout, os.Stderr, cfg, providers, debugMode)
+	if err != nil {
+		return err
+	}
+	if len(listed) == 0 {
+		return errors.New("no models found")
+	}
+
+	if *setDefault {
+		return chooseDefaultModel(listed)
+	}
+	return nil
+}
+
+// listModels writes a numbered table of the models of each provider to w, and
+// the providers that failed to errW, and returns the models in table order.
+func listModels(ctx context.Context, w, errW io.Writer, cfg config.Config, providers []string, debugMode bool) ([]providerModel, error) {
+	var listed []providerModel
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPROVIDER\tMODEL\tCONTEXT\tCAPABILITIES")
+	for _, provider := range providers {
+		models, current, err := listProviderModels(ctx, cfg, provider, debugMode)
+		if err != nil {
+			fmt.Fprintf(errW, "⚠️  %s: %v\n", provider, err)
+			continue
+		}
+		for _, m := range models {
+			listed = append(listed, providerModel{provider: provider, model: m})
+			name := m.Name
+			if provider == cfg.DefaultProvider && (name == current || name == current+":latest") {
+				name += " (default)"
+			}
+			contextWindow := "-"
+			if m.ContextWindow > 0 {
+				contextWindow = strconv.Itoa(m.ContextWindow)
+			}
+			capabilities := "-"
+			if len(m.Capabilities) > 0 {
+				capabilities = strings.Join(m.Capabilities, ", ")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", len(listed), provider, name, contextWindow, capabilities)
+		}
+	}
+	return listed, tw.Flush()
+}
+
+// listProviderModels returns the models of one provider and the model it is configured to use.
+func listProviderModels(ctx context.Context, cfg config.Config, provider string, debugMode bool) ([]llm.ModelInfo, string, error) {
+	client, err := llm.NewProviderClient(cfg, provider, debugMode)
+	if err != nil {
+		return nil, "", err
+	}
+	lister, ok := client.(llm.ModelLister)
+	if !ok {
+		return nil, "", errors.New("provider cannot list models")
+	}
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return models, lister.ModelName(), nil
+}
+
+// chooseDefaultModel asks for a number from the listing and saves that
+// provider and model as the default in the user configuration file.
+func chooseDefaultModel(listed []providerModel) error {
+	if !iohandler.IsTerminal(os.Stdin) {
+		return errors.New("--set-default needs a terminal to ask which model to use")
+	}
+	fmt.Printf("\nEnter the number of the model to use by default (1-%d, empty to cancel): ", len(listed))
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	input = strings.TrimSpace(input)
+	if input == "" {
+		fmt.Println("Default model unchanged.")
+		return nil
+	}
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(listed) {
+		return fmt.Errorf("invalid choice %q", input)
+	}
+	choice := listed[n-1]
+
+	cfgPath, err := config.GetConfigFilePath()
+	if err != nil {
+		return fmt.Errorf("could not get config file path: %w", err)
+	}
+	return saveDefaultModel(os.Stdout, cfgPath, choice)
+}
+
+// saveDefaultModel saves choice as the default in the user configuration
+// file at cfgPath, and warns about project and environment settings that
+// override it.
+func saveDefaultModel(w io.Writer, cfgPath string, choice providerModel) error {
+	if err := config.SetDefaultModel(cfgPath, choice.provider, choice.model.Name); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "✅ Default set to %s model %s in %s\n", choice.provider, choice.model.Name, cfgPath)
+
+	cfg, origins, err := config.LoadWithOrigins(config.Flags{})
+	if err != nil {
+		return nil
+	}
+	for _, o := range origins {
+		overridden := (o.Key == "default_provider" && cfg.DefaultProvider != choice.provider) ||
+			(o.Key == "llms."+choice.provider+".model" && cfg.LLMs[choice.provider].Model != choice.model.Name)
+		if overridden {
+			fmt.Fprintf(w, "⚠️  %s = %v from %s still takes precedence\n", o.Key, o.Value, o.Source)
+		}
+	}
+	return nil
+}
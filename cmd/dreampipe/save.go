@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// runSaveCommand implements `dreampipe save NAME`, turning the last successful
+// ad-hoc run into an executable script.
+func runSaveCommand(args []string, debugMode bool) error {
+	saveCmd := flag.NewFlagSet("save", flag.ExitOnError)
+	force := saveCmd.Bool("force", false, "Overwrite an existing script")
+	dir := saveCmd.String("dir", "", "Directory to save to instead of scripts_dir")
+	saveCmd.Parse(args)
+	if saveCmd.NArg() != 1 {
+		return fmt.Errorf("usage: dreampipe save [--force] [--dir DIR] NAME")
+	}
+
+	run, err := script.LoadLastRun()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	if *dir == "" {
+		*dir = cfg.ScriptsDirPath()
+	}
+	return saveScript(*dir, saveCmd.Arg(0), run, *force)
+}
+
+// saveScript writes run as a script called name in dir and tells the user
+// how to run it.
+func saveScript(dir, name string, run script.LastRun, force bool) error {
+	path, err := script.Save(dir, name, run.Script(), force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Saved script %s (%s", path, run.Provider)
+	if run.Model != "" {
+		fmt.Fprintf(os.Stderr, ", %s", run.Model)
+	}
+	fmt.Fprintf(os.Stderr, ")\n")
+	if !onPath(dir) {
+		fmt.Fprintf(os.Stderr, "⚠️  %s is not on your $PATH; run it as %s or set scripts_dir\n", dir, path)
+	}
+	return nil
+}
+
+// onPath reports whether dir is one of the directories in $PATH.
+func onPath(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if pAbs, err := filepath.Abs(p); err == nil && pAbs == abs {
+			return true
+		}
+	}
+	return false
+}
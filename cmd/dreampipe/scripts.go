@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// newScriptInstruction is the placeholder instruction of `dreampipe scripts new`.
+const newScriptInstruction = "Describe what to do with the input here."
+
+// runScriptsCommand implements `dreampipe scripts list|show|edit|new|install`.
+func runScriptsCommand(args []string, debugMode bool) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	subcommand, args := args[0], args[1:]
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	library, err := script.NewLibrary(cfg.ScriptSearchPaths()...)
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "list":
+		return listScripts(library)
+	case "show":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: dreampipe scripts show NAME")
+		}
+		path, err := library.Find(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read script %s: %w", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "# %s\n", path)
+		_, err = os.Stdout.Write(data)
+		return err
+	case "edit":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: dreampipe scripts edit NAME")
+		}
+		path, err := library.Find(args[0])
+		if err != nil {
+			return err
+		}
+		return editScript(path, debugMode)
+	case "new":
+		return newScript(args, library, debugMode)
+	case "install":
+		return installScripts(args, library)
+	default:
+		return fmt.Errorf("unknown scripts command %q (use list, show, edit, new or install)", subcommand)
+	}
+}
+
+// listScripts prints the scripts `dreampipe run` can find.
+func listScripts(library *script.Library) error {
+	entries, err := library.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "No scripts found in %v. Add some with `dreampipe scripts new NAME` or `dreampipe scripts install PATH`.\n", library.Dirs)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDESCRIPTION\tPATH")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Name, entry.Description, entry.Path)
+	}
+	return w.Flush()
+}
+
+// newScript implements `dreampipe scripts new NAME`, creating a script in the
+// library and opening it in the editor.
+func newScript(args []string, library *script.Library, debugMode bool) error {
+	newCmd := flag.NewFlagSet("scripts new", flag.ExitOnError)
+	provider := newCmd.String("provider", "", "Provider to set in the front-matter")
+	model := newCmd.String("model", "", "Model to set in the front-matter")
+	noEdit := newCmd.Bool("no-edit", false, "Don't open the new script in the editor")
+	newCmd.Parse(args)
+	if newCmd.NArg() != 1 {
+		return fmt.Errorf("usage: dreampipe scripts new [--provider NAME] [--model NAME] [--no-edit] NAME")
+	}
+
+	s := script.Script{
+		Meta:        script.Meta{Provider: *provider, Model: *model},
+		Instruction: newScriptInstruction,
+	}
+	path, err := script.Save(library.Dirs[0], newCmd.Arg(0), s, false)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Created script %s\n", path)
+	if *noEdit {
+		return nil
+	}
+	return editScript(path, debugMode)
+}
+
+// editScript opens the script at path in the editor and reports problems
+// with the edited file, so they show up now rather than on the next run.
+func editScript(path string, debugMode bool) error {
+	if err := openInEditor(path, debugMode); err != nil {
+		return err
+	}
+	if _, err := script.Load(path); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+	}
+	return nil
+}
+
+// installScripts implements `dreampipe scripts install PATH...`, copying
+// scripts or directories of scripts into the library.
+func installScripts(args []string, library *script.Library) error {
+	installCmd := flag.NewFlagSet("scripts install", flag.ExitOnError)
+	force := installCmd.Bool("force", false, "Overwrite existing scripts")
+	installCmd.Parse(args)
+	if installCmd.NArg() == 0 {
+		return fmt.Errorf("usage: dreampipe scripts install [--force] PATH...")
+	}
+
+	for _, src := range installCmd.Args() {
+		installed, err := script.Install(src, library.Dirs[0], *force)
+		for _, path := range installed {
+			fmt.Fprintf(os.Stderr, "✅ Installed %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRunCommand implements `dreampipe run [--context FILE] NAME`, running a
+// script found in the library or search paths, and returns the exit status.
+func runRunCommand(args []string, debugMode bool) int {
+	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+	contextFlag := runCmd.String("context", "", "Provide context from a file or process substitution")
+	params := paramsFlag{}
+	runCmd.Var(params, "param", "Set a param the script declares, as NAME=VALUE (repeatable)")
+	noInput := runCmd.Bool("no-input", false, "Run without input instead of reading stdin")
+	edit := runCmd.Bool("edit", false, "Compose the input in your editor instead of typing it on the terminal")
+	noProgress := runCmd.Bool("no-progress", false, "Don't show the status line on stderr while running")
+	runCmd.Parse(args)
+	if runCmd.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: usage: dreampipe run [--context FILE] [--param NAME=VALUE...] [--no-input|--edit] NAME\n")
+		return 1
+	}
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+	library, err := script.NewLibrary(cfg.ScriptSearchPaths()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	path, err := library.Find(runCmd.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, script.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "Run `dreampipe scripts list` to see the available scripts.\n")
+		}
+		return 1
+	}
+
+	var contextData string
+	if *contextFlag != "" {
+		contextBytes, err := os.ReadFile(*contextFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading context file '%s': %v\n", *contextFlag, err)
+			return 1
+		}
+		contextData = string(contextBytes)
+	}
+
+	input, err := inputSource(*noInput, *edit, debugMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	streams := iohandler.DefaultOSStreams()
+	streams.In = input
+	runner := app.NewRunner(cfg, streams, debugMode)
+	runner.SetProgress(!*noProgress)
+	runner.SetParams(params)
+	if err := runner.Run(app.ModeScript, path, contextData); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, app.ErrLimitExceeded) {
+			return exitLimitExceeded
+		}
+		return 1
+	}
+	return 0
+}
+
+// paramsFlag collects repeated --param NAME=VALUE flags.
+type paramsFlag map[string]string
+
+func (p paramsFlag) String() string {
+	return ""
+}
+
+func (p paramsFlag) Set(value string) error {
+	name, v, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected NAME=VALUE, got %q", value)
+	}
+	p[name] = v
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/server"
+)
+
+// serveTokenEnv holds the bearer token of `dreampipe serve`, so it needn't be
+// on the command line.
+const serveTokenEnv = "DREAMPIPE_SERVE_TOKEN"
+
+// shutdownTimeout is how long running requests may take to finish when the
+// server is stopped.
+const shutdownTimeout = 30 * time.Second
+
+// runServeCommand implements `dreampipe serve`, exposing scripts and the
+// configured providers over HTTP until interrupted.
+func runServeCommand(args []string, debugMode bool) error {
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := serveCmd.String("addr", "localhost:8080", "Address to listen on, e.g. :8080 for all interfaces")
+	scriptsDir := serveCmd.String("scripts", "", "Directory of scripts to serve (default: the script library and search paths)")
+	token := serveCmd.String("token", os.Getenv(serveTokenEnv), "Require this bearer token (default $"+serveTokenEnv+")")
+	serveCmd.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dreampipe serve [--addr ADDR] [--scripts DIR] [--token TOKEN]\n")
+		serveCmd.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nThe model of a /v1/chat/completions request is an [llms] entry, e.g. groq, or an\n")
+		fmt.Fprintf(os.Stderr, "entry and one of its models, e.g. groq/llama3-70b-8192; other models get a 404.\n")
+	}
+	serveCmd.Parse(args)
+	if serveCmd.NArg() != 0 {
+		return fmt.Errorf("usage: dreampipe serve [--addr ADDR] [--scripts DIR] [--token TOKEN]")
+	}
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	library := &script.Library{Dirs: []string{*scriptsDir}}
+	if *scriptsDir == "" {
+		if library, err = script.NewLibrary(cfg.ScriptSearchPaths()...); err != nil {
+			return err
+		}
+	} else if info, err := os.Stat(*scriptsDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("scripts directory %s not found", *scriptsDir)
+	}
+	scripts, err := library.List()
+	if err != nil {
+		return err
+	}
+
+	srv := server.New(cfg, library, server.Options{Token: *token, Debug: debugMode, LogOutput: os.Stderr})
+	httpServer := &http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving %d scripts and /v1/chat/completions on http://%s\n", len(scripts), listener.Addr())
+	if *token == "" {
+		fmt.Fprintf(os.Stderr, "⚠️  No --token set: anyone who can reach %s can use your providers\n", listener.Addr())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() { errc <- httpServer.Serve(listener) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	fmt.Fprintf(os.Stderr, "Shutting down...\n")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
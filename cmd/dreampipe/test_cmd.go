@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/scripttest"
+)
+
+// exitTestsFailed is the exit status of `dreampipe test` when a case failed.
+const exitTestsFailed = 6
+
+// errTestsFailed means every test file ran but some cases did not pass.
+var errTestsFailed = errors.New("tests failed")
+
+// runTestCommand implements `dreampipe test [PATH|NAME...]`, running the test
+// cases kept next to scripts.
+func runTestCommand(args []string, debugMode bool) error {
+	testCmd := flag.NewFlagSet("test", flag.ExitOnError)
+	record := testCmd.Bool("record", false, "Run against the provider and save the responses for --replay")
+	replay := testCmd.Bool("replay", false, "Answer from the saved responses instead of the provider")
+	update := testCmd.Bool("update", false, "Write the actual output to each case's expected_file")
+	runFilter := testCmd.String("run", "", "Only run cases whose name matches this regular expression")
+	verbose := testCmd.Bool("v", false, "Print the output of every case")
+	testCmd.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dreampipe test [--record|--replay] [--update] [--run REGEX] [-v] [SCRIPT|TEST_FILE|DIR|NAME...]\n")
+		testCmd.PrintDefaults()
+	}
+	testCmd.Parse(args)
+	if *record && *replay {
+		return fmt.Errorf("--record and --replay can't be combined")
+	}
+
+	opts := scripttest.Options{Update: *update, Debug: debugMode}
+	switch {
+	case *record:
+		opts.Mode = scripttest.ModeRecord
+	case *replay:
+		opts.Mode = scripttest.ModeReplay
+	}
+	if *runFilter != "" {
+		re, err := regexp.Compile(*runFilter)
+		if err != nil {
+			return fmt.Errorf("invalid --run pattern: %w", err)
+		}
+		opts.Filter = re
+	}
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	targets := testCmd.Args()
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+	testFiles, err := findTestFiles(cfg, targets)
+	if err != nil {
+		return err
+	}
+	if len(testFiles) == 0 {
+		return fmt.Errorf("no test files (*%s) found in %s", scripttest.TestFileSuffix, strings.Join(targets, ", "))
+	}
+
+	passed, failed := 0, 0
+	start := time.Now()
+	for _, path := range testFiles {
+		suite, err := scripttest.LoadSuite(path)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "❌ %v\n", err)
+			failed++
+			continue
+		}
+		result, err := scripttest.Run(cfg, suite, opts)
+		if result != nil {
+			p, f := printSuiteResult(result, *verbose)
+			passed += p
+			failed += f
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "❌ %s: %v\n", path, err)
+			failed++
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "\n%d passed, %d failed (%.1fs)\n", passed, failed, time.Since(start).Seconds())
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", errTestsFailed, failed, passed+failed)
+	}
+	return nil
+}
+
+// findTestFiles turns the command line targets into test files: directories
+// are searched, scripts map to the test file next to them, and names that are
+// not paths are looked up like `dreampipe run NAME`.
+func findTestFiles(cfg config.Config, targets []string) ([]string, error) {
+	var files []string
+	for _, target := range targets {
+		info, err := os.Stat(target)
+		switch {
+		case err == nil && info.IsDir():
+			found, err := scripttest.FindTestFiles(target)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, found...)
+		case err == nil && strings.HasSuffix(target, scripttest.TestFileSuffix):
+			files = append(files, target)
+		case err == nil:
+			files = append(files, scripttest.TestFileFor(target))
+		default:
+			library, libErr := script.NewLibrary(cfg.ScriptSearchPaths()...)
+			if libErr != nil {
+				return nil, libErr
+			}
+			path, findErr := library.Find(target)
+			if findErr != nil {
+				return nil, fmt.Errorf("%s is neither a file, a directory nor a script name: %w", target, findErr)
+			}
+			files = append(files, scripttest.TestFileFor(path))
+		}
+	}
+	return files, nil
+}
+
+// printSuiteResult prints the report of one test file and returns the number
+// of passed and failed cases.
+func printSuiteResult(result *scripttest.SuiteResult, verbose bool) (passed, failed int) {
+	fmt.Fprintf(os.Stdout, "=== %s (%s)\n", result.Script, result.Suite.Path)
+	for _, c := range result.Cases {
+		if c.Passed() {
+			passed++
+			fmt.Fprintf(os.Stdout, "  ✅ %s (%.1fs)\n", c.Name, c.Duration.Seconds())
+		} else {
+			failed++
+			fmt.Fprintf(os.Stdout, "  ❌ %s (%.1fs)\n", c.Name, c.Duration.Seconds())
+		}
+		if c.Err != nil {
+			fmt.Fprintf(os.Stdout, "      error: %v\n", c.Err)
+			printIndented(c.Stderr)
+		}
+		for _, f := range c.Failures {
+			fmt.Fprintf(os.Stdout, "      %s: %s\n", f.Check, f.Message)
+			printIndented(f.Diff)
+		}
+		if verbose && c.Output != "" {
+			fmt.Fprintf(os.Stdout, "      output:\n")
+			printIndented(c.Output)
+		}
+	}
+	return passed, failed
+}
+
+// printIndented prints text indented below a case.
+func printIndented(text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(os.Stdout, "        %s\n", line)
+	}
+}
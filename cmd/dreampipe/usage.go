@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/usage"
+)
+
+// runUsageCommand implements `dreampipe usage`, reporting token usage and cost
+// from the local usage ledger.
+func runUsageCommand(args []string) error {
+	usageCmd := flag.NewFlagSet("usage", flag.ExitOnError)
+	byFlag := usageCmd.String("by", usage.ByDay, "Group usage by day, provider, model or script")
+	daysFlag := usageCmd.Int("days", 0, "Only include the last N days (0 includes everything)")
+	usageCmd.Parse(args)
+
+	ledgerPath, err := usage.DefaultLedgerPath()
+	if err != nil {
+		return fmt.Errorf("could not get usage ledger path: %w", err)
+	}
+	records, err := usage.NewLedger(ledgerPath).Records()
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *daysFlag > 0 {
+		year, month, day := time.Now().AddDate(0, 0, -(*daysFlag - 1)).Date()
+		since = time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	}
+	summaries, err := usage.Summarize(records, *byFlag, since)
+	if err != nil {
+		return err
+	}
+	if len(summaries) == 0 {
+		fmt.Fprintf(os.Stderr, "No usage recorded in %s\n", ledgerPath)
+		return nil
+	}
+
+	var total usage.Summary
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\tREQUESTS\tPROMPT TOKENS\tRESPONSE TOKENS\tCOST (USD)\t\n", strings.ToUpper(*byFlag))
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.6f\t\n", s.Key, s.Requests, s.PromptTokens, s.CompletionTokens, s.CostUSD)
+		total.Requests += s.Requests
+		total.PromptTokens += s.PromptTokens
+		total.CompletionTokens += s.CompletionTokens
+		total.CostUSD += s.CostUSD
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%.6f\t\n", total.Requests, total.PromptTokens, total.CompletionTokens, total.CostUSD)
+	return w.Flush()
+}
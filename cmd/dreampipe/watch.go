@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/watch"
+)
+
+// watchUsage is the usage line of `dreampipe watch`.
+const watchUsage = "usage: dreampipe watch --input FILE --out FILE [--context FILE] [--script NAME [--param NAME=VALUE...]] [\"instruction\"]"
+
+// runWatchCommand implements `dreampipe watch`, rewriting the output file
+// each time the input, context or script change, until interrupted.
+func runWatchCommand(args []string, debugMode bool) error {
+	watchCmd := flag.NewFlagSet("watch", flag.ExitOnError)
+	input := watchCmd.String("input", "", "File to transform")
+	output := watchCmd.String("out", "", "File to write the output to, replaced atomically")
+	contextFile := watchCmd.String("context", "", "Provide context from a file, also watched")
+	scriptName := watchCmd.String("script", "", "Run this script instead of an instruction; changes to it are watched too")
+	params := paramsFlag{}
+	watchCmd.Var(params, "param", "Set a param the script declares, as NAME=VALUE (repeatable)")
+	debounce := watchCmd.Duration("debounce", watch.DefaultDebounce, "How long files must stay unchanged before a run")
+	interval := watchCmd.Duration("interval", watch.DefaultInterval, "How often files are checked for changes")
+	skipUnchanged := watchCmd.Bool("skip-unchanged", true, "Skip runs when the files' contents didn't change, e.g. when only touched")
+	watchCmd.Parse(args)
+	if *input == "" || *output == "" {
+		return fmt.Errorf(watchUsage)
+	}
+	if (*scriptName == "") == (watchCmd.NArg() == 0) || watchCmd.NArg() > 1 {
+		return fmt.Errorf("%s\n(give either --script or an instruction)", watchUsage)
+	}
+	if len(params) > 0 && *scriptName == "" {
+		return fmt.Errorf("--param only applies to scripts")
+	}
+
+	cfg, err := config.Load(debugMode)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	job := &watch.Job{
+		Input:         *input,
+		Output:        *output,
+		Debounce:      *debounce,
+		Interval:      *interval,
+		SkipUnchanged: *skipUnchanged,
+		Log:           os.Stderr,
+	}
+	if *contextFile != "" {
+		job.Context = []string{*contextFile}
+	}
+	mode, instructionOrPath := app.ModeAdHoc, watchCmd.Arg(0)
+	if *scriptName != "" {
+		library, err := script.NewLibrary(cfg.ScriptSearchPaths()...)
+		if err != nil {
+			return err
+		}
+		if instructionOrPath, err = library.Find(*scriptName); err != nil {
+			return err
+		}
+		mode = app.ModeScript
+		job.Watch = []string{instructionOrPath}
+	}
+	job.Transform = func(ctx context.Context, input []byte, contextData string) ([]byte, error) {
+		var stdout bytes.Buffer
+		streams := &iohandler.Streams{In: bytes.NewReader(input), Out: &stdout, Err: os.Stderr}
+		runner := app.NewRunner(cfg, streams, debugMode)
+		runner.SetRecordLastRun(false)
+		runner.SetProgress(false) // The log lines would run into it
+		if mode == app.ModeScript {
+			runner.SetParams(params)
+		}
+		if err := runner.RunContext(ctx, mode, instructionOrPath, contextData); err != nil {
+			return nil, err
+		}
+		return stdout.Bytes(), nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return job.Run(ctx)
+}
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/filters"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/prompt"
+	"github.com/hiway/dreampipe/internal/redact"
+	"github.com/hiway/dreampipe/internal/tokens"
+)
+
+// chatAgentPrompt replaces agentPrompt in chat mode, where the instructions
+// arrive one at a time and build on each other.
+const chatAgentPrompt = `You are a Unix command line assistant. The user will give you a series of instructions about the input provided below. Follow each instruction, taking the conversation so far into account, and reply with the result only.`
+
+// chatPrompt is printed on the terminal before reading each instruction.
+const chatPrompt = "dreampipe> "
+
+// chatHelp lists the commands understood by the chat loop.
+const chatHelp = `Type an instruction to run it against the input, or a command:
+  /retry        Ask again for the last instruction
+  /model [NAME] Show or switch the model of the current provider
+  /save FILE    Write the last reply to FILE
+  /help         Show this help
+  /exit         Leave the chat (or press Ctrl-D)`
+
+// ChatOptions configure an interactive chat session.
+type ChatOptions struct {
+	Files       []string  // Files to load as input; stdin is read when empty
+	NoInput     bool      // Chat without input, e.g. when stdin is the terminal
+	Context     string    // Optional context data
+	Instruction string    // Optional first instruction
+	Terminal    io.Reader // Where instructions are read from, usually the TTY
+}
+
+// chatSession is the state of one chat: the conversation so far and the
+// client it is sent to.
+type chatSession struct {
+	client    llm.Client
+	messages  []llm.Message
+	redactor  *redact.Redactor
+	lastReply string
+}
+
+// Chat loads the input once and then runs each instruction read from
+// opts.Terminal against it, keeping the conversation history so that later
+// instructions can refer to earlier replies.
+func (r *Runner) Chat(opts ChatOptions) error {
+	var inputData string
+	if !opts.NoInput {
+		var err error
+		if inputData, err = r.readChatInput(opts.Files); err != nil {
+			r.streams.WriteErrorToStderr("Error reading input: %v", err)
+			return err
+		}
+	}
+	r.LogInfo("Loaded %d bytes of input for chat", len(inputData))
+
+	redactor, err := r.newRedactor(nil)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error preparing redaction: %v", err)
+		return err
+	}
+	contextData := opts.Context
+	if redactor != nil {
+		inputData = redactor.Redact(inputData)
+		contextData = redactor.Redact(contextData)
+	}
+
+	client, err := r.newClient(r.config)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error initializing LLM client: %v", err)
+		return err
+	}
+	session := &chatSession{
+		client:   client,
+		messages: []llm.Message{{Role: llm.RoleSystem, Content: prompt.BuildSystem(chatAgentPrompt, inputData, contextData)}},
+		redactor: redactor,
+	}
+
+	r.streams.WriteInfoToStderr("Chatting about %d bytes of input with %s. Type /help for commands, Ctrl-D to leave.", len(inputData), r.config.DefaultProvider)
+	if opts.Instruction != "" {
+		if err := r.chatTurn(session, opts.Instruction); errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+	}
+
+	scanner := bufio.NewScanner(opts.Terminal)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(r.streams.Err, chatPrompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(r.streams.Err)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		var err error
+		switch {
+		case command == "/exit" || command == "/quit":
+			return nil
+		case command == "/help":
+			r.streams.WriteInfoToStderr("%s", chatHelp)
+		case command == "/retry":
+			err = r.chatRetry(session)
+		case command == "/model":
+			err = r.chatModel(session, arg)
+		case command == "/save":
+			err = r.chatSave(session, arg)
+		case strings.HasPrefix(command, "/"):
+			r.streams.WriteErrorToStderr("Unknown command %s, type /help for commands", command)
+		default:
+			err = r.chatTurn(session, line)
+		}
+		// Limits end the session; other errors were reported and the user can go on.
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+	}
+}
+
+// readChatInput reads the input files, or stdin when there are none, enforcing
+// max_input_bytes on the total.
+func (r *Runner) readChatInput(files []string) (string, error) {
+	if len(files) == 0 {
+		data, err := r.readInput()
+		return string(data), err
+	}
+
+	var sb strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read input file: %w", err)
+		}
+		if len(files) > 1 {
+			fmt.Fprintf(&sb, "==> %s <==\n", file)
+		}
+		sb.Write(data)
+		if !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+		if maxBytes := r.config.Limits.MaxInputBytes; maxBytes > 0 && int64(sb.Len()) > maxBytes {
+			return "", fmt.Errorf("%w: input is larger than max_input_bytes (%d bytes)", ErrLimitExceeded, maxBytes)
+		}
+	}
+	return sb.String(), nil
+}
+
+// chatTurn sends instruction as the next user message and prints the reply.
+func (r *Runner) chatTurn(session *chatSession, instruction string) error {
+	// A failed request leaves its instruction last; it is replaced, not repeated.
+	if last := session.messages[len(session.messages)-1]; last.Role == llm.RoleUser {
+		session.messages = session.messages[:len(session.messages)-1]
+	}
+	if session.redactor != nil {
+		instruction = session.redactor.Redact(instruction)
+	}
+	session.messages = append(session.messages, llm.Message{Role: llm.RoleUser, Content: instruction})
+	return r.chatSend(session)
+}
+
+// chatRetry drops the last reply and sends the last instruction again.
+func (r *Runner) chatRetry(session *chatSession) error {
+	if last := session.messages[len(session.messages)-1]; last.Role == llm.RoleAssistant {
+		session.messages = session.messages[:len(session.messages)-1]
+	}
+	if session.messages[len(session.messages)-1].Role != llm.RoleUser {
+		r.streams.WriteErrorToStderr("Nothing to retry yet")
+		return nil
+	}
+	return r.chatSend(session)
+}
+
+// chatSend sends the conversation, which ends with a user message, and
+// prints and records the reply.
+func (r *Runner) chatSend(session *chatSession) error {
+	r.trimHistory(session)
+	reply, err := r.send(session.client, chatText(session.messages), func(ctx context.Context) (llm.Response, error) {
+		return session.client.Chat(ctx, session.messages)
+	})
+	if err != nil {
+		return err
+	}
+	session.messages = append(session.messages, llm.Message{Role: llm.RoleAssistant, Content: reply})
+
+	output := (&filters.MarkdownCodeBlockFilter{}).Apply(reply)
+	output = r.restoreRedacted(session.redactor, output)
+	session.lastReply = output
+	return r.streams.WriteStringToStdout(output + "\n")
+}
+
+// chatText joins the messages' contents, to estimate the conversation's tokens.
+func chatText(messages []llm.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// trimHistory drops the oldest instructions and their replies until the
+// conversation fits the context window and max_tokens_per_request, and warns
+// when it does. The system message with the input and the last instruction
+// are always kept.
+func (r *Runner) trimHistory(session *chatSession) {
+	budget := 0
+	if window := r.contextWindow(); window > 0 {
+		budget = promptBudget(window)
+	}
+	if maxTokens := r.config.Limits.MaxTokensPerRequest; maxTokens > 0 && (budget == 0 || maxTokens < budget) {
+		budget = maxTokens
+	}
+	if budget == 0 {
+		return
+	}
+	dropped := 0
+	for len(session.messages) > 2 && tokens.Estimate(chatText(session.messages)) > budget {
+		session.messages = append(session.messages[:1], session.messages[3:]...)
+		dropped++
+	}
+	if dropped > 0 {
+		r.streams.WriteErrorToStderr("Warning: dropped the %d oldest instructions and replies of the chat to stay within %d tokens", dropped, budget)
+	}
+}
+
+// chatModel shows the current model, or switches to another model of the same
+// provider while keeping the conversation.
+func (r *Runner) chatModel(session *chatSession, model string) error {
+	provider := r.config.DefaultProvider
+	llmCfg, _ := r.config.GetLLMConfig(provider)
+	if model == "" {
+		current := llmCfg.Model
+		if lister, ok := session.client.(llm.ModelLister); ok {
+			current = lister.ModelName()
+		}
+		r.streams.WriteInfoToStderr("Using %s model %s", provider, current)
+		return nil
+	}
+
+	cfg := r.config
+	cfg.LLMs = make(map[string]config.LLMConfig, len(r.config.LLMs))
+	for name, c := range r.config.LLMs {
+		cfg.LLMs[name] = c
+	}
+	llmCfg.Model = model
+	cfg.LLMs[provider] = llmCfg
+
+	client, err := r.newClient(cfg)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error switching model: %v", err)
+		return err
+	}
+	r.config = cfg
+	session.client = client
+	r.streams.WriteInfoToStderr("Switched to %s model %s", provider, model)
+	return nil
+}
+
+// chatSave writes the last reply to path.
+func (r *Runner) chatSave(session *chatSession, path string) error {
+	if path == "" {
+		r.streams.WriteErrorToStderr("Usage: /save FILE")
+		return nil
+	}
+	if session.lastReply == "" {
+		r.streams.WriteErrorToStderr("No reply to save yet")
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(session.lastReply+"\n"), 0644); err != nil {
+		r.streams.WriteErrorToStderr("Error saving reply: %v", err)
+		return err
+	}
+	r.streams.WriteInfoToStderr("Saved last reply to %s", path)
+	return nil
+}
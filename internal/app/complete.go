@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// Complete sends messages to the default provider as one chat request, with
+// the limits, redaction, timeout and usage recording of a run, and returns the
+// provider's response. `dreampipe serve` proxies chat completions with it.
+func (r *Runner) Complete(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	r.ctx = ctx
+	redactor, err := r.newRedactor(nil)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error preparing redaction: %v", err)
+		return llm.Response{}, err
+	}
+	sent := make([]llm.Message, len(messages))
+	var allContent strings.Builder
+	for i, m := range messages {
+		if redactor != nil {
+			m.Content = redactor.Redact(m.Content)
+		}
+		sent[i] = m
+		allContent.WriteString(m.Content)
+		allContent.WriteString("\n")
+	}
+	if redactor != nil && redactor.Count() > 0 {
+		r.LogInfo("Redacted %d values before sending to %s (%s)", redactor.Count(), r.config.DefaultProvider, redactor.Summary())
+	}
+
+	client, err := r.newClient(r.config)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error initializing LLM client: %v", err)
+		return llm.Response{}, err
+	}
+	resp, err := r.sendRequest(client, allContent.String(), func(ctx context.Context) (llm.Response, error) {
+		return client.Chat(ctx, sent)
+	})
+	if err != nil {
+		return llm.Response{}, err
+	}
+	resp.Text = r.restoreRedacted(redactor, resp.Text)
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/prompt"
+	"github.com/hiway/dreampipe/internal/tokens"
+)
+
+// responseTokenReserve is the number of tokens kept free in the context window
+// for the model's response.
+const responseTokenReserve = 1024
+
+// truncationMarker is appended to input that was cut to fit the context window.
+const truncationMarker = "\n\n[... input truncated by dreampipe to fit the model's context window ...]"
+
+// contextWindow returns the context window size for the default provider,
+// or 0 if it is unknown. Built-in sizes are looked up by the entry's type, so
+// an entry named "work" with type = "groq" gets Groq's.
+func (r *Runner) contextWindow() int {
+	llmCfg, _ := r.config.GetLLMConfig(r.config.DefaultProvider)
+	if llmCfg.ContextWindow > 0 {
+		return llmCfg.ContextWindow
+	}
+	return tokens.ContextWindow(r.providerType(r.config.DefaultProvider), llmCfg.Model)
+}
+
+// promptBudget returns the number of tokens available for the prompt in a
+// context window of the given size, leaving room for the response.
+func promptBudget(window int) int {
+	reserve := responseTokenReserve
+	if window <= 2*reserve {
+		reserve = window / 4
+	}
+	return window - reserve
+}
+
+// buildPrompts constructs the prompt(s) to send, applying the configured
+// context overflow strategy when the input does not fit the context window.
+// More than one prompt is returned only in chunk mode.
+func (r *Runner) buildPrompts(instruction, inputData, contextData string) ([]string, error) {
+	finalPrompt := prompt.Build(AgentPrompt, instruction, inputData, contextData)
+	promptTokens := tokens.Estimate(finalPrompt)
+
+	window := r.contextWindow()
+	if window == 0 {
+		r.LogInfo("Estimated prompt tokens: %d (context window unknown, skipping check)", promptTokens)
+		return []string{finalPrompt}, nil
+	}
+	budget := promptBudget(window)
+	r.LogInfo("Estimated prompt tokens: %d of %d available (context window %d)", promptTokens, budget, window)
+	if promptTokens <= budget {
+		return []string{finalPrompt}, nil
+	}
+
+	strategy := r.config.ContextOverflow
+	if strategy == "" {
+		strategy = config.ContextOverflowWarn
+	}
+	if strategy == config.ContextOverflowWarn {
+		r.streams.WriteErrorToStderr("Warning: prompt is about %d tokens but the context window only has room for %d; the provider may truncate or reject it", promptTokens, budget)
+		return []string{finalPrompt}, nil
+	}
+	if strategy == config.ContextOverflowError {
+		return nil, fmt.Errorf("prompt is about %d tokens but the context window only has room for %d (context_overflow = %q)", promptTokens, budget, strategy)
+	}
+
+	// Everything except the input counts against the budget of every prompt.
+	overhead := tokens.Estimate(prompt.Build(AgentPrompt, instruction, "", contextData))
+	inputBudget := budget - overhead
+	if strategy == config.ContextOverflowTruncate {
+		inputBudget -= tokens.Estimate(truncationMarker)
+	}
+	if inputBudget <= 0 {
+		return nil, fmt.Errorf("instruction and context alone are about %d tokens, leaving no room for input in a context window of %d", overhead, window)
+	}
+
+	switch strategy {
+	case config.ContextOverflowTruncate:
+		truncated, _ := tokens.Truncate(inputData, inputBudget)
+		r.streams.WriteErrorToStderr("Warning: input truncated from about %d to %d tokens to fit the context window", tokens.Estimate(inputData), tokens.Estimate(truncated))
+		return []string{prompt.Build(AgentPrompt, instruction, truncated+truncationMarker, contextData)}, nil
+	case config.ContextOverflowChunk:
+		chunks := tokens.Split(inputData, inputBudget)
+		r.LogInfo("Input exceeds context window, processing in %d chunks", len(chunks))
+		prompts := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			prompts = append(prompts, prompt.Build(AgentPrompt, instruction, chunk, contextData))
+		}
+		return prompts, nil
+	default:
+		return nil, fmt.Errorf("unknown context overflow strategy: %s", strategy)
+	}
+}
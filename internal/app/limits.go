@@ -0,0 +1,124 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/tokens"
+	"github.com/hiway/dreampipe/internal/usage"
+)
+
+// ErrLimitExceeded is wrapped by every error caused by a configured limit in [limits].
+// Such errors are always returned before the offending request is sent.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// SpendGuard holds the estimated cost of the requests in flight by provider,
+// counted against daily_spend_usd until they are recorded in the usage
+// ledger. Every runner has its own; runners whose runs overlap, e.g. those
+// of a server, share one with SetSpendGuard so that concurrent requests
+// can't all pass the cap before any of them is recorded.
+type SpendGuard struct {
+	mu       sync.Mutex
+	reserved map[string]float64
+}
+
+// NewSpendGuard returns a guard with nothing in flight.
+func NewSpendGuard() *SpendGuard {
+	return &SpendGuard{reserved: make(map[string]float64)}
+}
+
+// readInput reads stdin, enforcing max_input_bytes.
+func (r *Runner) readInput() ([]byte, error) {
+	maxBytes := r.config.Limits.MaxInputBytes
+	data, err := r.streams.ReadAllFromStdinLimited(maxBytes)
+	if errors.Is(err, iohandler.ErrInputTooLarge) {
+		return nil, fmt.Errorf("%w: input is larger than max_input_bytes (%d bytes)", ErrLimitExceeded, maxBytes)
+	}
+	return data, err
+}
+
+// checkRequestCount enforces max_requests_per_run for a run that needs n requests.
+func (r *Runner) checkRequestCount(n int) error {
+	maxRequests := r.config.Limits.MaxRequestsPerRun
+	if maxRequests > 0 && r.requests+n > maxRequests {
+		return fmt.Errorf("%w: run needs %d requests but max_requests_per_run is %d", ErrLimitExceeded, r.requests+n, maxRequests)
+	}
+	return nil
+}
+
+// checkRequestLimits enforces the per-request limits before a prompt is sent
+// to provider. It returns the estimated cost it reserved, which the caller
+// releases with releaseSpend once the request is done; r.mu must be held.
+func (r *Runner) checkRequestLimits(provider, finalPrompt string) (float64, error) {
+	if err := r.checkRequestCount(1); err != nil {
+		return 0, err
+	}
+
+	promptTokens := tokens.Estimate(finalPrompt)
+	if maxTokens := r.config.Limits.MaxTokensPerRequest; maxTokens > 0 && promptTokens > maxTokens {
+		return 0, fmt.Errorf("%w: prompt is about %d tokens but max_tokens_per_request is %d", ErrLimitExceeded, promptTokens, maxTokens)
+	}
+
+	return r.checkDailySpend(provider, promptTokens)
+}
+
+// checkDailySpend enforces the provider's daily_spend_usd cap using today's
+// records in the usage ledger, plus the estimated cost of the prompt and of
+// the requests in flight. Requests are only recorded once they are done, so
+// the prompt's cost is reserved until then: parallel chunks can't all pass
+// the check before any of them is recorded.
+func (r *Runner) checkDailySpend(provider string, promptTokens int) (float64, error) {
+	spendCap, ok := r.config.Limits.DailySpendUSD[provider]
+	if !ok {
+		return 0, nil
+	}
+	if !r.config.RecordUsage {
+		r.streams.WriteErrorToStderr("Warning: daily_spend_usd for '%s' is not enforced because record_usage is off", provider)
+		return 0, nil
+	}
+
+	// The ledger is read and the prompt reserved in one step, so that no
+	// other request sharing the guard passes the check in between.
+	r.spend.mu.Lock()
+	defer r.spend.mu.Unlock()
+	ledgerPath, err := usage.DefaultLedgerPath()
+	if err != nil {
+		return 0, fmt.Errorf("could not determine usage ledger path to check daily spend: %w", err)
+	}
+	records, err := usage.NewLedger(ledgerPath).Records()
+	if err != nil {
+		return 0, fmt.Errorf("could not check daily spend: %w", err)
+	}
+	year, month, day := time.Now().Date()
+	startOfDay := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	spent := 0.0
+	for _, rec := range records {
+		if rec.Provider == provider && !rec.Time.Before(startOfDay) {
+			spent += rec.CostUSD
+		}
+	}
+
+	spent += r.spend.reserved[provider]
+
+	llmCfg, _ := r.config.GetLLMConfig(provider)
+	promptCost, _ := usage.Cost(r.providerType(provider), llmCfg.Model, promptTokens, 0, r.config.Prices)
+	r.LogInfo("Spent $%.4f of $%.2f daily cap for %s today, including requests in flight", spent, spendCap, provider)
+	if spent+promptCost > spendCap {
+		return 0, fmt.Errorf("%w: daily spend for '%s' would exceed daily_spend_usd ($%.4f spent today, cap $%.2f)", ErrLimitExceeded, provider, spent, spendCap)
+	}
+	r.spend.reserved[provider] += promptCost
+	return promptCost, nil
+}
+
+// releaseSpend releases the cost reserved by checkDailySpend once the
+// request is done, and recorded if it succeeded.
+func (r *Runner) releaseSpend(provider string, reserved float64) {
+	if reserved != 0 {
+		r.spend.mu.Lock()
+		defer r.spend.mu.Unlock()
+		r.spend.reserved[provider] -= reserved
+	}
+}
@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/filters"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/prompt"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/tokens"
+)
+
+const (
+	// defaultMapParallel is how many chunks are sent at the same time.
+	defaultMapParallel = 4
+	// defaultChunkTokens is the chunk size when the context window is unknown.
+	defaultChunkTokens = 2000
+)
+
+// defaultReduceInstruction combines partial results when the script or flags
+// don't give a reduce instruction. %s is the map instruction.
+const defaultReduceInstruction = `The input consists of partial results. Each was produced by applying the instruction below to one part of a larger input, in order. Combine them into a single result, as if the instruction had been applied to the whole input at once. Remove repetition, keep the format the instruction asks for, and do not mention the parts.
+
+Instruction: %s`
+
+// SetMapReduce makes every run use map-reduce, with the non-zero fields of mr
+// overriding the script's front-matter.
+func (r *Runner) SetMapReduce(mr script.MapReduce) {
+	r.mapReduceOverride = &mr
+}
+
+// mergeMapReduce combines the front-matter and override settings; nil means
+// map-reduce is only used when context_overflow asks for it.
+func mergeMapReduce(meta, override *script.MapReduce) *script.MapReduce {
+	if meta == nil && override == nil {
+		return nil
+	}
+	var mr script.MapReduce
+	if meta != nil {
+		mr = *meta
+	}
+	if override != nil {
+		mr = mr.Merge(*override)
+	}
+	return &mr
+}
+
+// wantsMapReduce reports whether instruction should be map-reduced: always
+// when the script or flags ask for it, and with context_overflow = "map_reduce"
+// when the prompt doesn't fit the context window.
+func (r *Runner) wantsMapReduce(instruction, inputData, contextData string) bool {
+	if r.mapReduce != nil {
+		return true
+	}
+	if r.config.ContextOverflow != config.ContextOverflowMapReduce {
+		return false
+	}
+	window := r.contextWindow()
+	return window > 0 && tokens.Estimate(prompt.Build(AgentPrompt, instruction, inputData, contextData)) > promptBudget(window)
+}
+
+// runMapReduce applies instruction to each chunk of inputData in parallel,
+// then combines the partial results with the reduce instruction, in rounds,
+// until a single result is left. The filters apply to every result.
+func (r *Runner) runMapReduce(instruction, inputData, contextData string, filterNames []string) (string, llm.Client, error) {
+	var mr script.MapReduce
+	if r.mapReduce != nil {
+		mr = *r.mapReduce
+	}
+	reduceInstruction := mr.Reduce
+	if reduceInstruction == "" {
+		reduceInstruction = fmt.Sprintf(defaultReduceInstruction, instruction)
+	}
+	parallel := mr.Parallel
+	if parallel == 0 {
+		parallel = defaultMapParallel
+	}
+
+	chunkTokens, err := r.chunkTokens(mr, instruction, reduceInstruction, contextData)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error: %v", err)
+		return "", nil, err
+	}
+	chunks := tokens.Split(inputData, chunkTokens)
+	if len(chunks) == 0 {
+		chunks = []string{""}
+	}
+	// The map round is known up front; reduce rounds are checked as they are sent.
+	if err := r.checkRequestCount(len(chunks)); err != nil {
+		r.streams.WriteErrorToStderr("Error: %v", err)
+		return "", nil, err
+	}
+
+	r.LogInfo("Initializing LLM client for provider: %s", r.config.DefaultProvider)
+	llmClient, err := r.newClient(r.config)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error initializing LLM client: %v", err)
+		return "", nil, err
+	}
+
+	r.LogInfo("Map: applying the instruction to %d chunks of up to %d tokens, %d at a time", len(chunks), chunkTokens, parallel)
+	r.status.SetProgress(0, len(chunks), "chunks")
+	defer r.status.SetProgress(0, 0, "")
+	results, err := r.mapChunks(llmClient, instruction, chunks, contextData, filterNames, parallel)
+	if err != nil {
+		return "", nil, err
+	}
+	for round := 1; len(results) > 1; round++ {
+		groups := groupResults(results, chunkTokens)
+		if err := r.checkReduceFits(reduceInstruction, groups, contextData); err != nil {
+			r.streams.WriteErrorToStderr("Error: %v", err)
+			return "", nil, err
+		}
+		r.LogInfo("Reduce round %d: combining %d partial results into %d", round, len(results), len(groups))
+		r.status.SetProgress(0, len(groups), fmt.Sprintf("groups, reduce round %d", round))
+		if results, err = r.mapChunks(llmClient, reduceInstruction, groups, contextData, filterNames, parallel); err != nil {
+			return "", nil, err
+		}
+	}
+	return results[0], llmClient, nil
+}
+
+// chunkTokens returns the input tokens per chunk: chunk_tokens if set,
+// otherwise what fits the context window next to the longer instruction.
+func (r *Runner) chunkTokens(mr script.MapReduce, instruction, reduceInstruction, contextData string) (int, error) {
+	if mr.ChunkTokens > 0 {
+		return mr.ChunkTokens, nil
+	}
+	window := r.contextWindow()
+	if window == 0 {
+		r.LogInfo("Context window unknown, using chunks of %d tokens", defaultChunkTokens)
+		return defaultChunkTokens, nil
+	}
+	longest := instruction
+	if len(reduceInstruction) > len(longest) {
+		longest = reduceInstruction
+	}
+	overhead := tokens.Estimate(prompt.Build(AgentPrompt, longest, "", contextData))
+	budget := promptBudget(window) - overhead
+	if budget <= 0 {
+		return 0, fmt.Errorf("instruction and context alone are about %d tokens, leaving no room for input in a context window of %d", overhead, window)
+	}
+	return budget, nil
+}
+
+// checkReduceFits reports an error if a group of partial results doesn't fit
+// the context window next to the reduce instruction. Groups hold at least two
+// results, so long results can outgrow chunk_tokens.
+func (r *Runner) checkReduceFits(reduceInstruction string, groups []string, contextData string) error {
+	window := r.contextWindow()
+	if window == 0 {
+		return nil
+	}
+	for i, group := range groups {
+		groupTokens := tokens.Estimate(prompt.Build(AgentPrompt, reduceInstruction, group, contextData))
+		if groupTokens > promptBudget(window) {
+			return fmt.Errorf("partial results %d of %d are about %d tokens combined, more than fit a context window of %d; lower chunk_tokens or ask for shorter results", i+1, len(groups), groupTokens, window)
+		}
+	}
+	return nil
+}
+
+// mapChunks applies instruction to every chunk, at most parallel at a time,
+// and returns the filtered results in chunk order. The first failure cancels
+// the chunks in flight and stops the rest from being sent.
+func (r *Runner) mapChunks(llmClient llm.Client, instruction string, chunks []string, contextData string, filterNames []string, parallel int) ([]string, error) {
+	parent := r.ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	r.ctx = ctx
+	defer func() { r.ctx = parent }()
+
+	results := make([]string, len(chunks))
+	var (
+		failOnce sync.Once
+		failErr  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			cancel()
+		})
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, chunk string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			response, err := r.generate(llmClient, prompt.Build(AgentPrompt, instruction, chunk, contextData))
+			if err != nil {
+				fail(fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err))
+				return
+			}
+			results[i] = applyFilters(response, filterNames)
+			r.status.Advance()
+		}(i, chunk)
+	}
+	wg.Wait()
+	if failErr != nil {
+		return nil, failErr
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// groupResults joins consecutive partial results into groups of about
+// chunkTokens. Every group but possibly the last has at least two results,
+// so each reduce round at least halves their number.
+func groupResults(results []string, chunkTokens int) []string {
+	var groups []string
+	var current []string
+	currentTokens := 0
+	flush := func() {
+		groups = append(groups, strings.Join(current, "\n\n---\n\n"))
+		current, currentTokens = nil, 0
+	}
+	for _, result := range results {
+		resultTokens := tokens.Estimate(result)
+		if len(current) >= 2 && currentTokens+resultTokens > chunkTokens {
+			flush()
+		}
+		current = append(current, result)
+		currentTokens += resultTokens
+	}
+	if len(current) > 0 {
+		flush()
+	}
+	return groups
+}
+
+// applyFilters applies the named filters to output in order. The names were
+// checked when the script was parsed; unknown ones are skipped.
+func applyFilters(output string, filterNames []string) string {
+	for _, name := range filterNames {
+		if filter, err := filters.Lookup(name); err == nil {
+			output = filter.Apply(output)
+		}
+	}
+	return output
+}
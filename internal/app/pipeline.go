@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/filters"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// runSteps runs the steps of a multi-step script in order. The first step
+// reads inputData and every later step reads the output of the one before;
+// the output of the last step is returned.
+func (r *Runner) runSteps(steps []script.Step, inputData, contextData string) (string, error) {
+	// Steps switch provider and model; the script's own choice is the default.
+	base := r.config
+	defer func() { r.config = base }()
+
+	outputs := make(map[string]string)
+	for i, step := range steps {
+		label := fmt.Sprintf("step %d", i+1)
+		if step.Name != "" {
+			label = fmt.Sprintf("step %d (%s)", i+1, step.Name)
+		}
+
+		cfg, err := ConfigWith(base, step.Provider, step.Model)
+		if err != nil {
+			r.streams.WriteErrorToStderr("Error in %s: %v", label, err)
+			return "", fmt.Errorf("%s: %w", label, err)
+		}
+		r.config = cfg
+		r.LogInfo("Running %s of %d with provider %s, model %s", label, len(steps), cfg.DefaultProvider, cfg.LLMs[cfg.DefaultProvider].Model)
+
+		stepFilters := step.Filters
+		if stepFilters == nil {
+			stepFilters = filters.DefaultFilters
+		}
+		output, _, err := r.runInstruction(step.Instruction, inputData, stepContext(contextData, step.Context, outputs), stepFilters)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", label, err)
+		}
+		if step.Name != "" {
+			outputs[step.Name] = output
+		}
+		inputData = output
+	}
+	return inputData, nil
+}
+
+// stepContext combines the run's context data with the outputs of the earlier
+// steps a step names in its context.
+func stepContext(contextData string, names []string, outputs map[string]string) string {
+	var parts []string
+	if strings.TrimSpace(contextData) != "" {
+		parts = append(parts, strings.TrimSpace(contextData))
+	}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s:\n\n%s", name, strings.TrimSpace(outputs[name])))
+	}
+	return strings.Join(parts, "\n\n---\n\n")
+}
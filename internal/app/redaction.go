@@ -0,0 +1,37 @@
+package app
+
+import (
+	"github.com/hiway/dreampipe/internal/redact"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// newRedactor returns a Redactor for the default provider and the providers
+// of steps, or nil if redaction is enabled for none of them. The input is
+// redacted once for the whole run, so if any step's provider needs it, every
+// step gets the redacted input; otherwise the outputs of earlier steps would
+// carry the values on to it.
+func (r *Runner) newRedactor(steps []script.Step) (*redact.Redactor, error) {
+	enabled := r.config.RedactionEnabled(r.config.DefaultProvider)
+	for _, step := range steps {
+		if step.Provider != "" && r.config.RedactionEnabled(step.Provider) {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+	rules, err := redact.RulesFromConfig(r.config.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	return redact.New(rules), nil
+}
+
+// restoreRedacted puts redacted values back into output if configured to.
+func (r *Runner) restoreRedacted(redactor *redact.Redactor, output string) string {
+	if redactor == nil || !r.config.Redaction.Restore || redactor.Count() == 0 {
+		return output
+	}
+	r.LogInfo("Restoring redacted values in output")
+	return redactor.Restore(output)
+}
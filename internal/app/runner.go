@@ -2,7 +2,11 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	// --- Internal Imports ---
@@ -10,30 +14,95 @@ import (
 	"github.com/hiway/dreampipe/internal/filters"   // Add filters package
 	"github.com/hiway/dreampipe/internal/iohandler" // Adjust import path
 	"github.com/hiway/dreampipe/internal/llm"       // Adjust import path - Placeholder
-	"github.com/hiway/dreampipe/internal/prompt"    // Adjust import path - Placeholder
+	"github.com/hiway/dreampipe/internal/script"
 )
 
-// agentPrompt is the static prefix defining the LLM's role.
+// AgentPrompt is the static prefix defining the LLM's role.
 // TODO: Consider making this configurable in config.go if needed later.
-const agentPrompt = `You are a Unix command line filter, you will follow the instructions below to transform, translate, convert, edit or modify the input provided below to the desired outcome.`
+const AgentPrompt = `You are a Unix command line filter, you will follow the instructions below to transform, translate, convert, edit or modify the input provided below to the desired outcome.`
 
 // Runner encapsulates the core application logic and dependencies.
 type Runner struct {
-	config  config.Config
-	streams *iohandler.Streams
-	debug   bool
+	config   config.Config
+	streams  *iohandler.Streams
+	debug    bool
+	script   string // Name of the script being run, empty in ad-hoc mode
+	requests int    // Number of LLM requests sent so far in this run
+	lastRun  *script.LastRun
+	// mapReduce is set when the run always uses map-reduce, from the script's
+	// front-matter and SetMapReduce.
+	mapReduce         *script.MapReduce
+	mapReduceOverride *script.MapReduce
+	// mu guards requests, usage recording and stderr while chunks are sent in parallel.
+	mu sync.Mutex
+	// ctx is the context of the current run; requests are canceled with it.
+	ctx context.Context
+	// clientFactory creates the LLM clients; nil uses llm.GetClient.
+	clientFactory func(cfg config.Config, debugMode bool) (llm.Client, error)
+	// recordLastRun keeps ad-hoc runs for `dreampipe save`.
+	recordLastRun bool
+	// params are the values of the script's declared params, from SetParams.
+	params map[string]string
+	// status shows what the run is doing while stderr is a terminal; nil when
+	// it isn't shown. statusStreams are the streams from before it was started.
+	status        *iohandler.StatusLine
+	statusStreams *iohandler.Streams
+	// inflight is the number of requests waiting for a response.
+	inflight int
+	// spend holds the estimated cost of the requests in flight, see SpendGuard.
+	spend *SpendGuard
 	// llmClient llm.Client // Store the client if initialized once
 }
 
 // NewRunner creates a new Runner instance with its dependencies.
 func NewRunner(cfg config.Config, streams *iohandler.Streams, debugMode bool) *Runner {
 	return &Runner{
-		config:  cfg,
-		streams: streams,
-		debug:   debugMode,
+		config:        cfg,
+		streams:       streams,
+		debug:         debugMode,
+		ctx:           context.Background(),
+		recordLastRun: true,
+		spend:         NewSpendGuard(),
 	}
 }
 
+// SetClientFactory makes the runner create its LLM clients with factory
+// instead of llm.GetClient, e.g. to send every request to one client.
+func (r *Runner) SetClientFactory(factory func(cfg config.Config, debugMode bool) (llm.Client, error)) {
+	r.clientFactory = factory
+}
+
+// SetRecordLastRun controls whether ad-hoc runs are kept for `dreampipe save`.
+func (r *Runner) SetRecordLastRun(record bool) {
+	r.recordLastRun = record
+}
+
+// SetProgress controls whether the status line may be shown on stderr, on
+// top of the progress setting. Servers turn it off, as their runs overlap
+// and would each draw a line on the same terminal.
+func (r *Runner) SetProgress(show bool) {
+	r.config.Progress = r.config.Progress && show
+}
+
+// SetParams sets the values of the params the script declares in its
+// front-matter; declared params without a value use their defaults.
+func (r *Runner) SetParams(params map[string]string) {
+	r.params = params
+}
+
+// SetSpendGuard makes the runner reserve the cost of its requests in guard.
+func (r *Runner) SetSpendGuard(guard *SpendGuard) {
+	r.spend = guard
+}
+
+// newClient creates an LLM client for cfg.
+func (r *Runner) newClient(cfg config.Config) (llm.Client, error) {
+	if r.clientFactory != nil {
+		return r.clientFactory(cfg, r.debug)
+	}
+	return llm.GetClient(cfg, r.debug)
+}
+
 // LogInfo writes an informational message to stderr if debug mode is enabled.
 func (r *Runner) LogInfo(format string, args ...interface{}) {
 	if r.debug {
@@ -46,14 +115,20 @@ func (r *Runner) LogInfo(format string, args ...interface{}) {
 // Run executes the main dreampipe logic based on the mode and instruction/path.
 // Context data is optional and can be empty.
 func (r *Runner) Run(mode RunMode, instructionOrPath string, contextData string) error {
+	return r.RunContext(context.Background(), mode, instructionOrPath, contextData)
+}
+
+// RunContext is like Run, but stops sending requests once ctx is done.
+func (r *Runner) RunContext(ctx context.Context, mode RunMode, instructionOrPath string, contextData string) error {
+	r.ctx = ctx
 	// 1. Determine the actual user instruction (read file if needed)
-	userInstruction, err := resolveInstruction(mode, instructionOrPath)
+	userInstruction, meta, err := resolveInstruction(mode, instructionOrPath, r.params)
 	if err != nil {
 		// resolveInstruction failed (e.g., file not found, bad mode)
 		r.streams.WriteErrorToStderr("Error determining instruction: %v", err)
 		return err
 	}
-	if userInstruction == "" {
+	if userInstruction == "" && len(meta.Steps) == 0 {
 		err = fmt.Errorf("resolved user instruction is empty")
 		r.streams.WriteErrorToStderr("Error: %v", err)
 		return err
@@ -62,7 +137,13 @@ func (r *Runner) Run(mode RunMode, instructionOrPath string, contextData string)
 	// Inform user what instruction is being used (useful for script mode)
 	if mode == ModeScript {
 		r.LogInfo("Using instruction from script '%s'", instructionOrPath)
+		r.script = filepath.Base(instructionOrPath)
+		if err := r.applyScriptMeta(meta); err != nil {
+			r.streams.WriteErrorToStderr("Error: %v", err)
+			return err
+		}
 	}
+	r.mapReduce = mergeMapReduce(meta.MapReduce, r.mapReduceOverride)
 
 	// Inform user if context is being used
 	if contextData != "" {
@@ -71,59 +152,208 @@ func (r *Runner) Run(mode RunMode, instructionOrPath string, contextData string)
 
 	// 2. Read input data from stdin
 	// Note: This reads *all* input, respecting the current limitation.
+	// The status line starts after typed input, so it isn't drawn over it.
+	defer r.stopStatus()
+	if !isTerminalReader(r.streams.In) {
+		r.startStatus()
+	}
 	r.LogInfo("Reading from stdin...") // Inform user
-	inputDataBytes, err := r.streams.ReadAllFromStdin()
+	inputDataBytes, err := r.readInput()
 	if err != nil {
 		r.streams.WriteErrorToStderr("Error reading from stdin: %v", err)
 		return err
 	}
 	inputData := string(inputDataBytes)
 	r.LogInfo("Finished reading stdin (%d bytes)", len(inputDataBytes))
+	r.startStatus()
 
-	// 3. Construct the final prompt
-	finalPrompt := prompt.Build(agentPrompt, userInstruction, inputData, contextData)
+	// Redact secrets and personal information before they become part of the prompt
+	redactor, err := r.newRedactor(meta.Steps)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error preparing redaction: %v", err)
+		return err
+	}
+	if redactor != nil {
+		inputData = redactor.Redact(inputData)
+		contextData = redactor.Redact(contextData)
+		if redactor.Count() > 0 {
+			r.LogInfo("Redacted %d values before sending (%s)", redactor.Count(), redactor.Summary())
+		}
+	}
+
+	// 3. Run the instruction, or each step of a multi-step script
+	var output string
+	var llmClient llm.Client
+	if len(meta.Steps) > 0 {
+		output, err = r.runSteps(meta.Steps, inputData, contextData)
+	} else {
+		output, llmClient, err = r.runInstruction(userInstruction, inputData, contextData, filters.DefaultFilters)
+	}
+	if err != nil {
+		return err
+	}
 
-	// 4. Initialize LLM Client
+	// 4. Write LLM response to stdout
+	r.stopStatus()
+	output = r.restoreRedacted(redactor, output)
+	err = r.streams.WriteStringToStdout(output)
+	if err != nil {
+		// This is tricky, stdout might be closed or broken. Log to stderr.
+		r.streams.WriteErrorToStderr("Error writing LLM response to stdout: %v", err)
+		return err // Return the error so main exits non-zero
+	}
+
+	// 5. Success
+	if mode == ModeAdHoc && r.recordLastRun {
+		r.rememberRun(llmClient, userInstruction)
+	}
+	r.LogInfo("Done.")
+	return nil
+}
+
+// runInstruction sends instruction with inputData and contextData to the
+// default provider, in chunks if the input needs them, and returns the output
+// after applying the named filters, along with the client that was used.
+func (r *Runner) runInstruction(instruction, inputData, contextData string, filterNames []string) (string, llm.Client, error) {
+	if r.wantsMapReduce(instruction, inputData, contextData) {
+		return r.runMapReduce(instruction, inputData, contextData, filterNames)
+	}
+
+	// Construct the final prompt(s), fitting them to the context window
+	prompts, err := r.buildPrompts(instruction, inputData, contextData)
+	if err != nil {
+		r.streams.WriteErrorToStderr("Error: %v", err)
+		return "", nil, err
+	}
+	if err := r.checkRequestCount(len(prompts)); err != nil {
+		r.streams.WriteErrorToStderr("Error: %v", err)
+		return "", nil, err
+	}
+
+	// Initialize LLM Client
 	r.LogInfo("Initializing LLM client for provider: %s", r.config.DefaultProvider)
-	llmClient, err := llm.GetClient(r.config, r.debug)
+	llmClient, err := r.newClient(r.config)
 	if err != nil {
 		r.streams.WriteErrorToStderr("Error initializing LLM client: %v", err)
-		return err
+		return "", nil, err
+	}
+
+	// Send prompt(s) to LLM and apply output filters
+	responses := make([]string, 0, len(prompts))
+	if len(prompts) > 1 {
+		r.status.SetProgress(0, len(prompts), "chunks")
+		defer r.status.SetProgress(0, 0, "")
 	}
+	for i, finalPrompt := range prompts {
+		if len(prompts) > 1 {
+			r.LogInfo("Processing chunk %d of %d", i+1, len(prompts))
+		}
+		llmResponse, err := r.generate(llmClient, finalPrompt)
+		if err != nil {
+			return "", nil, err
+		}
+		filteredResponse := llmResponse
+		for _, name := range filterNames {
+			filter, err := filters.Lookup(name)
+			if err != nil {
+				r.streams.WriteErrorToStderr("Error: %v", err)
+				return "", nil, err
+			}
+			before := len(filteredResponse)
+			filteredResponse = filter.Apply(filteredResponse)
+			if len(filteredResponse) != before {
+				r.LogInfo("Applied filter %s, output length changed from %d to %d", name, before, len(filteredResponse))
+			}
+		}
+		responses = append(responses, filteredResponse)
+		r.status.Advance()
+	}
+	return strings.Join(responses, "\n"), llmClient, nil
+}
+
+// generate sends a single prompt to the LLM with the configured timeout.
+func (r *Runner) generate(llmClient llm.Client, finalPrompt string) (string, error) {
+	return r.send(llmClient, finalPrompt, func(ctx context.Context) (llm.Response, error) {
+		return llmClient.Generate(ctx, finalPrompt)
+	})
+}
+
+// send enforces the request limits, calls request with the configured timeout,
+// or the client's own for a TimeoutClient, and records usage. finalPrompt is
+// everything the request sends, used for limits and usage estimates.
+func (r *Runner) send(llmClient llm.Client, finalPrompt string, request func(ctx context.Context) (llm.Response, error)) (string, error) {
+	llmResponse, err := r.sendRequest(llmClient, finalPrompt, request)
+	return llmResponse.Text, err
+}
 
-	// 5. Send prompt to LLM
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.config.RequestTimeoutSeconds)*time.Second)
+// sendRequest is send returning the whole response.
+func (r *Runner) sendRequest(llmClient llm.Client, finalPrompt string, request func(ctx context.Context) (llm.Response, error)) (llm.Response, error) {
+	timeout := time.Duration(r.config.RequestTimeoutSeconds) * time.Second
+	if t, ok := llmClient.(llm.TimeoutClient); ok {
+		timeout = t.RequestTimeout()
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
 	defer cancel()
+	provider := llmClient.ProviderName()
+	// Messages such as Ollama's pull progress go through the status line.
+	ctx = llm.WithProgressWriter(ctx, r.streams.Err)
+	if r.status != nil {
+		ctx = llm.WithTokenProgress(ctx, r.showStreaming(provider))
+	}
 
-	r.LogInfo("Sending request to LLM...")
-	llmResponse, err := llmClient.Generate(ctx, finalPrompt) // Assumes Generate method exists
+	reserved, err := r.beginRequest(provider, finalPrompt)
+	if err != nil {
+		return llm.Response{}, err
+	}
+	// The request itself runs unlocked, so parallel chunks overlap; its
+	// reservation is released even if the client panics.
+	defer r.endRequest(provider, reserved)
+	llmResponse, err := request(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil && errors.Is(r.ctx.Err(), context.Canceled) {
+		// The run was stopped, e.g. after another chunk failed; that error
+		// is the one to report.
+		return llm.Response{}, err
+	}
 	if err != nil {
 		r.streams.WriteErrorToStderr("Error during LLM request: %v", err)
 		// Check for context deadline exceeded specifically
 		if ctx.Err() == context.DeadlineExceeded {
-			r.streams.WriteErrorToStderr("LLM request timed out after %d seconds", r.config.RequestTimeoutSeconds)
+			r.streams.WriteErrorToStderr("LLM request timed out after %v", timeout)
 		}
-		return err
+		return llm.Response{}, err
 	}
 	r.LogInfo("Received LLM response")
+	r.recordUsage(provider, finalPrompt, llmResponse)
+	return llmResponse, nil
+}
 
-	// Apply output filters
-	// For now, we only have one filter. Later, this could be a list of filters.
-	outputFilter := &filters.MarkdownCodeBlockFilter{}
-	filteredResponse := outputFilter.Apply(llmResponse)
-	if len(filteredResponse) != len(llmResponse) {
-		r.LogInfo("Applied MarkdownCodeBlockFilter, output length changed from %d to %d", len(llmResponse), len(filteredResponse))
-	}
-
-	// 6. Write LLM response to stdout
-	err = r.streams.WriteStringToStdout(filteredResponse)
+// beginRequest checks the limits for a request to provider and counts it as
+// sent and in flight. It returns the estimated cost it reserved, which
+// endRequest releases.
+func (r *Runner) beginRequest(provider, finalPrompt string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reserved, err := r.checkRequestLimits(provider, finalPrompt)
 	if err != nil {
-		// This is tricky, stdout might be closed or broken. Log to stderr.
-		r.streams.WriteErrorToStderr("Error writing LLM response to stdout: %v", err)
-		return err // Return the error so main exits non-zero
+		r.streams.WriteErrorToStderr("Error: %v", err)
+		return 0, err
 	}
+	r.requests++
+	r.LogInfo("Sending request to LLM...")
+	r.inflight++
+	r.showWaiting(provider)
+	return reserved, nil
+}
 
-	// 7. Success
-	r.LogInfo("Done.")
-	return nil
+// endRequest undoes beginRequest's in-flight count and reservation once the
+// request is done, and recorded if it succeeded.
+func (r *Runner) endRequest(provider string, reserved float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inflight--
+	r.showWaiting(provider)
+	r.releaseSpend(provider, reserved)
 }
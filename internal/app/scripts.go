@@ -0,0 +1,72 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// applyScriptMeta switches to the provider and model named in a script's
+// front-matter.
+func (r *Runner) applyScriptMeta(meta script.Meta) error {
+	if meta.Provider == "" && meta.Model == "" {
+		return nil
+	}
+	cfg, err := ConfigWith(r.config, meta.Provider, meta.Model)
+	if err != nil {
+		return fmt.Errorf("script front-matter: %w", err)
+	}
+	r.LogInfo("Script selects provider %s, model %s", cfg.DefaultProvider, cfg.LLMs[cfg.DefaultProvider].Model)
+	r.config = cfg
+	return nil
+}
+
+// ConfigWith returns a copy of cfg using provider and model, where set. The
+// LLMs map is copied so cfg is untouched.
+func ConfigWith(cfg config.Config, provider, model string) (config.Config, error) {
+	llms := make(map[string]config.LLMConfig, len(cfg.LLMs))
+	for name, llmCfg := range cfg.LLMs {
+		llms[name] = llmCfg
+	}
+	cfg.LLMs = llms
+
+	if provider != "" {
+		if !cfg.HasProvider(provider) {
+			return config.Config{}, fmt.Errorf("provider '%s' has no configuration section in [llms]", provider)
+		}
+		cfg.DefaultProvider = provider
+	}
+	if model != "" {
+		llmCfg := cfg.LLMs[cfg.DefaultProvider]
+		llmCfg.Model = model
+		cfg.LLMs[cfg.DefaultProvider] = llmCfg
+	}
+	return cfg, nil
+}
+
+// rememberRun keeps a successful ad-hoc run so it can be saved as a script.
+// Failing to record it is not fatal to the run.
+func (r *Runner) rememberRun(llmClient llm.Client, instruction string) {
+	run := script.LastRun{
+		Time:        time.Now(),
+		Instruction: instruction,
+		Provider:    llmClient.ProviderName(),
+	}
+	if lister, ok := llmClient.(llm.ModelLister); ok {
+		run.Model = lister.ModelName()
+	} else if llmCfg, ok := r.config.GetLLMConfig(run.Provider); ok {
+		run.Model = llmCfg.Model
+	}
+	r.lastRun = &run
+	if err := script.RecordLastRun(run); err != nil {
+		r.LogInfo("Could not record last run: %v", err)
+	}
+}
+
+// LastRun returns the ad-hoc run completed by Run, or nil if there was none.
+func (r *Runner) LastRun() *script.LastRun {
+	return r.lastRun
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"io"
+	"os"
+
+	"github.com/hiway/dreampipe/internal/iohandler"
+)
+
+// startStatus shows the status line on stderr for the rest of the run, when
+// progress is enabled and stderr is a terminal. Debug mode prints its own,
+// more detailed messages instead. Messages written to stderr while the line
+// is shown go through it, so they don't garble each other.
+func (r *Runner) startStatus() {
+	if r.status != nil || !r.config.Progress || r.debug || os.Getenv("TERM") == "dumb" {
+		return
+	}
+	errFile, ok := r.streams.Err.(*os.File)
+	if !ok || !iohandler.IsTerminal(errFile) {
+		return
+	}
+	status := iohandler.NewStatusLine(errFile)
+	streams := *r.streams
+	streams.Err = status
+	status.SetPhase("Preparing the request")
+	if !isTerminalReader(streams.In) {
+		streams.In = &iohandler.CountingReader{R: streams.In, Status: status}
+		status.SetPhase("Reading input")
+	}
+	r.statusStreams = r.streams
+	r.streams = &streams
+	r.status = status
+	status.Start()
+}
+
+// stopStatus removes the status line, before the output is written, as
+// stdout and stderr are often the same terminal.
+func (r *Runner) stopStatus() {
+	if r.status == nil {
+		return
+	}
+	r.status.Stop()
+	r.streams = r.statusStreams
+	r.status, r.statusStreams = nil, nil
+}
+
+// showWaiting sets the phase to waiting for the requests in flight; r.mu
+// must be held.
+func (r *Runner) showWaiting(provider string) {
+	switch {
+	case r.inflight > 1:
+		r.status.SetPhase("Waiting for %s (%d requests)", provider, r.inflight)
+	case r.inflight == 1:
+		r.status.SetPhase("Waiting for %s", provider)
+	default:
+		r.status.SetPhase("Processing the response")
+	}
+}
+
+// showStreaming returns the callback of a streamed response, showing the
+// tokens received so far. With several requests in flight, the line keeps
+// counting them instead, as their tokens would be mixed up.
+func (r *Runner) showStreaming(provider string) func(tokens int) {
+	status := r.status
+	return func(tokens int) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.inflight == 1 {
+			status.SetPhase("Streaming from %s (%d tokens)", provider, tokens)
+		}
+	}
+}
+
+// isTerminalReader reports whether in is a terminal, where the user types
+// the input; the status line would be drawn over it.
+func isTerminalReader(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	return ok && iohandler.IsTerminal(f)
+}
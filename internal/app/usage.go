@@ -0,0 +1,65 @@
+package app
+
+import (
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/tokens"
+	"github.com/hiway/dreampipe/internal/usage"
+)
+
+// recordUsage reports the token usage of a request in debug mode and appends it
+// to the usage ledger if enabled. Providers that report no usage get estimates.
+// Failing to record usage is not fatal to the run.
+func (r *Runner) recordUsage(provider, finalPrompt string, resp llm.Response) {
+	u := resp.Usage
+	estimated := u.IsZero()
+	if estimated {
+		u.PromptTokens = tokens.Estimate(finalPrompt)
+		u.CompletionTokens = tokens.Estimate(resp.Text)
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+		r.LogInfo("Token usage (estimated): prompt %d, response %d, total %d", u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	} else {
+		r.LogInfo("Token usage: prompt %d, response %d, total %d", u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	}
+
+	if !r.config.RecordUsage {
+		return
+	}
+
+	model := resp.Model
+	if model == "" {
+		llmCfg, _ := r.config.GetLLMConfig(provider)
+		model = llmCfg.Model
+	}
+	cost, known := usage.Cost(r.providerType(provider), model, u.PromptTokens, u.CompletionTokens, r.config.Prices)
+	if !known {
+		r.LogInfo("No price known for model '%s', recording zero cost", model)
+	}
+
+	ledgerPath, err := usage.DefaultLedgerPath()
+	if err != nil {
+		r.LogInfo("Could not determine usage ledger path: %v", err)
+		return
+	}
+	rec := usage.Record{
+		Time:             time.Now(),
+		Provider:         provider,
+		Model:            model,
+		Script:           r.script,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		Estimated:        estimated,
+		CostUSD:          cost,
+	}
+	if err := usage.NewLedger(ledgerPath).Append(rec); err != nil {
+		r.streams.WriteErrorToStderr("Warning: could not record usage: %v", err)
+	}
+}
+
+// providerType returns the provider an [llms] entry uses, which decides its
+// prices: entries are named freely, e.g. a second Ollama server.
+func (r *Runner) providerType(provider string) string {
+	return llm.ProviderType(provider, r.config.LLMs[provider])
+}
@@ -3,12 +3,15 @@ package config
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
@@ -22,20 +25,96 @@ const (
 	DefaultFilePerm = 0600 // rw------- (Contains potential secrets) // EXPORTED
 )
 
+// Strategies for handling prompts that exceed the model's context window.
+const (
+	ContextOverflowWarn      = "warn"       // Send the prompt anyway and print a warning
+	ContextOverflowTruncate  = "truncate"   // Cut the input to fit, leaving a marker
+	ContextOverflowChunk     = "chunk"      // Split the input and process each chunk separately
+	ContextOverflowError     = "error"      // Refuse to send the prompt
+	ContextOverflowMapReduce = "map_reduce" // Apply the instruction to each chunk, then combine the results
+)
+
 // Config holds the application's configuration.
 type Config struct {
-	DefaultProvider       string               `toml:"default_provider"`
-	RequestTimeoutSeconds int                  `toml:"request_timeout_seconds"`
-	LLMs                  map[string]LLMConfig `toml:"llms"`
+	DefaultProvider       string                `toml:"default_provider"`
+	RequestTimeoutSeconds int                   `toml:"request_timeout_seconds"`
+	ContextOverflow       string                `toml:"context_overflow"`       // One of the ContextOverflow* strategies
+	RecordUsage           bool                  `toml:"record_usage"`           // Append token usage of each request to the usage ledger
+	Progress              bool                  `toml:"progress"`               // Show a status line on stderr while running, when it is a terminal
+	ScriptsDir            string                `toml:"scripts_dir"`            // Where `dreampipe save` writes scripts, ideally on $PATH
+	ScriptPaths           []string              `toml:"script_paths,omitempty"` // Extra directories `dreampipe run` looks for scripts in
+	Limits                Limits                `toml:"limits"`
+	Redaction             RedactionConfig       `toml:"redaction"`
+	LLMs                  map[string]LLMConfig  `toml:"llms"`
+	Prices                map[string]ModelPrice `toml:"prices,omitempty"` // Per-model prices, overriding the built-in table
+
+	// providerTables holds the [llms] tables as decoded, including the
+	// settings of plugin providers that LLMConfig has no fields for.
+	providerTables map[string]map[string]interface{}
+}
+
+// Limits are hard caps enforced before a request is sent to the LLM.
+// Zero values mean no limit.
+type Limits struct {
+	MaxInputBytes       int64              `toml:"max_input_bytes,omitzero"`        // Maximum size of stdin
+	MaxTokensPerRequest int                `toml:"max_tokens_per_request,omitzero"` // Maximum estimated prompt tokens per request
+	MaxRequestsPerRun   int                `toml:"max_requests_per_run,omitzero"`   // Maximum LLM requests in one invocation
+	DailySpendUSD       map[string]float64 `toml:"daily_spend_usd,omitempty"`       // Maximum spend per provider per day, requires record_usage
+}
+
+// RedactionConfig controls replacing secrets and personal information in the
+// input with placeholders before it is sent to a provider.
+type RedactionConfig struct {
+	Enabled      bool            `toml:"enabled,omitzero"`        // Default for providers without their own redact setting
+	Restore      bool            `toml:"restore,omitzero"`        // Put the original values back into the LLM output
+	DisableRules []string        `toml:"disable_rules,omitempty"` // Names of built-in rules to turn off
+	Rules        []RedactionRule `toml:"rules,omitempty"`         // Additional rules
+}
+
+// RedactionRule is a custom redaction rule; matches of Pattern (a Go regular
+// expression) are replaced with placeholders named after Name.
+type RedactionRule struct {
+	Name    string `toml:"name"`
+	Pattern string `toml:"pattern"`
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens.
+type ModelPrice struct {
+	InputPerMillion  float64 `toml:"input_per_million"`
+	OutputPerMillion float64 `toml:"output_per_million"`
 }
 
 // LLMConfig holds configuration specific to an LLM provider.
 // Use pointers to distinguish between unset and explicitly empty values if needed,
 // but simple strings are often sufficient for TOML loading.
 type LLMConfig struct {
+	// Type is the registered provider the entry uses, when it differs from
+	// the entry's name, e.g. a second Ollama server.
+	Type string `toml:"type,omitempty"`
+	// Plugin is the program of an exec plugin provider, by default
+	// dreampipe-provider-<type> on the PATH.
+	Plugin  string `toml:"plugin,omitempty"`
 	BaseURL string `toml:"base_url,omitempty"` // Used by Ollama
 	APIKey  string `toml:"api_key,omitempty"`  // Used by Gemini, Groq, etc.
 	Model   string `toml:"model,omitempty"`    // Optional model override per provider
+	// Alternatives to storing the API key in this file; see ResolveAPIKey.
+	APIKeyCmd  string `toml:"api_key_cmd,omitempty"`  // Command printing the key, e.g. "pass show groq"
+	APIKeyEnv  string `toml:"api_key_env,omitempty"`  // Name of an environment variable holding the key
+	APIKeyFile string `toml:"api_key_file,omitempty"` // Path to a file holding the key
+	// Redact forces redaction on or off for this provider, overriding [redaction] enabled.
+	Redact *bool `toml:"redact,omitempty"`
+	// ContextWindow is the model's context size in tokens.
+	// Zero means use the built-in size for known models.
+	ContextWindow int `toml:"context_window,omitzero"`
+	// AutoPull pulls a missing model and retries the request (Ollama only).
+	AutoPull bool `toml:"auto_pull,omitempty"`
+	// KeepAlive is how long the model stays loaded after a request, as a
+	// duration such as "30m" or seconds; negative keeps it loaded (Ollama only).
+	KeepAlive string `toml:"keep_alive,omitempty"`
+
+	// The command provider runs a local program for each request.
+	Command []string `toml:"command,omitempty"` // Program and arguments; {prompt} passes the prompt as an argument (command only)
+	Timeout string   `toml:"timeout,omitempty"` // Limit for each run, e.g. "5m"; default request_timeout_seconds (command only)
 }
 
 // Default configuration values.
@@ -43,6 +122,10 @@ func defaultConfig() Config {
 	return Config{
 		DefaultProvider:       "ollama", // Default to Ollama
 		RequestTimeoutSeconds: 60,       // 60-second timeout for LLM requests
+		ContextOverflow:       ContextOverflowWarn,
+		RecordUsage:           true,
+		Progress:              true,
+		ScriptsDir:            "~/.local/bin",
 		LLMs: map[string]LLMConfig{
 			"ollama": {
 				BaseURL: "http://localhost:11434", // Default Ollama URL
@@ -73,63 +156,33 @@ func GetConfigFilePath() (string, error) { // EXPORTED and RENAMED
 	return filepath.Join(configHome, appName, configFileName), nil
 }
 
-// Load reads the configuration file, creates it interactively if missing,
-// merges with defaults, and returns the final Config.
+// Load reads the layered configuration, creates the user configuration file
+// interactively if nothing is configured, and returns the final Config.
 func Load(debugMode bool) (Config, error) { // MODIFIED: Added debugMode
-	cfgPath, err := GetConfigFilePath()
-	if err != nil {
-		return Config{}, fmt.Errorf("failed to determine config path: %w", err)
-	}
-
-	// Start with default config
-	cfg := defaultConfig()
+	return LoadWithFlags(debugMode, Flags{})
+}
 
-	_, err = os.Stat(cfgPath)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			// Config file doesn't exist, ask to create
-			if debugMode {
-				fmt.Printf("Configuration file not found at %s\n", cfgPath)
-			}
-			if askToCreateConfigFile() {
-				err = createConfigFileInteractive(cfgPath, &cfg, debugMode) // MODIFIED: Pass debugMode
-				if err != nil {
-					return Config{}, fmt.Errorf("failed to create configuration file: %w", err)
-				}
-				// File created, proceed to load (or just use the interactively filled cfg)
-				if debugMode {
-					fmt.Printf("Configuration file created successfully at %s\n", cfgPath)
-				}
-				// No need to reload here, createConfigFileInteractive populates cfg
-			} else {
-				return Config{}, fmt.Errorf("configuration file creation declined by user.\n\nTo create a configuration file later, run:\n  dreampipe config\n\nFor more help, visit: https://github.com/hiway/dreampipe#configuration")
-			}
-		} else {
-			// Other error accessing the file (e.g., permissions)
-			return Config{}, fmt.Errorf("failed to access config file %s: %w", cfgPath, err)
-		}
-	} else {
-		// File exists, load it and merge over defaults
-		if debugMode {
-			fmt.Printf("Loading configuration from %s\n", cfgPath) // MODIFIED: Conditional print
-		}
-		meta, err := toml.DecodeFile(cfgPath, &cfg)
-		if err != nil {
-			return Config{}, fmt.Errorf("failed to decode TOML config file %s: %w", cfgPath, err)
+// validate checks settings that cannot be expressed by the TOML types alone.
+func (c *Config) validate() error {
+	if !c.HasProvider(c.DefaultProvider) {
+		return fmt.Errorf("default provider '%s' is specified but has no configuration section in [llms]", c.DefaultProvider)
+	}
+	switch c.ContextOverflow {
+	case ContextOverflowWarn, ContextOverflowTruncate, ContextOverflowChunk, ContextOverflowError, ContextOverflowMapReduce:
+	default:
+		return fmt.Errorf("invalid context_overflow '%s': must be one of %s, %s, %s, %s or %s",
+			c.ContextOverflow, ContextOverflowWarn, ContextOverflowTruncate, ContextOverflowChunk, ContextOverflowMapReduce, ContextOverflowError)
+	}
+	for _, rule := range c.Redaction.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("redaction rule with pattern '%s' has no name", rule.Pattern)
 		}
-		// Optional: Check for undecoded keys if strictness is desired
-		if len(meta.Undecoded()) > 0 {
-			fmt.Fprintf(os.Stderr, "Warning: Unknown configuration keys found in %s: %v\n", cfgPath, meta.Undecoded())
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for redaction rule '%s': %w", rule.Name, err)
 		}
 	}
-
-	// Final validation (e.g., ensure default provider is configured)
-	if _, exists := cfg.LLMs[cfg.DefaultProvider]; !exists {
-		return Config{}, fmt.Errorf("default provider '%s' is specified but has no configuration section in [llms]", cfg.DefaultProvider)
-	}
 	// Add more validation as needed
-
-	return cfg, nil
+	return nil
 }
 
 // askToCreateConfigFile prompts the user if they want to create the config file.
@@ -234,35 +287,100 @@ func createConfigFileInteractive(cfgPath string, cfg *Config, debugMode bool) er
 		fmt.Printf("✅ Using default provider: %s\n", cfg.DefaultProvider)
 	}
 
-	// --- Create Directory ---
+	// --- Write File ---
+	if err := Save(cfgPath, *cfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✅ Configuration file created successfully at %s\n", cfgPath)
+	fmt.Printf("You can now use dreampipe! Try:\n")
+	fmt.Printf("  echo 'Hello' | dreampipe 'translate to pirate speak'\n")
+	fmt.Printf("  df -h | dreampipe 'write a haiku about storage'\n")
+	fmt.Printf("\nTo edit configuration later, run: dreampipe config\n")
+
+	return nil // Success
+}
+
+// Save writes cfg to cfgPath as TOML, creating the directory if needed.
+// The file is only readable by the user as it may contain API keys.
+// Settings equal to the built-in defaults are left out, so that the file
+// doesn't override them in the system configuration.
+func Save(cfgPath string, cfg Config) error {
+	values, err := withoutDefaults(cfg)
+	if err != nil {
+		return err
+	}
+
 	configDir := filepath.Dir(cfgPath)
-	err := os.MkdirAll(configDir, DefaultDirPerm)
+	err = os.MkdirAll(configDir, DefaultDirPerm)
 	if err != nil {
 		return fmt.Errorf("failed to create config directory %s: %w", configDir, err)
 	}
 
-	// --- Write File ---
 	file, err := os.OpenFile(cfgPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, DefaultFilePerm)
 	if err != nil {
 		return fmt.Errorf("failed to create config file %s: %w", cfgPath, err)
 	}
 	defer file.Close()
 
-	encoder := toml.NewEncoder(file)
-	// Optional: Indent nested tables for better readability
-	// encoder.Indent = "  " // Uncomment if desired
-
-	if err := encoder.Encode(cfg); err != nil {
+	if err := toml.NewEncoder(file).Encode(values); err != nil {
 		return fmt.Errorf("failed to encode configuration to TOML: %w", err)
 	}
+	return nil
+}
+
+// withoutDefaults returns cfg as a table without the settings equal to the
+// built-in defaults. default_provider and the [llms] entries are what a
+// saved file is for, so they are always kept.
+func withoutDefaults(cfg Config) (map[string]interface{}, error) {
+	values, err := toTable(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := toTable(defaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	llms := values["llms"]
+	delete(values, "default_provider")
+	delete(values, "llms")
+	pruneDefaults(values, defaults)
+	values["default_provider"] = cfg.DefaultProvider
+	if llms != nil {
+		values["llms"] = llms
+	}
+	return values, nil
+}
 
-	fmt.Printf("\n✅ Configuration file created successfully at %s\n", cfgPath)
-	fmt.Printf("You can now use dreampipe! Try:\n")
-	fmt.Printf("  echo 'Hello' | dreampipe 'translate to pirate speak'\n")
-	fmt.Printf("  df -h | dreampipe 'write a haiku about storage'\n")
-	fmt.Printf("\nTo edit configuration later, run: dreampipe config\n")
+// pruneDefaults removes the keys of values that equal those of defaults, and
+// the tables left empty.
+func pruneDefaults(values, defaults map[string]interface{}) {
+	for key, value := range values {
+		if table, ok := value.(map[string]interface{}); ok {
+			defaultTable, _ := defaults[key].(map[string]interface{})
+			pruneDefaults(table, defaultTable)
+			if len(table) == 0 {
+				delete(values, key)
+			}
+			continue
+		}
+		if reflect.DeepEqual(value, defaults[key]) {
+			delete(values, key)
+		}
+	}
+}
 
-	return nil // Success
+// toTable returns cfg as a generic TOML table.
+func toTable(cfg Config) (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration to TOML: %w", err)
+	}
+	table := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &table); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	return table, nil
 }
 
 // validateOllamaURL attempts to connect to the Ollama base URL.
@@ -314,8 +432,103 @@ func validateOllamaURL(rawURL string, debugMode bool) error { // MODIFIED: Added
 	return nil
 }
 
+// RedactionEnabled reports whether input sent to provider must be redacted.
+// A provider's own redact setting takes precedence over [redaction] enabled.
+func (c *Config) RedactionEnabled(provider string) bool {
+	if llmCfg, exists := c.LLMs[provider]; exists && llmCfg.Redact != nil {
+		return *llmCfg.Redact
+	}
+	return c.Redaction.Enabled
+}
+
+// ProviderSettings returns the settings of the named [llms] entry as a
+// generic table: the keys of its LLMConfig, including overrides such as
+// --model, over every key the configuration files set for it.
+func (c Config) ProviderSettings(name string) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for key, value := range c.providerTables[name] {
+		settings[key] = value
+	}
+	llmCfg, exists := c.LLMs[name]
+	if !exists {
+		return settings
+	}
+	var buf bytes.Buffer
+	known := map[string]interface{}{}
+	if err := toml.NewEncoder(&buf).Encode(llmCfg); err == nil {
+		toml.Decode(buf.String(), &known)
+	}
+	for key, value := range known {
+		settings[key] = value
+	}
+	return settings
+}
+
+// SetProviderSettings sets the [llms] entry name to settings, as if they had
+// been read from a file: they fill in the entry's LLMConfig, and
+// ProviderSettings returns all of them, including those of plugins.
+func (c *Config) SetProviderSettings(name string, settings map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(settings); err != nil {
+		return fmt.Errorf("invalid settings for %s: %w", name, err)
+	}
+	var llmCfg LLMConfig
+	if _, err := toml.Decode(buf.String(), &llmCfg); err != nil {
+		return fmt.Errorf("invalid settings for %s: %w", name, err)
+	}
+	if c.LLMs == nil {
+		c.LLMs = map[string]LLMConfig{}
+	}
+	if c.providerTables == nil {
+		c.providerTables = map[string]map[string]interface{}{}
+	}
+	c.LLMs[name] = llmCfg
+	c.providerTables[name] = settings
+	return nil
+}
+
+// setProviderTables keeps the [llms] tables of the decoded values for
+// ProviderSettings.
+func (c *Config) setProviderTables(values map[string]interface{}) {
+	llms, _ := values["llms"].(map[string]interface{})
+	c.providerTables = make(map[string]map[string]interface{}, len(llms))
+	for name, v := range llms {
+		if table, ok := v.(map[string]interface{}); ok {
+			c.providerTables[name] = table
+		}
+	}
+}
+
+// PluginPath returns plugin with a leading "~/" expanded.
+func (c LLMConfig) PluginPath() string {
+	return ExpandHome(c.Plugin)
+}
+
+// ScriptsDirPath returns scripts_dir with a leading "~/" expanded.
+func (c *Config) ScriptsDirPath() string {
+	return ExpandHome(c.ScriptsDir)
+}
+
+// ScriptSearchPaths returns the directories `dreampipe run` searches after the
+// script library: script_paths in order, then scripts_dir, with "~/" expanded.
+func (c *Config) ScriptSearchPaths() []string {
+	var paths []string
+	for _, path := range c.ScriptPaths {
+		paths = append(paths, ExpandHome(path))
+	}
+	return append(paths, c.ScriptsDirPath())
+}
+
 // GetLLMConfig retrieves the specific configuration for a given provider.
 func (c *Config) GetLLMConfig(provider string) (LLMConfig, bool) {
 	llmCfg, exists := c.LLMs[provider]
 	return llmCfg, exists
 }
+
+// HasProvider reports whether requests can be sent to provider: it has an
+// [llms] entry, or is a registered provider, which works without one from
+// its defaults, e.g. DREAMPIPE_DEFAULT_PROVIDER=mock without a config file.
+func (c *Config) HasProvider(provider string) bool {
+	_, exists := c.LLMs[provider]
+	return exists || isKnownProvider(provider)
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/hiway/dreampipe/internal/iohandler"
+)
+
+// InitOptions describes a provider to configure without prompting.
+type InitOptions struct {
+	Provider   string   // A registered provider type, e.g. ollama or groq
+	BaseURL    string   // Ollama server URL, defaults to http://localhost:11434
+	Command    []string // Program and arguments of the command provider
+	Model      string   // Optional model override
+	APIKey     string
+	APIKeyCmd  string
+	APIKeyEnv  string
+	APIKeyFile string
+	Force      bool // Overwrite an existing configuration file
+}
+
+// Init writes a configuration file at cfgPath with the single provider
+// described by opts as the default, without reading from stdin.
+func Init(cfgPath string, opts InitOptions) (Config, error) {
+	if !isKnownProvider(opts.Provider) {
+		return Config{}, fmt.Errorf("unknown provider %q (available: %s)", opts.Provider, strings.Join(providerTypes(), ", "))
+	}
+	if _, err := os.Stat(cfgPath); err == nil && !opts.Force {
+		return Config{}, fmt.Errorf("configuration file already exists at %s (use --force to overwrite)", cfgPath)
+	}
+
+	llmCfg := LLMConfig{
+		Model:      opts.Model,
+		APIKey:     opts.APIKey,
+		APIKeyCmd:  opts.APIKeyCmd,
+		APIKeyEnv:  opts.APIKeyEnv,
+		APIKeyFile: opts.APIKeyFile,
+	}
+	if opts.BaseURL != "" && opts.Provider != "ollama" {
+		return Config{}, fmt.Errorf("--base-url is only supported for ollama")
+	}
+	if len(opts.Command) > 0 && opts.Provider != "command" {
+		return Config{}, fmt.Errorf("--command is only supported for command")
+	}
+	switch opts.Provider {
+	case "ollama":
+		llmCfg.BaseURL = opts.BaseURL
+		if llmCfg.BaseURL == "" {
+			llmCfg.BaseURL = defaultConfig().LLMs["ollama"].BaseURL
+		}
+	case "command":
+		if len(opts.Command) == 0 {
+			return Config{}, fmt.Errorf("provider command requires --command")
+		}
+		llmCfg.Command = opts.Command
+	case "mock":
+		// The mock provider needs no key.
+	default:
+		if !llmCfg.HasAPIKeySource() {
+			return Config{}, fmt.Errorf("provider %s requires one of --api-key, --api-key-cmd, --api-key-env or --api-key-file", opts.Provider)
+		}
+	}
+	// Reject conflicting key sources now rather than on first use.
+	if _, _, err := llmCfg.ResolveAPIKey(); errors.Is(err, ErrMultipleKeySources) {
+		return Config{}, err
+	}
+
+	cfg := defaultConfig()
+	cfg.DefaultProvider = opts.Provider
+	cfg.LLMs = map[string]LLMConfig{opts.Provider: llmCfg}
+	if err := Save(cfgPath, cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// InitInteractive creates the configuration file at cfgPath by prompting on
+// the terminal, as Load does when no configuration exists.
+func InitInteractive(cfgPath string, debugMode bool) (Config, error) {
+	if !iohandler.IsTerminal(os.Stdin) {
+		return Config{}, errors.New("stdin is not a terminal; use --non-interactive with --provider")
+	}
+	cfg := defaultConfig()
+	if err := createConfigFileInteractive(cfgPath, &cfg, debugMode); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadFile reads and validates the configuration file at cfgPath without
+// creating it or prompting.
+func LoadFile(cfgPath string) (Config, error) {
+	cfg := defaultConfig()
+	if _, err := toml.DecodeFile(cfgPath, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to decode config file %s: %w", cfgPath, err)
+	}
+	values := map[string]interface{}{}
+	if _, err := toml.DecodeFile(cfgPath, &values); err != nil {
+		return Config{}, fmt.Errorf("failed to decode config file %s: %w", cfgPath, err)
+	}
+	cfg.setProviderTables(values)
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Default returns the built-in configuration that files are merged over.
+func Default() Config {
+	return defaultConfig()
+}
+
+// Masked returns a copy of the configuration with the settings that may hold
+// secrets, see isSecretSetting, replaced by a masked form, safe to print or
+// share.
+func (c Config) Masked() Config {
+	llms := make(map[string]LLMConfig, len(c.LLMs))
+	for name, llmCfg := range c.LLMs {
+		llmCfg.APIKey = MaskSecret(llmCfg.APIKey)
+		llmCfg.APIKeyCmd = MaskSecret(llmCfg.APIKeyCmd)
+		if llmCfg.Command != nil {
+			llmCfg.Command = maskStrings(llmCfg.Command)
+		}
+		llms[name] = llmCfg
+	}
+	c.LLMs = llms
+	return c
+}
+
+// Masked returns a copy of the origin with its value masked when the key may
+// hold a secret, see isSecretSetting.
+func (o Origin) Masked() Origin {
+	parts := strings.Split(o.Key, ".")
+	if len(parts) > 2 && parts[0] == "llms" && isSecretSetting(parts[2]) {
+		o.Value = maskValue(o.Value)
+	}
+	return o
+}
+
+// isSecretSetting reports whether the key of an [llms] entry may hold a
+// secret: the API key and key command, the arguments of the command
+// provider, which may carry a token, and the settings of plugins and other
+// providers, which only they know.
+func isSecretSetting(key string) bool {
+	switch key {
+	case "api_key", "api_key_cmd", "command":
+		return true
+	}
+	return !slices.Contains(llmConfigKeys(), key)
+}
+
+// llmConfigKeys returns the keys of LLMConfig.
+func llmConfigKeys() []string {
+	t := reflect.TypeOf(LLMConfig{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]; key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// maskValue masks the strings of a decoded TOML value, keeping its shape.
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return MaskSecret(v)
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(item)
+		}
+		return masked
+	case []string:
+		return maskStrings(v)
+	}
+	return value
+}
+
+// maskStrings masks every string of values.
+func maskStrings(values []string) []string {
+	masked := make([]string, len(values))
+	for i, s := range values {
+		masked[i] = MaskSecret(s)
+	}
+	return masked
+}
+
+// MaskSecret hides all but the first and last few characters of a secret.
+// Short secrets are hidden completely.
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 12 {
+		return "****"
+	}
+	return secret[:4] + "****" + secret[len(secret)-4:]
+}
+
+// SetDefaultModel makes provider the default and sets its model in the
+// configuration file at cfgPath. The file is edited line by line, keeping its
+// comments and layout; if that doesn't give the intended values, e.g. because
+// the keys are in an inline table, the file is left alone and an error says
+// what to set.
+func SetDefaultModel(cfgPath, provider, model string) error {
+	content, err := os.ReadFile(cfgPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file %s: %w", cfgPath, err)
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+	lines = setTOMLString(lines, "", "default_provider", provider)
+	lines = setTOMLString(lines, "llms."+provider, "model", model)
+	updated := strings.Join(lines, "\n") + "\n"
+
+	var values struct {
+		DefaultProvider string `toml:"default_provider"`
+		LLMs            map[string]struct {
+			Model string `toml:"model"`
+		} `toml:"llms"`
+	}
+	if _, err := toml.Decode(updated, &values); err != nil || values.DefaultProvider != provider || values.LLMs[provider].Model != model {
+		return fmt.Errorf("could not update %s in place; set default_provider = %q, and model = %q under [llms.%s], yourself", cfgPath, provider, model, provider)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), DefaultDirPerm); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return os.WriteFile(cfgPath, []byte(updated), DefaultFilePerm)
+}
+
+// setTOMLString sets key to a string value in table, "" for the top level, of
+// the lines of a TOML document. An existing key keeps its indentation and
+// comment; a new one goes at the start of the table, which is appended if
+// it's missing. Only [table] headers are recognized, not dotted keys or
+// inline tables, so callers check the result.
+func setTOMLString(lines []string, table, key, value string) []string {
+	assignment := key + " = " + strconv.Quote(value)
+	current := ""
+	insertAt := -1
+	if table == "" {
+		insertAt = firstTableLine(lines)
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			current = tableName(trimmed)
+			if current == table {
+				insertAt = i + 1
+			}
+			continue
+		}
+		if current != table {
+			continue
+		}
+		k, rest, ok := strings.Cut(trimmed, "=")
+		if !ok || strings.Trim(strings.TrimSpace(k), `"'`) != key {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + assignment + afterValue(rest)
+		return lines
+	}
+
+	if insertAt < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		return append(lines, "["+table+"]", assignment)
+	}
+	added := []string{assignment}
+	if table == "" && insertAt < len(lines) {
+		added = append(added, "")
+	}
+	return append(lines[:insertAt], append(added, lines[insertAt:]...)...)
+}
+
+// firstTableLine returns where top-level keys can be added: before the first
+// table header and the comments directly above it.
+func firstTableLine(lines []string) int {
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			for i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), "#") {
+				i--
+			}
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// tableName returns the dotted name of a [table] header line, without
+// quotes or spaces; array tables keep their brackets so they never match.
+func tableName(header string) string {
+	if strings.HasPrefix(header, "[[") {
+		return header
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(header, "["), "]")
+	return strings.NewReplacer(" ", "", "\t", "", `"`, "", "'", "").Replace(name)
+}
+
+// afterValue returns what follows the value in rest, the part of a key line
+// after "=": the spacing and comment, if any.
+func afterValue(rest string) string {
+	value := strings.TrimLeft(rest, " \t")
+	end := len(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+			} else if value[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	case strings.HasPrefix(value, "'"):
+		if i := strings.Index(value[1:], "'"); i >= 0 {
+			end = i + 2
+		}
+	default:
+		if i := strings.Index(value, "#"); i >= 0 {
+			end = i
+		}
+		end = len(strings.TrimRight(value[:end], " \t"))
+	}
+	return value[end:]
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    InitOptions
+		wantErr bool
+	}{
+		{name: "Ollama with default URL", opts: InitOptions{Provider: "ollama"}},
+		{name: "Groq with key env", opts: InitOptions{Provider: "groq", APIKeyEnv: "GROQ_API_KEY"}},
+		{name: "Mock without key", opts: InitOptions{Provider: "mock"}},
+		{name: "Command", opts: InitOptions{Provider: "command", Command: []string{"llm", "-m", "{model}"}}},
+		{name: "Command without program", opts: InitOptions{Provider: "command"}, wantErr: true},
+		{name: "Command for another provider", opts: InitOptions{Provider: "groq", APIKey: "gsk_x", Command: []string{"llm"}}, wantErr: true},
+		{name: "Unknown provider", opts: InitOptions{Provider: "openai"}, wantErr: true},
+		{name: "Missing key", opts: InitOptions{Provider: "gemini"}, wantErr: true},
+		{name: "Several key sources", opts: InitOptions{Provider: "groq", APIKey: "gsk_x", APIKeyEnv: "GROQ_API_KEY"}, wantErr: true},
+		{name: "Base URL for hosted provider", opts: InitOptions{Provider: "groq", APIKey: "gsk_x", BaseURL: "http://x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgPath := filepath.Join(t.TempDir(), "dreampipe", "config.toml")
+			_, err := Init(cfgPath, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cfg, err := LoadFile(cfgPath)
+			if err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if cfg.DefaultProvider != tt.opts.Provider {
+				t.Errorf("DefaultProvider = %q, want %q", cfg.DefaultProvider, tt.opts.Provider)
+			}
+			if _, err := Init(cfgPath, tt.opts); err == nil {
+				t.Errorf("Init() overwrote an existing file without Force")
+			}
+			tt.opts.Force = true
+			if _, err := Init(cfgPath, tt.opts); err != nil {
+				t.Errorf("Init() with Force error = %v", err)
+			}
+		})
+	}
+}
+
+func TestInit_KeepsSystemSettings(t *testing.T) {
+	root := t.TempDir()
+	systemPath := filepath.Join(root, "etc", "config.toml")
+	writeFile(t, systemPath, "[redaction]\nenabled = true\n")
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = systemPath
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home"))
+
+	if _, err := Init(filepath.Join(root, "home", "dreampipe", "config.toml"), InitOptions{Provider: "ollama"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	cfg, origins, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	if !cfg.Redaction.Enabled {
+		t.Errorf("redaction.enabled = false, want the system configuration's true kept")
+	}
+	for _, o := range origins {
+		if o.Key == "default_provider" && o.Source != "user "+filepath.Join(root, "home", "dreampipe", "config.toml") {
+			t.Errorf("origin of default_provider = %q, want the user file", o.Source)
+		}
+	}
+}
+
+func TestConfig_Masked(t *testing.T) {
+	cfg := Config{LLMs: map[string]LLMConfig{
+		"groq":   {APIKey: "gsk_0123456789abcdef"},
+		"gemini": {APIKey: "short"},
+		"ollama": {BaseURL: "http://localhost:11434"},
+	}}
+
+	masked := cfg.Masked()
+	if got := masked.LLMs["groq"].APIKey; got != "gsk_****cdef" {
+		t.Errorf("groq key = %q, want %q", got, "gsk_****cdef")
+	}
+	if got := masked.LLMs["gemini"].APIKey; got != "****" {
+		t.Errorf("gemini key = %q, want %q", got, "****")
+	}
+	if got := masked.LLMs["ollama"].APIKey; got != "" {
+		t.Errorf("ollama key = %q, want empty", got)
+	}
+	if cfg.LLMs["groq"].APIKey != "gsk_0123456789abcdef" {
+		t.Errorf("Masked() modified the original configuration")
+	}
+}
+
+func TestConfig_Masked_Commands(t *testing.T) {
+	cfg := Config{LLMs: map[string]LLMConfig{
+		"groq":  {APIKeyCmd: "vault read -field=key secret/groq-token"},
+		"local": {Type: "command", Command: []string{"wrapper", "--token=abcdef0123456789"}},
+	}}
+
+	masked := cfg.Masked()
+	if got := masked.LLMs["groq"].APIKeyCmd; got != "vaul****oken" {
+		t.Errorf("groq api_key_cmd = %q, want it masked", got)
+	}
+	if got := masked.LLMs["local"].Command; len(got) != 2 || got[1] != "--to****6789" {
+		t.Errorf("local command = %q, want its arguments masked", got)
+	}
+}
+
+func TestOrigin_Masked(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin Origin
+		want   interface{}
+	}{
+		{name: "API key", origin: Origin{Key: "llms.groq.api_key", Value: "gsk_0123456789abcdef"}, want: "gsk_****cdef"},
+		{name: "Plugin setting", origin: Origin{Key: "llms.acme.token", Value: "tok_0123456789abcdef"}, want: "tok_****cdef"},
+		{name: "Command arguments", origin: Origin{Key: "llms.local.command", Value: []interface{}{"wrapper", "--token=abcdef0123456789"}}, want: []interface{}{"****", "--to****6789"}},
+		{name: "Model", origin: Origin{Key: "llms.groq.model", Value: "llama3-8b-8192"}, want: "llama3-8b-8192"},
+		{name: "Top level", origin: Origin{Key: "default_provider", Value: "groq"}, want: "groq"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.origin.Masked().Value; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Masked().Value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDefaultModel(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "dreampipe", "config.toml")
+	if _, err := Init(cfgPath, InitOptions{Provider: "groq", APIKeyEnv: "GROQ_API_KEY"}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	if err := SetDefaultModel(cfgPath, "ollama", "phi3:mini"); err != nil {
+		t.Fatalf("SetDefaultModel() error = %v", err)
+	}
+	cfg, err := LoadFile(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.DefaultProvider != "ollama" || cfg.LLMs["ollama"].Model != "phi3:mini" {
+		t.Errorf("default = %s/%s, want ollama/phi3:mini", cfg.DefaultProvider, cfg.LLMs["ollama"].Model)
+	}
+	if cfg.LLMs["groq"].APIKeyEnv != "GROQ_API_KEY" {
+		t.Errorf("groq api_key_env = %q, want it kept", cfg.LLMs["groq"].APIKeyEnv)
+	}
+}
+
+func TestSetDefaultModel_KeepsLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Existing keys",
+			content: `# My configuration
+default_provider = "groq" # fast
+
+# Local models
+[llms.ollama]
+  base_url = "http://localhost:11434"
+  model = 'llama3' # small
+`,
+			want: `# My configuration
+default_provider = "ollama" # fast
+
+# Local models
+[llms.ollama]
+  base_url = "http://localhost:11434"
+  model = "phi3:mini" # small
+`,
+		},
+		{
+			name: "Missing keys",
+			content: `# Keys come from the environment
+[llms.groq]
+api_key_env = "GROQ_API_KEY"
+`,
+			want: `default_provider = "ollama"
+
+# Keys come from the environment
+[llms.groq]
+api_key_env = "GROQ_API_KEY"
+
+[llms.ollama]
+model = "phi3:mini"
+`,
+		},
+		{
+			name:    "Inline table",
+			content: "llms = { ollama = { model = \"llama3\" } }\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgPath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgPath, []byte(tt.content), DefaultFilePerm); err != nil {
+				t.Fatal(err)
+			}
+			err := SetDefaultModel(cfgPath, "ollama", "phi3:mini")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetDefaultModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := tt.want
+			if tt.wantErr {
+				want = tt.content
+			}
+			if got, _ := os.ReadFile(cfgPath); string(got) != want {
+				t.Errorf("config.toml =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/hiway/dreampipe/internal/iohandler"
+)
+
+// SystemConfigPath is the machine-wide configuration, the lowest file layer.
+var SystemConfigPath = "/etc/dreampipe/config.toml"
+
+// ProjectConfigFileName is looked up from the current directory upwards, so a
+// repository can share defaults with everyone working in it.
+const ProjectConfigFileName = ".dreampipe.toml"
+
+// envPrefix starts every environment variable that overrides a configuration key.
+const envPrefix = "DREAMPIPE_"
+
+// ErrNoConfig is returned when no configuration file or environment variable was found.
+var ErrNoConfig = errors.New("no configuration found")
+
+// projectKeys and projectProviderKeys are the only keys a project
+// configuration may set, at the top level and in [llms] entries. A cloned
+// repository is not trusted: it must not be able to run commands, send the
+// input to another host, choose which personal key is read, turn redaction
+// off or raise limits, so it can only pick among the providers and models.
+var (
+	projectKeys         = []string{"default_provider", "context_overflow", "request_timeout_seconds", "progress", "llms"}
+	projectProviderKeys = []string{"model", "context_window", "keep_alive"}
+)
+
+// Flags are command line settings, the last and highest-priority layer.
+type Flags struct {
+	Provider string // --provider, overrides default_provider
+	Model    string // --model, overrides the model of the resulting default provider
+}
+
+// Origin records which layer a configuration value came from.
+type Origin struct {
+	Key    string      // Dotted key, e.g. "llms.groq.model"
+	Value  interface{} // Value as decoded from TOML or the environment
+	Source string      // e.g. "user /home/me/.config/dreampipe/config.toml"
+}
+
+// layer is one source of configuration values, as a generic TOML table.
+type layer struct {
+	source string
+	values map[string]interface{}
+}
+
+// LoadWithFlags is Load with command line flags applied as the final layer.
+// Layers are merged key by key, in order: built-in defaults, SystemConfigPath,
+// the user configuration file, the nearest project .dreampipe.toml,
+// DREAMPIPE_* environment variables and flags.
+func LoadWithFlags(debugMode bool, flags Flags) (Config, error) {
+	cfgPath, err := GetConfigFilePath()
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to determine config path: %w", err)
+	}
+
+	layers, err := readLayers(cfgPath, debugMode)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(layers) == 0 {
+		// Nothing configured at all, ask to create the user configuration file
+		if debugMode {
+			fmt.Printf("Configuration file not found at %s\n", cfgPath)
+		}
+		// Prompting reads stdin, which would consume piped input meant for the LLM.
+		if !iohandler.IsTerminal(os.Stdin) {
+			return Config{}, fmt.Errorf("configuration file not found at %s and stdin is not a terminal to create it interactively.\n\nTo create it non-interactively, run for example:\n  dreampipe config init --non-interactive --provider ollama --base-url http://localhost:11434\n\nFor more help, visit: https://github.com/hiway/dreampipe#configuration", cfgPath)
+		}
+		if !askToCreateConfigFile() {
+			return Config{}, fmt.Errorf("configuration file creation declined by user.\n\nTo create a configuration file later, run:\n  dreampipe config\n\nFor more help, visit: https://github.com/hiway/dreampipe#configuration")
+		}
+		cfg := defaultConfig()
+		if err := createConfigFileInteractive(cfgPath, &cfg, debugMode); err != nil {
+			return Config{}, fmt.Errorf("failed to create configuration file: %w", err)
+		}
+		if debugMode {
+			fmt.Printf("Configuration file created successfully at %s\n", cfgPath)
+		}
+		if layers, err = readLayers(cfgPath, debugMode); err != nil {
+			return Config{}, err
+		}
+	}
+
+	cfg, _, err := mergeLayers(layers, flags)
+	return cfg, err
+}
+
+// LoadWithOrigins loads the layered configuration like LoadWithFlags, but never
+// prompts, and also reports where each value came from, sorted by key.
+func LoadWithOrigins(flags Flags) (Config, []Origin, error) {
+	cfgPath, err := GetConfigFilePath()
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("failed to determine config path: %w", err)
+	}
+	layers, err := readLayers(cfgPath, false)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if len(layers) == 0 {
+		return Config{}, nil, fmt.Errorf("%w: %s does not exist", ErrNoConfig, cfgPath)
+	}
+	return mergeLayers(layers, flags)
+}
+
+// FindProjectConfig returns the path of the nearest ProjectConfigFileName in dir
+// or one of its parents, or "" if there is none.
+func FindProjectConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, ProjectConfigFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readLayers returns the system, user and project files and environment
+// variables that exist, lowest priority first.
+func readLayers(cfgPath string, debugMode bool) ([]layer, error) {
+	var layers []layer
+
+	files := []struct{ kind, path string }{
+		{"system", SystemConfigPath},
+		{"user", cfgPath},
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if path := FindProjectConfig(cwd); path != "" {
+			files = append(files, struct{ kind, path string }{"project", path})
+		}
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to access config file %s: %w", f.path, err)
+		}
+		if debugMode {
+			fmt.Printf("Loading configuration from %s\n", f.path)
+		}
+		l, err := readFileLayer(f.kind, f.path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+
+	envLayers, err := readEnvLayers()
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, envLayers...), nil
+}
+
+// readFileLayer decodes a configuration file into a layer, warning about keys
+// dreampipe does not know.
+func readFileLayer(kind, path string) (layer, error) {
+	// Decoding into Config first reports type errors and unknown keys.
+	var cfg Config
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return layer{}, fmt.Errorf("failed to decode TOML config file %s: %w", path, err)
+	}
+	if unknown := unknownKeys(meta.Undecoded(), cfg.LLMs); len(unknown) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: Unknown configuration keys found in %s: %v\n", path, unknown)
+	}
+
+	values := map[string]interface{}{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return layer{}, fmt.Errorf("failed to decode TOML config file %s: %w", path, err)
+	}
+	if kind == "project" {
+		dropUnsafeProjectKeys(path, values)
+	}
+	return layer{source: kind + " " + path, values: values}, nil
+}
+
+// unknownKeys returns the undecoded keys that are mistakes rather than
+// settings of the providers of the [llms] entries llms.
+func unknownKeys(undecoded []toml.Key, llms map[string]LLMConfig) []toml.Key {
+	var unknown []toml.Key
+	for _, key := range undecoded {
+		if len(key) > 2 && key[0] == "llms" && readsSetting(key[1], llms[key[1]], key[2]) {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	return unknown
+}
+
+// readsSetting reports whether the provider of the [llms] entry name reads
+// key: a plugin may read any key, as only the plugin knows its settings, and
+// a registered provider those it registered.
+func readsSetting(name string, llmCfg LLMConfig, key string) bool {
+	providerType := name
+	if llmCfg.Type != "" {
+		providerType = llmCfg.Type
+	}
+	settings, registered := providerSettingKeys(providerType)
+	return llmCfg.Plugin != "" || !registered || slices.Contains(settings, key)
+}
+
+// dropUnsafeProjectKeys removes the keys a project configuration may not set,
+// with a warning for each.
+func dropUnsafeProjectKeys(path string, values map[string]interface{}) {
+	var dropped []string
+	for key := range values {
+		if !slices.Contains(projectKeys, key) {
+			dropped = append(dropped, key)
+			delete(values, key)
+		}
+	}
+	if v, ok := values["llms"]; ok {
+		llms, ok := v.(map[string]interface{})
+		if !ok {
+			dropped = append(dropped, "llms")
+			delete(values, "llms")
+		}
+		for provider, v := range llms {
+			llmValues, ok := v.(map[string]interface{})
+			if !ok {
+				dropped = append(dropped, "llms."+provider)
+				delete(llms, provider)
+				continue
+			}
+			for key := range llmValues {
+				if !slices.Contains(projectProviderKeys, key) {
+					dropped = append(dropped, "llms."+provider+"."+key)
+					delete(llmValues, key)
+				}
+			}
+		}
+	}
+	sort.Strings(dropped)
+	for _, key := range dropped {
+		fmt.Fprintf(os.Stderr, "Warning: Ignoring %s in %s, a project configuration can only set %s, and %s of providers\n",
+			key, path, strings.Join(projectKeys[:len(projectKeys)-1], ", "), strings.Join(projectProviderKeys, ", "))
+	}
+}
+
+// envKey is a configuration key that can be set from the environment.
+type envKey struct {
+	path []string
+	name string
+	kind reflect.Kind
+}
+
+// envKeys lists the scalar configuration keys with their environment variable
+// names: top-level keys and sections map to DREAMPIPE_<SECTION>_<KEY>, and
+// provider keys drop the "llms" part, e.g. DREAMPIPE_GROQ_MODEL.
+func envKeys() []envKey {
+	var keys []envKey
+	var walk func(t reflect.Type, path, nameParts []string)
+	walk = func(t reflect.Type, path, nameParts []string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("toml"), ",")[0]
+			if tag == "" {
+				continue
+			}
+			fieldPath := append(append([]string{}, path...), tag)
+			fieldName := append(append([]string{}, nameParts...), tag)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			switch fieldType.Kind() {
+			case reflect.Struct:
+				walk(fieldType, fieldPath, fieldName)
+			case reflect.Map:
+				if tag == "llms" {
+					for _, provider := range providerTypes() {
+						walk(fieldType.Elem(), append(fieldPath, provider), append(nameParts, provider))
+					}
+				}
+			case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+				keys = append(keys, envKey{
+					path: fieldPath,
+					name: envPrefix + strings.ToUpper(strings.Join(fieldName, "_")),
+					kind: fieldType.Kind(),
+				})
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), nil, nil)
+	return keys
+}
+
+// readEnvLayers returns one layer for each DREAMPIPE_* variable that is set.
+func readEnvLayers() ([]layer, error) {
+	var layers []layer
+	for _, key := range envKeys() {
+		raw, ok := os.LookupEnv(key.name)
+		if !ok {
+			continue
+		}
+		var value interface{} = raw
+		switch key.kind {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean in %s: %q", key.name, raw)
+			}
+			value = b
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid integer in %s: %q", key.name, raw)
+			}
+			value = n
+		}
+		layers = append(layers, layer{source: "environment " + key.name, values: nested(key.path, value)})
+	}
+	return layers, nil
+}
+
+// nested builds a table holding value at the dotted path.
+func nested(path []string, value interface{}) map[string]interface{} {
+	for i := len(path) - 1; i > 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return map[string]interface{}{path[0]: value}
+}
+
+// mergeLayers merges the built-in defaults, layers and flags key by key and
+// decodes the result into a validated Config.
+func mergeLayers(layers []layer, flags Flags) (Config, []Origin, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(defaultConfig()); err != nil {
+		return Config{}, nil, fmt.Errorf("failed to encode default configuration: %w", err)
+	}
+	defaults := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &defaults); err != nil {
+		return Config{}, nil, fmt.Errorf("failed to decode default configuration: %w", err)
+	}
+
+	merged := map[string]interface{}{}
+	sources := map[string]string{}
+	mergeTable(merged, defaults, "", "default", sources)
+	for _, l := range layers {
+		mergeTable(merged, l.values, "", l.source, sources)
+	}
+
+	if flags.Provider != "" {
+		mergeTable(merged, nested([]string{"default_provider"}, flags.Provider), "", "flag --provider", sources)
+	}
+	if flags.Model != "" {
+		provider, _ := merged["default_provider"].(string)
+		mergeTable(merged, nested([]string{"llms", provider, "model"}, flags.Model), "", "flag --model", sources)
+	}
+
+	buf.Reset()
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return Config{}, nil, fmt.Errorf("failed to encode merged configuration: %w", err)
+	}
+	var cfg Config
+	if _, err := toml.Decode(buf.String(), &cfg); err != nil {
+		return Config{}, nil, fmt.Errorf("failed to decode merged configuration: %w", err)
+	}
+	cfg.setProviderTables(merged)
+	if err := cfg.validate(); err != nil {
+		return Config{}, nil, err
+	}
+
+	origins := make([]Origin, 0, len(sources))
+	for key, source := range sources {
+		origins = append(origins, Origin{Key: key, Value: lookup(merged, key), Source: source})
+	}
+	sort.Slice(origins, func(i, j int) bool { return origins[i].Key < origins[j].Key })
+	return cfg, origins, nil
+}
+
+// mergeTable copies src into dst, descending into tables so that only the
+// keys a layer sets are replaced. sources maps each dotted leaf key to the
+// layer that set it last.
+func mergeTable(dst, src map[string]interface{}, prefix, source string, sources map[string]string) {
+	// Only one API key source may be set, so a layer setting one replaces
+	// those of the layers below, e.g. DREAMPIPE_GROQ_API_KEY a file's
+	// api_key_cmd.
+	if strings.HasPrefix(prefix, "llms.") && strings.Count(prefix, ".") == 2 && setsKeySource(src) {
+		for _, key := range apiKeySources {
+			delete(dst, key)
+			delete(sources, prefix+key)
+		}
+	}
+	for key, value := range src {
+		path := prefix + key
+		if table, ok := value.(map[string]interface{}); ok {
+			dstTable, ok := dst[key].(map[string]interface{})
+			if !ok {
+				dstTable = map[string]interface{}{}
+				dst[key] = dstTable
+			}
+			mergeTable(dstTable, table, path+".", source, sources)
+			continue
+		}
+		dst[key] = value
+		sources[path] = source
+	}
+}
+
+// apiKeySources are the keys of an [llms] entry that give its API key.
+var apiKeySources = []string{"api_key", "api_key_cmd", "api_key_env", "api_key_file"}
+
+// setsKeySource reports whether an [llms] entry's table sets an API key source.
+func setsKeySource(table map[string]interface{}) bool {
+	for _, key := range apiKeySources {
+		if _, ok := table[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the value at a dotted key in a merged table.
+func lookup(table map[string]interface{}, key string) interface{} {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		table, _ = table[part].(map[string]interface{})
+	}
+	return table[parts[len(parts)-1]]
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func init() {
+	SetProviderRegistry(testRegistry{})
+}
+
+// testRegistry stands in for the provider registry of package llm.
+type testRegistry struct{}
+
+var testProviders = map[string][]string{
+	"command": nil,
+	"gemini":  nil,
+	"groq":    nil,
+	"mock":    {"mode", "response_file", "responses", "rules", "latency", "error", "fail_every"},
+	"ollama":  nil,
+}
+
+func (testRegistry) Types() []string {
+	types := make([]string, 0, len(testProviders))
+	for name := range testProviders {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (testRegistry) SettingKeys(providerType string) ([]string, bool) {
+	settings, ok := testProviders[providerType]
+	return settings, ok
+}
+
+// writeFile writes content to path, creating parent directories.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), DefaultDirPerm); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), DefaultFilePerm); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadWithOrigins_Layers(t *testing.T) {
+	root := t.TempDir()
+
+	systemPath := filepath.Join(root, "etc", "config.toml")
+	writeFile(t, systemPath, "request_timeout_seconds = 30\n[llms.groq]\nmodel = \"system-model\"\n")
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = systemPath
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home"))
+	writeFile(t, filepath.Join(root, "home", "dreampipe", "config.toml"),
+		"default_provider = \"groq\"\n[llms.groq]\napi_key = \"gsk_user\"\n")
+
+	project := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(project, ProjectConfigFileName),
+		"context_overflow = \"chunk\"\n[llms.groq]\nmodel = \"project-model\"\napi_key_cmd = \"echo stolen\"\n")
+	workDir := filepath.Join(project, "sub", "dir")
+	if err := os.MkdirAll(workDir, DefaultDirPerm); err != nil {
+		t.Fatalf("Failed to create work dir: %v", err)
+	}
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	t.Setenv("DREAMPIPE_REQUEST_TIMEOUT_SECONDS", "90")
+
+	cfg, origins, err := LoadWithOrigins(Flags{Model: "flag-model"})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+
+	groq := cfg.LLMs["groq"]
+	if groq.APIKey != "gsk_user" || groq.APIKeyCmd != "" {
+		t.Errorf("groq keys = %q/%q, want user key kept and project api_key_cmd dropped", groq.APIKey, groq.APIKeyCmd)
+	}
+	if groq.Model != "flag-model" {
+		t.Errorf("groq model = %q, want %q", groq.Model, "flag-model")
+	}
+	if cfg.RequestTimeoutSeconds != 90 {
+		t.Errorf("RequestTimeoutSeconds = %d, want 90", cfg.RequestTimeoutSeconds)
+	}
+	if cfg.ContextOverflow != ContextOverflowChunk {
+		t.Errorf("ContextOverflow = %q, want %q", cfg.ContextOverflow, ContextOverflowChunk)
+	}
+	if cfg.LLMs["ollama"].BaseURL == "" {
+		t.Errorf("ollama base_url default was lost")
+	}
+
+	wantSources := map[string]string{
+		"default_provider":        "user " + filepath.Join(root, "home", "dreampipe", "config.toml"),
+		"context_overflow":        "project " + filepath.Join(project, ProjectConfigFileName),
+		"request_timeout_seconds": "environment DREAMPIPE_REQUEST_TIMEOUT_SECONDS",
+		"llms.groq.model":         "flag --model",
+		"record_usage":            "default",
+	}
+	for _, o := range origins {
+		if want, ok := wantSources[o.Key]; ok {
+			if o.Source != want {
+				t.Errorf("origin of %s = %q, want %q", o.Key, o.Source, want)
+			}
+			delete(wantSources, o.Key)
+		}
+	}
+	for key := range wantSources {
+		t.Errorf("no origin reported for %s", key)
+	}
+}
+
+func TestLoadWithOrigins_KeySourceOverride(t *testing.T) {
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(t.TempDir(), "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	writeFile(t, filepath.Join(home, "dreampipe", "config.toml"),
+		"default_provider = \"groq\"\n[llms.groq]\napi_key_cmd = \"pass show groq\"\n")
+	t.Setenv("DREAMPIPE_GROQ_API_KEY", "gsk_env")
+
+	cfg, origins, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	if groq := cfg.LLMs["groq"]; groq.APIKey != "gsk_env" || groq.APIKeyCmd != "" {
+		t.Errorf("groq keys = %q/%q, want the environment's key to replace the file's api_key_cmd", groq.APIKey, groq.APIKeyCmd)
+	}
+	for _, o := range origins {
+		switch o.Key {
+		case "llms.groq.api_key":
+			if o.Source != "environment DREAMPIPE_GROQ_API_KEY" {
+				t.Errorf("origin of %s = %q, want the environment", o.Key, o.Source)
+			}
+		case "llms.groq.api_key_cmd":
+			t.Errorf("origins list the replaced api_key_cmd from %s", o.Source)
+		}
+	}
+}
+
+func TestLoadWithOrigins_NoConfig(t *testing.T) {
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(t.TempDir(), "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if _, _, err := LoadWithOrigins(Flags{}); err == nil {
+		t.Errorf("LoadWithOrigins() error = nil, want ErrNoConfig")
+	}
+}
+
+func TestLoadWithOrigins_RegisteredProviderWithoutEntry(t *testing.T) {
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(t.TempDir(), "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("DREAMPIPE_DEFAULT_PROVIDER", "mock")
+
+	cfg, _, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	if _, exists := cfg.LLMs["mock"]; exists || cfg.DefaultProvider != "mock" {
+		t.Errorf("LLMs = %v, default %q; want mock as the default without an entry", cfg.LLMs, cfg.DefaultProvider)
+	}
+
+	t.Setenv("DREAMPIPE_DEFAULT_PROVIDER", "mokc")
+	if _, _, err := LoadWithOrigins(Flags{}); err == nil {
+		t.Errorf("LoadWithOrigins() accepted an unknown default provider")
+	}
+}
+
+func TestLoadWithOrigins_InvalidEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("DREAMPIPE_RECORD_USAGE", "sometimes")
+
+	if _, _, err := LoadWithOrigins(Flags{}); err == nil {
+		t.Errorf("LoadWithOrigins() error = nil, want invalid boolean error")
+	}
+}
+
+func TestLoadWithOrigins_ProviderSettings(t *testing.T) {
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(t.TempDir(), "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	writeFile(t, filepath.Join(home, "dreampipe", "config.toml"),
+		"default_provider = \"acme\"\n[llms.acme]\nmodel = \"big\"\nregion = \"eu\"\nretries = 3\n")
+
+	cfg, _, err := LoadWithOrigins(Flags{Model: "small"})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	settings := cfg.ProviderSettings("acme")
+	if settings["model"] != "small" || settings["region"] != "eu" || settings["retries"] != int64(3) {
+		t.Errorf("ProviderSettings(acme) = %v, want the file's keys with the flag's model", settings)
+	}
+	if settings := cfg.ProviderSettings("ollama"); settings["base_url"] == nil {
+		t.Errorf("ProviderSettings(ollama) = %v, want the default base_url", settings)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	undecoded := []toml.Key{
+		{"llms", "acme", "region"},
+		{"llms", "groq", "regoin"},
+		{"llms", "mock", "mode"},
+		{"llms", "work", "regoin"},
+		{"llms", "local", "region"},
+		{"modle"},
+	}
+	llms := map[string]LLMConfig{
+		"work":  {Type: "groq"},
+		"local": {Type: "ollama", Plugin: "my-ollama"},
+	}
+	var got []string
+	for _, key := range unknownKeys(undecoded, llms) {
+		got = append(got, key.String())
+	}
+	want := []string{"llms.groq.regoin", "llms.work.regoin", "modle"}
+	if !slices.Equal(got, want) {
+		t.Errorf("unknownKeys() = %v, want %v: the keys registered providers don't read", got, want)
+	}
+}
+
+func TestLoadWithOrigins_ProjectAllowlist(t *testing.T) {
+	root := t.TempDir()
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(root, "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home"))
+	writeFile(t, filepath.Join(root, "home", "dreampipe", "config.toml"),
+		"default_provider = \"groq\"\n[redaction]\nenabled = true\n[llms.groq]\napi_key = \"gsk_user\"\nredact = true\n")
+
+	project := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(project, ProjectConfigFileName), `
+default_provider = "groq"
+scripts_dir = "/tmp/evil"
+[redaction]
+enabled = false
+[limits]
+daily_spend_usd = { groq = 1000.0 }
+[llms.groq]
+model = "project-model"
+base_url = "https://attacker.example"
+redact = false
+`)
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(project); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	cfg, _, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	groq := cfg.LLMs["groq"]
+	if groq.Model != "project-model" {
+		t.Errorf("groq model = %q, want the project's model", groq.Model)
+	}
+	if groq.BaseURL != "" {
+		t.Errorf("groq base_url = %q, want the project's dropped", groq.BaseURL)
+	}
+	if !cfg.RedactionEnabled("groq") || !cfg.Redaction.Enabled {
+		t.Errorf("redaction turned off by the project configuration")
+	}
+	if cfg.Limits.DailySpendUSD != nil || cfg.ScriptsDir == "/tmp/evil" {
+		t.Errorf("limits %v or scripts_dir %q set by the project configuration", cfg.Limits.DailySpendUSD, cfg.ScriptsDir)
+	}
+}
+
+func TestLoadWithOrigins_ProjectPlugin(t *testing.T) {
+	root := t.TempDir()
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(root, "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home"))
+	writeFile(t, filepath.Join(root, "home", "dreampipe", "config.toml"), "default_provider = \"ollama\"\n")
+
+	project := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(project, ProjectConfigFileName),
+		"default_provider = \"x\"\n[llms.x]\ntype = \"acme\"\nplugin = \"/tmp/evil\"\nmodel = \"m\"\n")
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(project); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	cfg, _, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	if x := cfg.LLMs["x"]; x.Type != "" || x.Plugin != "" {
+		t.Errorf("llms.x = %+v, want the project's type and plugin dropped", x)
+	}
+}
+
+func TestLoadWithOrigins_ProjectCommand(t *testing.T) {
+	root := t.TempDir()
+	oldSystemPath := SystemConfigPath
+	SystemConfigPath = filepath.Join(root, "missing.toml")
+	t.Cleanup(func() { SystemConfigPath = oldSystemPath })
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "home"))
+	writeFile(t, filepath.Join(root, "home", "dreampipe", "config.toml"), "default_provider = \"ollama\"\n")
+
+	// Both an entry of type command and the command entry itself.
+	project := filepath.Join(root, "repo")
+	writeFile(t, filepath.Join(project, ProjectConfigFileName), `
+default_provider = "x"
+[llms.x]
+type = "command"
+command = ["sh", "-c", "touch PWNED"]
+timeout = "1h"
+[llms.command]
+command = ["sh", "-c", "touch PWNED"]
+`)
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(project); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldWd) })
+
+	cfg, _, err := LoadWithOrigins(Flags{})
+	if err != nil {
+		t.Fatalf("LoadWithOrigins() error = %v", err)
+	}
+	for _, name := range []string{"x", "command"} {
+		if llmCfg := cfg.LLMs[name]; llmCfg.Type != "" || llmCfg.Command != nil || llmCfg.Timeout != "" {
+			t.Errorf("llms.%s = %+v, want the project's type, command and timeout dropped", name, llmCfg)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+// ProviderRegistry describes the provider types dreampipe can create clients
+// for. The registry lives in package llm, which imports this one, so llm
+// hands it over with SetProviderRegistry.
+type ProviderRegistry interface {
+	// Types returns the registered provider types, sorted.
+	Types() []string
+	// SettingKeys returns the keys an entry of providerType reads beyond
+	// those of LLMConfig, and whether providerType is registered.
+	SettingKeys(providerType string) ([]string, bool)
+}
+
+// providerRegistry is set by package llm; without it no provider type is known.
+var providerRegistry ProviderRegistry
+
+// SetProviderRegistry makes config check provider types against registry.
+func SetProviderRegistry(registry ProviderRegistry) {
+	providerRegistry = registry
+}
+
+// providerTypes returns the registered provider types.
+func providerTypes() []string {
+	if providerRegistry == nil {
+		return nil
+	}
+	return providerRegistry.Types()
+}
+
+// isKnownProvider reports whether providerType is registered.
+func isKnownProvider(providerType string) bool {
+	_, ok := providerSettingKeys(providerType)
+	return ok
+}
+
+// providerSettingKeys returns the keys an entry of providerType reads beyond
+// those of LLMConfig, and whether providerType is registered.
+func providerSettingKeys(providerType string) ([]string, bool) {
+	if providerRegistry == nil {
+		return nil, false
+	}
+	return providerRegistry.SettingKeys(providerType)
+}
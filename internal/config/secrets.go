@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apiKeyCmdTimeout bounds how long api_key_cmd may run, e.g. while a password
+// manager waits for its agent.
+const apiKeyCmdTimeout = 30 * time.Second
+
+// ErrMultipleKeySources is returned when more than one API key source is set.
+var ErrMultipleKeySources = errors.New("only one of api_key, api_key_cmd, api_key_env and api_key_file may be set")
+
+// ResolveAPIKey returns the provider's API key from whichever source is configured:
+// api_key (inline), api_key_env, api_key_file or api_key_cmd. Only the first line
+// of a file or command output is used, so `pass show` style output works.
+// It also returns a description of the source, which never contains the key.
+// An empty key with a nil error means no source is configured.
+func (l LLMConfig) ResolveAPIKey() (key string, source string, err error) {
+	sources := 0
+	for _, v := range []string{l.APIKey, l.APIKeyCmd, l.APIKeyEnv, l.APIKeyFile} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", "", ErrMultipleKeySources
+	}
+
+	switch {
+	case l.APIKey != "":
+		return l.APIKey, "api_key", nil
+	case l.APIKeyEnv != "":
+		source = fmt.Sprintf("environment variable %s", l.APIKeyEnv)
+		key = strings.TrimSpace(os.Getenv(l.APIKeyEnv))
+		if key == "" {
+			return "", source, fmt.Errorf("environment variable %s from api_key_env is not set or empty", l.APIKeyEnv)
+		}
+		return key, source, nil
+	case l.APIKeyFile != "":
+		path := ExpandHome(l.APIKeyFile)
+		source = fmt.Sprintf("file %s", path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", source, fmt.Errorf("failed to read api_key_file: %w", err)
+		}
+		key = firstLine(data)
+		if key == "" {
+			return "", source, fmt.Errorf("api_key_file %s is empty", path)
+		}
+		return key, source, nil
+	case l.APIKeyCmd != "":
+		source = fmt.Sprintf("command %q", l.APIKeyCmd)
+		ctx, cancel := context.WithTimeout(context.Background(), apiKeyCmdTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", l.APIKeyCmd)
+		cmd.Stdin = nil // Never hand the piped input to the key command
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			// Deliberately not including the output, which may contain the key.
+			return "", source, fmt.Errorf("api_key_cmd failed: %w", err)
+		}
+		key = firstLine(out)
+		if key == "" {
+			return "", source, errors.New("api_key_cmd printed nothing")
+		}
+		return key, source, nil
+	default:
+		return "", "", nil
+	}
+}
+
+// HasAPIKeySource reports whether any API key source is configured.
+func (l LLMConfig) HasAPIKeySource() bool {
+	return l.APIKey != "" || l.APIKeyCmd != "" || l.APIKeyEnv != "" || l.APIKeyFile != ""
+}
+
+// firstLine returns the first line of data with surrounding whitespace removed.
+func firstLine(data []byte) string {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	return strings.TrimSpace(string(line))
+}
+
+// ExpandHome replaces a leading "~/" in path with the user's home directory.
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLLMConfig_ResolveAPIKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "groq.key")
+	if err := os.WriteFile(keyFile, []byte("file-key\nsecond line\n"), DefaultFilePerm); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	t.Setenv("DREAMPIPE_TEST_KEY", "env-key")
+
+	tests := []struct {
+		name    string
+		cfg     LLMConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "Inline", cfg: LLMConfig{APIKey: "inline-key"}, want: "inline-key"},
+		{name: "Environment variable", cfg: LLMConfig{APIKeyEnv: "DREAMPIPE_TEST_KEY"}, want: "env-key"},
+		{name: "Missing environment variable", cfg: LLMConfig{APIKeyEnv: "DREAMPIPE_TEST_UNSET"}, wantErr: true},
+		{name: "File uses first line", cfg: LLMConfig{APIKeyFile: keyFile}, want: "file-key"},
+		{name: "Missing file", cfg: LLMConfig{APIKeyFile: keyFile + ".missing"}, wantErr: true},
+		{name: "Command uses first line", cfg: LLMConfig{APIKeyCmd: "echo $DREAMPIPE_TEST_KEY; echo url: example.com"}, want: "env-key"},
+		{name: "Failing command", cfg: LLMConfig{APIKeyCmd: "exit 1"}, wantErr: true},
+		{name: "Several sources", cfg: LLMConfig{APIKey: "inline-key", APIKeyEnv: "DREAMPIPE_TEST_KEY"}, wantErr: true},
+		{name: "No source", cfg: LLMConfig{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source, err := tt.cfg.ResolveAPIKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveAPIKey() = %q, want %q", got, tt.want)
+			}
+			if got != "" && strings.Contains(source, got) {
+				t.Errorf("ResolveAPIKey() source %q reveals the key", source)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package filters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultFilters are applied to the LLM output when a script doesn't choose.
+var DefaultFilters = []string{"markdown_code_block"}
+
+// named are the filters scripts can refer to by name.
+var named = map[string]OutputFilter{
+	"markdown_code_block": &MarkdownCodeBlockFilter{},
+	"trim_space":          &TrimSpaceFilter{},
+}
+
+// TrimSpaceFilter removes leading and trailing whitespace.
+type TrimSpaceFilter struct{}
+
+// Apply applies the filter to the input string.
+func (f *TrimSpaceFilter) Apply(input string) string {
+	return strings.TrimSpace(input)
+}
+
+// Lookup returns the filter called name.
+func Lookup(name string) (OutputFilter, error) {
+	filter, ok := named[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return filter, nil
+}
+
+// Names returns the names of all filters, sorted.
+func Names() []string {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
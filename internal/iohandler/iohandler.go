@@ -4,11 +4,15 @@
 package iohandler
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 )
 
+// ErrInputTooLarge is returned when input exceeds the size limit given to a read.
+var ErrInputTooLarge = errors.New("input too large")
+
 // Streams represents the standard input, output, and error streams.
 // This allows for easier testing by mocking these streams.
 type Streams struct {
@@ -26,6 +30,19 @@ func DefaultOSStreams() *Streams {
 	}
 }
 
+// IsTerminal reports whether f is connected to a terminal rather than a pipe,
+// file or /dev/null.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 // ReadAllFromStdin reads all data from the configured Stdin stream.
 // It's a convenience wrapper around io.ReadAll.
 func (s *Streams) ReadAllFromStdin() ([]byte, error) {
@@ -39,6 +56,26 @@ func (s *Streams) ReadAllFromStdin() ([]byte, error) {
 	return data, nil
 }
 
+// ReadAllFromStdinLimited reads all data from the configured Stdin stream,
+// returning ErrInputTooLarge as soon as more than limit bytes have been read,
+// without buffering the rest. A limit of 0 or less means no limit.
+func (s *Streams) ReadAllFromStdinLimited(limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return s.ReadAllFromStdin()
+	}
+	if s.In == nil {
+		return nil, fmt.Errorf("stdin stream is nil")
+	}
+	data, err := io.ReadAll(io.LimitReader(s.In, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from stdin: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrInputTooLarge, limit)
+	}
+	return data, nil
+}
+
 // ReadAllFromFile reads all data from the specified file path.
 func ReadAllFromFile(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
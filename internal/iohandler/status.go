@@ -0,0 +1,203 @@
+package iohandler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statusInterval is how often the status line is redrawn.
+	statusInterval = 100 * time.Millisecond
+	// statusWidth keeps the line narrower than most terminals, as a wrapped
+	// line can't be redrawn in place.
+	statusWidth = 79
+	// barWidth is the number of cells of the progress bar.
+	barWidth = 20
+	// clearLine returns to the start of the line and erases it.
+	clearLine = "\r\x1b[K"
+)
+
+// spinnerFrames are drawn in turn while the run is busy.
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// StatusLine draws a line on a terminal showing what a run is doing: the
+// phase, a spinner, a progress bar when the work is split in parts, and the
+// elapsed time. It is redrawn in place, so it should only be used when w is
+// a terminal.
+//
+// Text written to the StatusLine goes to w, with the line erased first and
+// redrawn after, so messages and the status don't garble each other. The
+// other methods do nothing on a nil *StatusLine.
+type StatusLine struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	phase   string
+	label   string // What the progress counts, e.g. "chunks"
+	done    int
+	total   int
+	frame   int
+	visible bool // The line is on the screen
+	stop    chan struct{}
+	stopped bool
+}
+
+// NewStatusLine returns a status line drawn on w; it shows once Start is called.
+func NewStatusLine(w io.Writer) *StatusLine {
+	return &StatusLine{w: w, start: time.Now()}
+}
+
+// Start draws the line and keeps redrawing it until Stop is called.
+func (s *StatusLine) Start() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.stop = make(chan struct{})
+	stop := s.stop
+	s.drawLocked()
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				s.frame++
+				s.drawLocked()
+				s.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Stop erases the line for good; later writes go straight to w.
+func (s *StatusLine) Stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.eraseLocked()
+}
+
+// SetPhase sets what the run is doing, e.g. "Waiting for groq".
+func (s *StatusLine) SetPhase(format string, args ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = fmt.Sprintf(format, args...)
+}
+
+// SetProgress shows a progress bar of done out of total parts, counting
+// label; a total of 0 hides it.
+func (s *StatusLine) SetProgress(done, total int, label string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done, s.total, s.label = done, total, label
+}
+
+// Advance counts one more part as done.
+func (s *StatusLine) Advance() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done < s.total {
+		s.done++
+	}
+}
+
+// Write writes p to the underlying writer, erasing the line first. The line
+// is redrawn on the next tick, once p is complete.
+func (s *StatusLine) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eraseLocked()
+	return s.w.Write(p)
+}
+
+// drawLocked redraws the line, unless it was stopped.
+func (s *StatusLine) drawLocked() {
+	if s.stopped {
+		return
+	}
+	io.WriteString(s.w, clearLine+s.render(time.Since(s.start)))
+	s.visible = true
+}
+
+// eraseLocked removes the line from the screen.
+func (s *StatusLine) eraseLocked() {
+	if s.visible {
+		io.WriteString(s.w, clearLine)
+		s.visible = false
+	}
+}
+
+// render returns the text of the line after elapsed.
+func (s *StatusLine) render(elapsed time.Duration) string {
+	var b strings.Builder
+	b.WriteRune(spinnerFrames[s.frame%len(spinnerFrames)])
+	if s.phase != "" {
+		b.WriteString(" " + s.phase)
+	}
+	if s.total > 0 {
+		filled := barWidth * s.done / s.total
+		fmt.Fprintf(&b, " [%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), s.done, s.total)
+		if s.label != "" {
+			b.WriteString(" " + s.label)
+		}
+	}
+	fmt.Fprintf(&b, " %.1fs", elapsed.Seconds())
+	line := []rune(b.String())
+	if len(line) > statusWidth {
+		line = append(line[:statusWidth-1], '…')
+	}
+	return string(line)
+}
+
+// CountingReader reports the bytes read from a reader to a status line as
+// the phase "Reading input".
+type CountingReader struct {
+	R      io.Reader
+	Status *StatusLine
+	n      int64
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.R.Read(p)
+	c.n += int64(n)
+	c.Status.SetPhase("Reading input (%s)", FormatBytes(c.n))
+	return n, err
+}
+
+// FormatBytes returns n as a short size, e.g. "12.3 KB".
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,98 @@
+package iohandler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusLine_Render(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(s *StatusLine)
+		want   string
+		length int
+	}{
+		{
+			name:  "Phase",
+			setup: func(s *StatusLine) { s.SetPhase("Waiting for %s", "groq") },
+			want:  "⠋ Waiting for groq 2.5s",
+		},
+		{
+			name: "Progress",
+			setup: func(s *StatusLine) {
+				s.SetPhase("Waiting for ollama")
+				s.SetProgress(1, 4, "chunks")
+				s.Advance()
+			},
+			want: "⠋ Waiting for ollama [##########----------] 2/4 chunks 2.5s",
+		},
+		{
+			name:   "Too long",
+			setup:  func(s *StatusLine) { s.SetPhase(strings.Repeat("x", 200)) },
+			length: statusWidth,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStatusLine(io.Discard)
+			tt.setup(s)
+			got := s.render(2500 * time.Millisecond)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+			if tt.length != 0 && len([]rune(got)) != tt.length {
+				t.Errorf("render() is %d characters, want %d", len([]rune(got)), tt.length)
+			}
+		})
+	}
+}
+
+func TestStatusLine_Write(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStatusLine(&buf)
+	s.SetPhase("Reading input")
+	s.Start()
+	if _, err := io.WriteString(s, "⚠️  warning\n"); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+	s.Stop() // Stopping twice is harmless
+	io.WriteString(s, "after\n")
+
+	// The line is drawn, erased for the message, and erased when stopped,
+	// unless the message already erased it.
+	got := buf.String()
+	if !strings.HasPrefix(got, clearLine+"⠋ Reading input") {
+		t.Errorf("output %q doesn't start with the status line", got)
+	}
+	if !strings.Contains(got, clearLine+"⚠️  warning\n") {
+		t.Errorf("output %q doesn't erase the line before the message", got)
+	}
+	if !strings.HasSuffix(got, "\nafter\n") {
+		t.Errorf("output %q, want writes after Stop passed through", got)
+	}
+}
+
+func TestStatusLine_Nil(t *testing.T) {
+	var s *StatusLine
+	s.Start()
+	s.SetPhase("x")
+	s.SetProgress(1, 2, "chunks")
+	s.Advance()
+	s.Stop()
+}
+
+func TestCountingReader(t *testing.T) {
+	s := NewStatusLine(io.Discard)
+	data, err := io.ReadAll(&CountingReader{R: strings.NewReader(strings.Repeat("x", 2048)), Status: s})
+	if err != nil || len(data) != 2048 {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(data), err)
+	}
+	if s.phase != "Reading input (2.0 KB)" {
+		t.Errorf("phase = %q, want the bytes read", s.phase)
+	}
+}
@@ -0,0 +1,11 @@
+// Package builtin registers the providers that ship with dreampipe. Import
+// it for its side effects wherever clients are created from configuration.
+package builtin
+
+import (
+	_ "github.com/hiway/dreampipe/internal/llm/command" // Registers "command"
+	_ "github.com/hiway/dreampipe/internal/llm/gemini"  // Registers "gemini"
+	_ "github.com/hiway/dreampipe/internal/llm/groq"    // Registers "groq"
+	_ "github.com/hiway/dreampipe/internal/llm/mock"    // Registers "mock"
+	_ "github.com/hiway/dreampipe/internal/llm/ollama"  // Registers "ollama"
+)
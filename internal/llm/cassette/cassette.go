@@ -0,0 +1,233 @@
+// Package cassette records the HTTP exchanges of provider clients and replays
+// them offline, for hermetic tests of real wire formats and for demos of
+// pipelines without network access or API keys.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// RecordEnv names the directory a run saves its HTTP exchanges to.
+	RecordEnv = "DREAMPIPE_RECORD"
+	// ReplayEnv names the directory a run answers HTTP requests from.
+	ReplayEnv = "DREAMPIPE_REPLAY"
+)
+
+// Mode selects whether a Transport records or replays.
+type Mode int
+
+const (
+	// Record sends requests to the server and saves each exchange.
+	Record Mode = iota
+	// Replay answers requests from saved exchanges, without a server.
+	Replay
+)
+
+// ErrNotRecorded is returned in replay mode for a request without a saved exchange.
+var ErrNotRecorded = errors.New("no recorded exchange for this request")
+
+// secretParams are query parameters that carry credentials. Their values are
+// never written to a cassette nor used to match requests.
+var secretParams = []string{"key", "api_key", "apikey", "access_token"}
+
+// Request is the recorded part of a request. Headers are left out, since they
+// carry the API keys.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is the recorded part of a response.
+type Response struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Interaction is one recorded request and its response, saved as a file of its own.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Transport is an http.RoundTripper that records exchanges to Dir or replays
+// them from it. Requests are matched on their method, URL and body.
+type Transport struct {
+	Mode Mode
+	Dir  string
+	// Next sends requests in record mode; nil uses http.DefaultTransport.
+	Next http.RoundTripper
+}
+
+// FromEnv returns the Transport selected by DREAMPIPE_RECORD or
+// DREAMPIPE_REPLAY, or nil if neither is set.
+func FromEnv() (*Transport, error) {
+	record, replay := os.Getenv(RecordEnv), os.Getenv(ReplayEnv)
+	switch {
+	case record != "" && replay != "":
+		return nil, fmt.Errorf("%s and %s can't both be set", RecordEnv, ReplayEnv)
+	case record != "":
+		// Cassettes hold full prompts and responses, so only the user can read them.
+		if err := os.MkdirAll(record, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+		return &Transport{Mode: Record, Dir: record}, nil
+	case replay != "":
+		info, err := os.Stat(replay)
+		if err != nil {
+			return nil, fmt.Errorf("cassette directory %s: %w", replay, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("cassette directory %s is not a directory", replay)
+		}
+		return &Transport{Mode: Replay, Dir: replay}, nil
+	}
+	return nil, nil
+}
+
+// RoundTrip records or replays one exchange.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := Request{Method: req.Method, URL: redactURL(req.URL), Body: string(body)}
+	path := filepath.Join(t.Dir, fileName(recorded))
+
+	if t.Mode == Replay {
+		interaction, err := load(path)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Response.toHTTP(req), nil
+	}
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: Response{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        string(respBody),
+		},
+	}
+	if err := interaction.save(path); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// load reads the interaction saved at path.
+func load(path string) (*Interaction, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w (expected %s); record it with %s", ErrNotRecorded, path, RecordEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	interaction := &Interaction{}
+	if err := json.Unmarshal(data, interaction); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	return interaction, nil
+}
+
+// save writes the interaction to path.
+func (i Interaction) save(path string) error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// toHTTP turns a recorded response into the response to req.
+func (r Response) toHTTP(req *http.Request) *http.Response {
+	header := http.Header{}
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// redactURL returns u with the values of credential parameters removed.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for _, name := range secretParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// fileName names the file of a request: a readable prefix from the method and
+// path, then a hash of everything the request is matched on.
+func fileName(req Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL + "\n" + req.Body))
+	slug := req.Method
+	if u, err := url.Parse(req.URL); err == nil {
+		slug += "-" + u.Host + u.Path
+	}
+	slug = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '-'
+	}, slug)
+	return fmt.Sprintf("%s-%s.json", strings.Trim(slug, "-"), hex.EncodeToString(sum[:6]))
+}
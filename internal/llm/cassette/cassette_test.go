@@ -0,0 +1,121 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransport_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":"` + strings.ToUpper(string(body)) + `"}`))
+	}))
+	url := server.URL + "/v1/generate?key=secret-key"
+
+	send := func(client *http.Client, body string) (string, error) {
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret-token")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return string(data), err
+	}
+
+	recorder := &http.Client{Transport: &Transport{Mode: Record, Dir: dir}}
+	for _, body := range []string{"hello", "world"} {
+		if _, err := send(recorder, body); err != nil {
+			t.Fatalf("record %q: %v", body, err)
+		}
+	}
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d files, want 2", len(files))
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode = %v, want 0600", file, info.Mode().Perm())
+		}
+		data, _ := os.ReadFile(file)
+		if strings.Contains(string(data), "secret") {
+			t.Errorf("%s contains a credential:\n%s", file, data)
+		}
+	}
+
+	player := &http.Client{Transport: &Transport{Mode: Replay, Dir: dir}}
+	got, err := send(player, "world")
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if want := `{"echo":"WORLD"}`; got != want {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+	if requests != 2 {
+		t.Errorf("server saw %d requests, want 2", requests)
+	}
+
+	if _, err := send(player, "unrecorded"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("replaying an unrecorded request: error = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		record   string
+		replay   string
+		wantMode Mode
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "Neither set", wantNil: true},
+		{name: "Record", record: filepath.Join(dir, "new"), wantMode: Record},
+		{name: "Replay", replay: dir, wantMode: Replay},
+		{name: "Replay from a missing directory", replay: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "Both set", record: dir, replay: dir, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(RecordEnv, tt.record)
+			t.Setenv(ReplayEnv, tt.replay)
+			transport, err := FromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (transport == nil) != tt.wantNil {
+				t.Fatalf("FromEnv() = %v, wantNil %v", transport, tt.wantNil)
+			}
+			if transport != nil && transport.Mode != tt.wantMode {
+				t.Errorf("Mode = %v, want %v", transport.Mode, tt.wantMode)
+			}
+			if tt.record != "" {
+				if info, err := os.Stat(tt.record); err != nil {
+					t.Error(err)
+				} else if info.Mode().Perm() != 0700 {
+					t.Errorf("cassette directory mode = %v, want 0700", info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package command provides an LLM client that runs a local command for each
+// request, such as llama-cli, llm or a wrapper script, for inference tools
+// that don't speak HTTP.
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+const (
+	providerName = "command"
+	// maxStderr is how much of the command's stderr, from the end, goes into
+	// error messages.
+	maxStderr = 2000
+	// waitDelay is how long a canceled command's output may stay open, e.g.
+	// by a child process that outlives it.
+	waitDelay = 2 * time.Second
+)
+
+// Placeholders replaced in the command's arguments. With {prompt} in any
+// argument the prompt is passed there instead of on stdin.
+const (
+	PromptPlaceholder = "{prompt}"
+	ModelPlaceholder  = "{model}"
+)
+
+// Options configure the command the client runs.
+type Options struct {
+	// Name is the [llms] entry the client serves, returned by ProviderName;
+	// empty means "command".
+	Name string
+	// Command is the program and its arguments, run without a shell.
+	Command []string
+	// Timeout limits each run; the command is killed when it expires.
+	Timeout time.Duration
+}
+
+// Client implements the llm.Client interface by running a command.
+type Client struct {
+	name      string   // The [llms] entry, see Options.Name
+	path      string   // The program, found on the PATH
+	args      []string // Its arguments, with placeholders
+	modelName string
+	promptArg bool // Whether the prompt is passed as an argument
+	timeout   time.Duration
+	debug     bool
+}
+
+// NewClient creates a client running opts.Command, checking that the program
+// exists so that mistakes show up before the first request.
+func NewClient(modelOverride string, debugMode bool, opts Options) (*Client, error) {
+	if len(opts.Command) == 0 || opts.Command[0] == "" {
+		return nil, errors.New("command provider requires command, e.g. [\"llama-cli\", \"-p\", \"{prompt}\"]")
+	}
+	if opts.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid command timeout %v: must be positive", opts.Timeout)
+	}
+	path, err := exec.LookPath(opts.Command[0])
+	if err != nil {
+		return nil, fmt.Errorf("command provider: %w", err)
+	}
+
+	c := &Client{
+		name:      opts.Name,
+		path:      path,
+		args:      opts.Command[1:],
+		modelName: modelOverride,
+		timeout:   opts.Timeout,
+		debug:     debugMode,
+	}
+	if c.modelName == "" {
+		c.modelName = filepath.Base(opts.Command[0])
+	}
+	for _, arg := range c.args {
+		if strings.Contains(arg, PromptPlaceholder) {
+			c.promptArg = true
+		}
+	}
+	return c, nil
+}
+
+// Generate runs the command with prompt and returns its stdout.
+func (c *Client) Generate(ctx context.Context, prompt string) (llmtypes.Response, error) {
+	text, err := c.run(ctx, prompt)
+	if err != nil {
+		return llmtypes.Response{}, err
+	}
+	// Commands don't report token usage.
+	return llmtypes.Response{Text: text, Model: c.modelName}, nil
+}
+
+// Chat runs the command with the conversation as a transcript, ending with a
+// cue for the assistant's reply.
+func (c *Client) Chat(ctx context.Context, messages []llmtypes.Message) (llmtypes.Response, error) {
+	var transcript strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", roleLabel(m.Role), m.Content)
+	}
+	transcript.WriteString(roleLabel(llmtypes.RoleAssistant) + ":")
+	return c.Generate(ctx, transcript.String())
+}
+
+// ModelName returns the configured model, or the program's name.
+func (c *Client) ModelName() string {
+	return c.modelName
+}
+
+// RequestTimeout returns the timeout of each run, which replaces
+// request_timeout_seconds for the runs' requests.
+func (c *Client) RequestTimeout() time.Duration {
+	return c.timeout
+}
+
+// ProviderName returns the name of the [llms] entry the client serves.
+func (c *Client) ProviderName() string {
+	if c.name != "" {
+		return c.name
+	}
+	return providerName
+}
+
+// run runs the command once. A non-zero exit status fails the request with
+// the end of the command's stderr.
+func (c *Client) run(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		arg = strings.ReplaceAll(arg, ModelPlaceholder, c.modelName)
+		args[i] = strings.ReplaceAll(arg, PromptPlaceholder, prompt)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	if !c.promptArg {
+		cmd.Stdin = strings.NewReader(prompt)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = waitDelay
+	if c.debug {
+		log.Printf("Running %s for the command provider (prompt on %s)", c.path, c.promptSource())
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	if c.debug {
+		log.Printf("Command finished in %v with %d bytes of output", time.Since(start).Round(time.Millisecond), stdout.Len())
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && time.Since(start) >= c.timeout:
+		return "", fmt.Errorf("command %s timed out after %v", filepath.Base(c.path), c.timeout)
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case err != nil:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("command %s exited with status %d%s", filepath.Base(c.path), exitErr.ExitCode(), stderrSuffix(stderr.String()))
+		}
+		return "", fmt.Errorf("failed to run command %s: %w", filepath.Base(c.path), err)
+	}
+	return stdout.String(), nil
+}
+
+// promptSource says how the prompt reaches the command, for debug output.
+func (c *Client) promptSource() string {
+	if c.promptArg {
+		return "the command line"
+	}
+	return "stdin"
+}
+
+// stderrSuffix formats the end of a command's stderr for an error message.
+func stderrSuffix(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > maxStderr {
+		stderr = "..." + stderr[len(stderr)-maxStderr:]
+	}
+	return ": " + stderr
+}
+
+// roleLabel returns the transcript label of a message role.
+func roleLabel(role string) string {
+	switch role {
+	case llmtypes.RoleSystem:
+		return "System"
+	case llmtypes.RoleAssistant:
+		return "Assistant"
+	default:
+		return "User"
+	}
+}
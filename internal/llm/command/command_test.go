@@ -0,0 +1,135 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+// writeScript writes a shell script to a temporary directory and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "infer")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestClient_Generate(t *testing.T) {
+	upper := writeScript(t, "tr a-z A-Z\n")
+	echoArgs := writeScript(t, "printf '%s|' \"$@\"\n")
+
+	tests := []struct {
+		name    string
+		command []string
+		model   string
+		want    string
+	}{
+		{name: "Prompt on stdin", command: []string{upper}, want: "HELLO WORLD"},
+		{name: "Prompt as argument", command: []string{echoArgs, "-m", "{model}", "-p", "{prompt}"}, model: "tiny.gguf", want: "-m|tiny.gguf|-p|hello world|"},
+		{name: "Placeholder inside an argument", command: []string{echoArgs, "--prompt={prompt}"}, want: "--prompt=hello world|"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.model, false, Options{Command: tt.command, Timeout: 10 * time.Second})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			resp, err := client.Generate(context.Background(), "hello world")
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if resp.Text != tt.want {
+				t.Errorf("Generate() = %q, want %q", resp.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Generate_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		timeout time.Duration
+		wantErr string
+	}{
+		{name: "Exit status", body: "echo 'model file missing' >&2\nexit 2\n", timeout: 10 * time.Second, wantErr: "exited with status 2: model file missing"},
+		{name: "Timeout", body: "exec sleep 5\n", timeout: 100 * time.Millisecond, wantErr: "timed out after 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient("", false, Options{Command: []string{writeScript(t, tt.body)}, Timeout: tt.timeout})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			start := time.Now()
+			_, err = client.Generate(context.Background(), "x")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 4*time.Second {
+				t.Errorf("Generate() took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestClient_Generate_Canceled(t *testing.T) {
+	client, err := NewClient("", false, Options{Command: []string{writeScript(t, "exec sleep 5\n")}, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Generate(ctx, "x"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Generate() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestClient_Chat(t *testing.T) {
+	client, err := NewClient("", false, Options{Command: []string{"cat"}, Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	resp, err := client.Chat(context.Background(), []llmtypes.Message{
+		{Role: llmtypes.RoleSystem, Content: "Be brief."},
+		{Role: llmtypes.RoleUser, Content: "Hi"},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if want := "System: Be brief.\n\nUser: Hi\n\nAssistant:"; resp.Text != want {
+		t.Errorf("Chat() = %q, want %q", resp.Text, want)
+	}
+	if resp.Model != "cat" {
+		t.Errorf("Chat() model = %q, want the program name", resp.Model)
+	}
+}
+
+func TestNewClient_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "No command", opts: Options{Timeout: time.Second}},
+		{name: "Missing program", opts: Options{Command: []string{"no-such-dreampipe-binary"}, Timeout: time.Second}},
+		{name: "No timeout", opts: Options{Command: []string{"cat"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient("", false, tt.opts); err == nil {
+				t.Errorf("NewClient() succeeded, want an error")
+			}
+		})
+	}
+}
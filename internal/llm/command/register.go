@@ -0,0 +1,30 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+func init() {
+	llm.Register(providerName, newFromConfig)
+}
+
+// newFromConfig creates a client for an [llms] entry of type command. Its
+// timeout defaults to request_timeout_seconds.
+func newFromConfig(cfg llm.ProviderConfig) (llm.Client, error) {
+	timeout := time.Duration(cfg.RequestTimeoutSeconds) * time.Second
+	if s := cfg.String("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q for %s: must be a duration such as \"5m\"", s, cfg.Name)
+		}
+		timeout = d
+	}
+	return NewClient(cfg.String("model"), cfg.Debug, Options{
+		Name:    cfg.Name,
+		Command: cfg.Strings("command"),
+		Timeout: timeout,
+	})
+}
@@ -2,13 +2,13 @@
 package llm
 
 import (
-	"context" // Required for Gemini client initialization
 	"fmt"
+	"log"
+	"os/exec"
+	"strings"
 
-	"github.com/hiway/dreampipe/internal/config"     // Adjust import path
-	"github.com/hiway/dreampipe/internal/llm/gemini" // Adjust import path
-	"github.com/hiway/dreampipe/internal/llm/groq"   // Adjust import path - ADDED
-	"github.com/hiway/dreampipe/internal/llm/ollama" // Adjust import path
+	"github.com/hiway/dreampipe/internal/config" // Adjust import path
+	"github.com/hiway/dreampipe/internal/llm/cassette"
 )
 
 // GetClient is a factory function that returns an LLM client based on the
@@ -19,9 +19,23 @@ var GetClient func(cfg config.Config, debugMode bool) (Client, error) = func(cfg
 	if providerName == "" {
 		return nil, fmt.Errorf("no default LLM provider specified in configuration")
 	}
+	return NewProviderClient(cfg, providerName, debugMode)
+}
+
+// NewProviderClient returns a client for the named provider using its entry in cfg,
+// regardless of which provider is the default. The entry's type, or its name,
+// selects a registered provider; otherwise an exec plugin serves it, when the
+// entry sets type or plugin.
+func NewProviderClient(cfg config.Config, providerName string, debugMode bool) (Client, error) {
+	return newProviderClient(cfg, providerName, debugMode, "")
+}
 
+// newProviderClient is NewProviderClient with the entry's API key, when the
+// caller has already resolved it, so api_key_cmd doesn't run again.
+func newProviderClient(cfg config.Config, providerName string, debugMode bool, apiKey string) (Client, error) {
+	// A registered provider works without an entry, from its defaults.
 	llmCfg, exists := cfg.LLMs[providerName]
-	if !exists {
+	if _, registered := lookupConstructor(providerName); !exists && !registered {
 		return nil, fmt.Errorf("configuration for provider '%s' not found", providerName)
 	}
 
@@ -30,23 +44,77 @@ var GetClient func(cfg config.Config, debugMode bool) (Client, error) = func(cfg
 		requestTimeout = 60 // Default to 60 seconds if not set or invalid
 	}
 
-	switch providerName {
-	case "gemini":
-		if llmCfg.APIKey == "" {
-			return nil, fmt.Errorf("API key for Gemini not found in configuration")
+	// DREAMPIPE_RECORD and DREAMPIPE_REPLAY route the provider's HTTP requests
+	// through a cassette.
+	transport, err := cassette.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	providerCfg := ProviderConfig{
+		Name:                  providerName,
+		Settings:              cfg.ProviderSettings(providerName),
+		RequestTimeoutSeconds: requestTimeout,
+		Debug:                 debugMode,
+		resolvedAPIKey:        apiKey,
+	}
+	if transport != nil {
+		providerCfg.Transport = transport
+		providerCfg.Replaying = transport.Mode == cassette.Replay
+		if debugMode {
+			log.Printf("Cassette mode for %s: %s", providerName, describeCassette(transport))
 		}
-		return gemini.NewClient(context.Background(), llmCfg.APIKey, llmCfg.Model, debugMode)
-	case "ollama":
-		if llmCfg.BaseURL == "" {
-			return nil, fmt.Errorf("base URL for Ollama not found in configuration")
+	}
+
+	providerType := ProviderType(providerName, llmCfg)
+	if llmCfg.Plugin == "" {
+		if constructor, ok := lookupConstructor(providerType); ok {
+			return constructor(providerCfg)
 		}
-		return ollama.NewClient(llmCfg.BaseURL, llmCfg.Model, requestTimeout, debugMode)
-	case "groq":
-		if llmCfg.APIKey == "" {
-			return nil, fmt.Errorf("API key for Groq not found in configuration")
+		// A plugin runs a program, so only an entry that asks for one with
+		// type or plugin gets one; a misspelt name fails instead of running
+		// whatever is on the PATH under that name.
+		if llmCfg.Type == "" {
+			return nil, fmt.Errorf("unknown provider: %s (available: %s, or set type = %q to use a %s%s plugin on PATH)",
+				providerName, strings.Join(Providers(), ", "), providerName, PluginPrefix, providerName)
 		}
-		return groq.NewClient(llmCfg.APIKey, llmCfg.Model, requestTimeout, debugMode)
-	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s", providerName)
 	}
+	pluginPath, err := findPlugin(providerType, llmCfg.PluginPath())
+	if err != nil && llmCfg.Plugin != "" {
+		return nil, fmt.Errorf("plugin for provider %s: %w", providerName, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unsupported LLM provider: %s (available: %s, or a %s%s plugin on PATH)",
+			providerType, strings.Join(Providers(), ", "), PluginPrefix, providerType)
+	}
+	if debugMode {
+		log.Printf("Using plugin %s for %s", pluginPath, providerName)
+	}
+	return newPluginClient(pluginPath, providerCfg), nil
+}
+
+// ProviderType returns the registered provider or plugin an entry uses: its
+// type, or its name when it has none.
+func ProviderType(name string, llmCfg config.LLMConfig) string {
+	if llmCfg.Type != "" {
+		return llmCfg.Type
+	}
+	return name
+}
+
+// findPlugin returns the program serving providerType: plugin when set,
+// otherwise dreampipe-provider-<type> on the PATH. Callers check that the
+// entry asked for a plugin.
+func findPlugin(providerType, plugin string) (string, error) {
+	if plugin != "" {
+		return exec.LookPath(plugin)
+	}
+	return exec.LookPath(PluginPrefix + providerType)
+}
+
+// describeCassette says what a cassette transport does, for debug output.
+func describeCassette(t *cassette.Transport) string {
+	if t.Mode == cassette.Replay {
+		return "replaying from " + t.Dir
+	}
+	return "recording to " + t.Dir
 }
@@ -5,9 +5,14 @@ import (
 	"context"
 	"fmt"
 	"log" // For logging initialization errors if needed
+	"net/http"
+	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
 )
 
 const (
@@ -17,20 +22,50 @@ const (
 
 // Client implements the llm.Client interface for Gemini.
 type Client struct {
+	name        string // The [llms] entry, see Options.Name
 	genaiClient *genai.Client
 	modelName   string
 }
 
+// Options are optional Gemini-specific settings.
+type Options struct {
+	// Name is the [llms] entry the client serves, returned by ProviderName;
+	// empty means "gemini".
+	Name string
+	// Transport sends the HTTP requests; nil uses the SDK's default client.
+	Transport http.RoundTripper
+}
+
+// apiKeyTransport adds the API key to each request. The SDK only adds it
+// itself when it creates the HTTP client.
+type apiKeyTransport struct {
+	apiKey string
+	next   http.RoundTripper
+}
+
+// RoundTrip sends req with the API key header set.
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.next.RoundTrip(req)
+}
+
 // NewClient creates a new Gemini client.
 // It requires a context for initialization (can be context.Background()),
 // the API key, an optional model name (defaults to gemini-1.5-flash-latest),
 // and a debugMode flag.
-func NewClient(ctx context.Context, apiKey string, modelOverride string, debugMode bool) (*Client, error) {
+func NewClient(ctx context.Context, apiKey string, modelOverride string, debugMode bool, opts Options) (*Client, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("Gemini API key is required")
 	}
 
-	genaiClient, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if opts.Transport != nil {
+		clientOpts = append(clientOpts, option.WithHTTPClient(&http.Client{
+			Transport: &apiKeyTransport{apiKey: apiKey, next: opts.Transport},
+		}))
+	}
+	genaiClient, err := genai.NewClient(ctx, clientOpts...)
 	if err != nil {
 		// This log is more of a system/developer error, so keep it for now, or make it debug conditional too.
 		// For now, let's assume it's important enough to always show if client creation fails.
@@ -51,28 +86,69 @@ func NewClient(ctx context.Context, apiKey string, modelOverride string, debugMo
 	}
 
 	return &Client{
+		name:        opts.Name,
 		genaiClient: genaiClient,
 		modelName:   modelToUse,
 	}, nil
 }
 
-// Generate sends the prompt to the Gemini model and returns the text response.
-func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
+// Generate sends the prompt to the Gemini model and returns the text response and token usage.
+func (c *Client) Generate(ctx context.Context, prompt string) (llmtypes.Response, error) {
 	if c.genaiClient == nil {
-		return "", fmt.Errorf("Gemini client not initialized")
+		return llmtypes.Response{}, fmt.Errorf("Gemini client not initialized")
 	}
 
 	model := c.genaiClient.GenerativeModel(c.modelName)
 	if model == nil {
-		return "", fmt.Errorf("failed to get generative model: %s", c.modelName)
+		return llmtypes.Response{}, fmt.Errorf("failed to get generative model: %s", c.modelName)
 	}
 
 	// Simple text generation
 	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
 	if err != nil {
-		return "", fmt.Errorf("failed to generate content from Gemini: %w. [2, 7]", err)
+		return llmtypes.Response{}, fmt.Errorf("failed to generate content from Gemini: %w. [2, 7]", err)
 	}
+	return c.toResponse(resp)
+}
 
+// Chat sends a conversation to the Gemini model and returns the next reply and token usage.
+// A leading system message becomes the model's system instruction, and earlier
+// turns become the chat history.
+func (c *Client) Chat(ctx context.Context, messages []llmtypes.Message) (llmtypes.Response, error) {
+	if c.genaiClient == nil {
+		return llmtypes.Response{}, fmt.Errorf("Gemini client not initialized")
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role != llmtypes.RoleUser {
+		return llmtypes.Response{}, fmt.Errorf("Gemini chat must end with a user message")
+	}
+
+	model := c.genaiClient.GenerativeModel(c.modelName)
+	if model == nil {
+		return llmtypes.Response{}, fmt.Errorf("failed to get generative model: %s", c.modelName)
+	}
+	if messages[0].Role == llmtypes.RoleSystem {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(messages[0].Content))
+		messages = messages[1:]
+	}
+
+	session := model.StartChat()
+	for _, m := range messages[:len(messages)-1] {
+		role := "user"
+		if m.Role == llmtypes.RoleAssistant {
+			role = "model" // Gemini's name for the assistant role
+		}
+		session.History = append(session.History, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(m.Content)}})
+	}
+
+	resp, err := session.SendMessage(ctx, genai.Text(messages[len(messages)-1].Content))
+	if err != nil {
+		return llmtypes.Response{}, fmt.Errorf("failed to generate content from Gemini: %w", err)
+	}
+	return c.toResponse(resp)
+}
+
+// toResponse extracts the text and token usage from a Gemini response.
+func (c *Client) toResponse(resp *genai.GenerateContentResponse) (llmtypes.Response, error) {
 	// Extract text from the response.
 	// The response can have multiple candidates, we'll use the first one.
 	// Each candidate can have multiple parts, we'll concatenate text parts.
@@ -80,12 +156,12 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 		// Check for blocked prompt/response
 		if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason == genai.FinishReasonSafety {
 			// You could inspect resp.Candidates[0].SafetyRatings for more details
-			return "", fmt.Errorf("Gemini content generation blocked due to safety settings. [7]")
+			return llmtypes.Response{}, fmt.Errorf("Gemini content generation blocked due to safety settings. [7]")
 		}
 		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
-			return "", fmt.Errorf("Gemini prompt blocked: %s. [2]", resp.PromptFeedback.BlockReason.String())
+			return llmtypes.Response{}, fmt.Errorf("Gemini prompt blocked: %s. [2]", resp.PromptFeedback.BlockReason.String())
 		}
-		return "", fmt.Errorf("Gemini response was empty or malformed. [2, 6]")
+		return llmtypes.Response{}, fmt.Errorf("Gemini response was empty or malformed. [2, 6]")
 	}
 
 	var resultText string
@@ -103,14 +179,54 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 
 	if resultText == "" {
 		// This might happen if the response only contained non-text parts or was genuinely empty.
-		return "", fmt.Errorf("Gemini response contained no usable text content")
+		return llmtypes.Response{}, fmt.Errorf("Gemini response contained no usable text content")
+	}
+
+	result := llmtypes.Response{Text: resultText, Model: c.modelName}
+	if resp.UsageMetadata != nil {
+		result.Usage = llmtypes.Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+			TotalTokens:      int(resp.UsageMetadata.TotalTokenCount),
+		}
 	}
+	return result, nil
+}
 
-	return resultText, nil
+// ListModels returns the models available to the configured API key.
+func (c *Client) ListModels(ctx context.Context) ([]llmtypes.ModelInfo, error) {
+	if c.genaiClient == nil {
+		return nil, fmt.Errorf("Gemini client not initialized")
+	}
+	var models []llmtypes.ModelInfo
+	it := c.genaiClient.ListModels(ctx)
+	for {
+		m, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Gemini models: %w", err)
+		}
+		models = append(models, llmtypes.ModelInfo{
+			Name:          strings.TrimPrefix(m.Name, "models/"),
+			ContextWindow: int(m.InputTokenLimit),
+			Capabilities:  m.SupportedGenerationMethods,
+		})
+	}
+	return models, nil
+}
+
+// ModelName returns the model this client sends requests to.
+func (c *Client) ModelName() string {
+	return c.modelName
 }
 
-// ProviderName returns the name of this provider.
+// ProviderName returns the name of the [llms] entry the client serves.
 func (c *Client) ProviderName() string {
+	if c.name != "" {
+		return c.name
+	}
 	return providerName
 }
 
@@ -0,0 +1,124 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtest"
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+// replyFor answers req the way the API does: the streaming endpoint, which
+// chat sessions use, returns a JSON array of responses.
+func replyFor(req *http.Request, body string) *http.Response {
+	if strings.HasSuffix(req.URL.Path, ":streamGenerateContent") {
+		body = "[" + body + "]"
+	}
+	return llmtest.Reply(http.StatusOK, body)
+}
+
+// geminiRequest is the part of a generateContent request the tests check.
+type geminiRequest struct {
+	Contents []struct {
+		Role  string `json:"role"`
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	} `json:"contents"`
+	SystemInstruction *struct {
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	} `json:"systemInstruction"`
+}
+
+const geminiReply = `{
+	"candidates": [{"content": {"role": "model", "parts": [{"text": "Bonjour"}]}, "finishReason": 1}],
+	"usageMetadata": {"promptTokenCount": 9, "candidatesTokenCount": 2, "totalTokenCount": 11}
+}`
+
+func TestClient_Generate(t *testing.T) {
+	var gotPath, gotKey string
+	var gotReq geminiRequest
+	transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gotPath = req.URL.Path
+		gotKey = req.Header.Get("x-goog-api-key")
+		json.NewDecoder(req.Body).Decode(&gotReq)
+		return replyFor(req, geminiReply), nil
+	})
+
+	client, err := NewClient(context.Background(), "test-key", "gemini-test", false, Options{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	resp, err := client.Generate(context.Background(), "Say hello in French")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if !strings.HasSuffix(gotPath, "/models/gemini-test:generateContent") {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotKey != "test-key" {
+		t.Errorf("x-goog-api-key = %q, want test-key", gotKey)
+	}
+	if len(gotReq.Contents) != 1 || gotReq.Contents[0].Parts[0].Text != "Say hello in French" {
+		t.Errorf("request contents = %+v", gotReq.Contents)
+	}
+	want := llmtypes.Response{Text: "Bonjour", Model: "gemini-test", Usage: llmtypes.Usage{PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11}}
+	if resp != want {
+		t.Errorf("Generate() = %+v, want %+v", resp, want)
+	}
+}
+
+// TestClient_Chat checks the request a conversation is sent as. Chat sessions
+// read the reply as a stream, which gax can't parse with the encoding/json of
+// GOEXPERIMENT=jsonv2 toolchains, so the reply isn't checked here.
+func TestClient_Chat(t *testing.T) {
+	var gotReq geminiRequest
+	transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		json.NewDecoder(req.Body).Decode(&gotReq)
+		return replyFor(req, geminiReply), nil
+	})
+
+	client, err := NewClient(context.Background(), "test-key", "gemini-test", false, Options{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	client.Chat(context.Background(), []llmtypes.Message{
+		{Role: llmtypes.RoleSystem, Content: "Translate to French."},
+		{Role: llmtypes.RoleUser, Content: "Hello"},
+		{Role: llmtypes.RoleAssistant, Content: "Bonjour"},
+		{Role: llmtypes.RoleUser, Content: "Goodbye"},
+	})
+
+	if gotReq.SystemInstruction == nil || gotReq.SystemInstruction.Parts[0].Text != "Translate to French." {
+		t.Errorf("system instruction = %+v", gotReq.SystemInstruction)
+	}
+	var roles []string
+	for _, c := range gotReq.Contents {
+		roles = append(roles, c.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,model,user" {
+		t.Errorf("content roles = %s, want user,model,user", got)
+	}
+}
+
+func TestClient_Generate_Blocked(t *testing.T) {
+	transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return replyFor(req, `{"promptFeedback": {"blockReason": 1}}`), nil
+	})
+	client, err := NewClient(context.Background(), "test-key", "gemini-test", false, Options{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Generate(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("Generate() error = %v, want a blocked prompt error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+func init() {
+	llm.Register(providerName, newFromConfig)
+}
+
+// newFromConfig creates a client for an [llms] entry of type gemini.
+func newFromConfig(cfg llm.ProviderConfig) (llm.Client, error) {
+	apiKey, err := cfg.APIKey()
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key for Gemini not found in configuration")
+	}
+	return NewClient(context.Background(), apiKey, cfg.String("model"), cfg.Debug, Options{Name: cfg.Name, Transport: cfg.Transport})
+}
@@ -11,23 +11,36 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
 )
 
 const (
 	defaultGroqModel = "llama3-8b-8192" // A common default, user can override
 	providerName     = "groq"
 	groqAPIEndpoint  = "https://api.groq.com/openai/v1/chat/completions"
+	groqModelsURL    = "https://api.groq.com/openai/v1/models"
 	maxRetries       = 1 // Simple retry for transient network issues, can be configured
 	retryDelay       = 1 * time.Second
 )
 
 // Client implements the llm.Client interface for Groq.
 type Client struct {
+	name       string // The [llms] entry, see Options.Name
 	httpClient *http.Client
 	apiKey     string
 	modelName  string
 }
 
+// Options are optional Groq-specific settings.
+type Options struct {
+	// Name is the [llms] entry the client serves, returned by ProviderName;
+	// empty means "groq".
+	Name string
+	// Transport sends the HTTP requests; nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
 // groqChatMessage represents a single message in the chat completion request.
 type groqChatMessage struct {
 	Role    string `json:"role"`
@@ -85,7 +98,7 @@ type groqChatCompletionResponse struct {
 
 // NewClient creates a new Groq client.
 // debugMode controls verbose logging.
-func NewClient(apiKey string, modelOverride string, requestTimeoutSeconds int, debugMode bool) (*Client, error) {
+func NewClient(apiKey string, modelOverride string, requestTimeoutSeconds int, debugMode bool, opts Options) (*Client, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("groq API key is required")
 	}
@@ -103,19 +116,21 @@ func NewClient(apiKey string, modelOverride string, requestTimeoutSeconds int, d
 	}
 
 	return &Client{
+		name: opts.Name,
 		httpClient: &http.Client{
-			Timeout: time.Duration(requestTimeoutSeconds) * time.Second,
+			Timeout:   time.Duration(requestTimeoutSeconds) * time.Second,
+			Transport: opts.Transport,
 		},
 		apiKey:    apiKey,
 		modelName: modelToUse,
 	}, nil
 }
 
-// Generate sends the prompt to the Groq model and returns the text response.
+// Generate sends the prompt to the Groq model and returns the text response and token usage.
 // For Groq's chat completion, we need to adapt our single prompt into a user message.
-func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
+func (c *Client) Generate(ctx context.Context, prompt string) (llmtypes.Response, error) {
 	if c.httpClient == nil {
-		return "", fmt.Errorf("groq client not initialized")
+		return llmtypes.Response{}, fmt.Errorf("groq client not initialized")
 	}
 
 	// Groq's chat completion API expects a list of messages.
@@ -129,8 +144,19 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 	// If better results are achieved by separating system/user roles, `prompt.Build` and this section
 	// would need adjustment.
 
-	messages := []groqChatMessage{
-		{Role: "user", Content: prompt},
+	return c.Chat(ctx, []llmtypes.Message{{Role: llmtypes.RoleUser, Content: prompt}})
+}
+
+// Chat sends a conversation to the Groq model and returns the next reply and token usage.
+// Groq's roles match dreampipe's, so messages are sent as they are.
+func (c *Client) Chat(ctx context.Context, conversation []llmtypes.Message) (llmtypes.Response, error) {
+	if c.httpClient == nil {
+		return llmtypes.Response{}, fmt.Errorf("groq client not initialized")
+	}
+
+	messages := make([]groqChatMessage, 0, len(conversation))
+	for _, m := range conversation {
+		messages = append(messages, groqChatMessage{Role: m.Role, Content: m.Content})
 	}
 
 	payload := groqChatCompletionRequest{
@@ -142,7 +168,7 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal Groq request payload: %w", err)
+		return llmtypes.Response{}, fmt.Errorf("failed to marshal Groq request payload: %w", err)
 	}
 
 	var resp *http.Response
@@ -151,7 +177,7 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 	for i := 0; i <= maxRetries; i++ {
 		req, reqErr := http.NewRequestWithContext(ctx, "POST", groqAPIEndpoint, bytes.NewBuffer(payloadBytes))
 		if reqErr != nil {
-			return "", fmt.Errorf("failed to create Groq request: %w", reqErr)
+			return llmtypes.Response{}, fmt.Errorf("failed to create Groq request: %w", reqErr)
 		}
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 		req.Header.Set("Content-Type", "application/json")
@@ -165,7 +191,7 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 		if respErr != nil {
 			lastErr = fmt.Errorf("failed to send request to Groq API: %w", respErr)
 			if ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded {
-				return "", lastErr // Don't retry on context errors
+				return llmtypes.Response{}, lastErr // Don't retry on context errors
 			}
 			log.Printf("Groq request attempt %d failed: %v. Retrying in %v...", i+1, respErr, retryDelay)
 			time.Sleep(retryDelay)
@@ -175,29 +201,29 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 		break
 	}
 	if lastErr != nil { // This means all retries failed
-		return "", lastErr
+		return llmtypes.Response{}, lastErr
 	}
 	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read Groq response body: %w", err)
+		return llmtypes.Response{}, fmt.Errorf("failed to read Groq response body: %w", err)
 	}
 
 	var groqResp groqChatCompletionResponse
 	if err := json.Unmarshal(responseBody, &groqResp); err != nil {
 		// Include raw response for debugging if JSON parsing fails
-		return "", fmt.Errorf("failed to unmarshal Groq response JSON: %w. Status: %s, Body: %s", err, resp.Status, string(responseBody))
+		return llmtypes.Response{}, fmt.Errorf("failed to unmarshal Groq response JSON: %w. Status: %s, Body: %s", err, resp.Status, string(responseBody))
 	}
 
 	// Check for API-level errors returned in the JSON body
 	if groqResp.Error != nil {
-		return "", fmt.Errorf("groq API error: %s (Type: %s, Code: %s). HTTP Status: %s", groqResp.Error.Message, groqResp.Error.Type, groqResp.Error.Code, resp.Status)
+		return llmtypes.Response{}, fmt.Errorf("groq API error: %s (Type: %s, Code: %s). HTTP Status: %s", groqResp.Error.Message, groqResp.Error.Type, groqResp.Error.Code, resp.Status)
 	}
 
 	// Check HTTP status code after checking for JSON error, as JSON error might be more specific
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("groq API request failed with status %s. Body: %s", resp.Status, string(responseBody))
+		return llmtypes.Response{}, fmt.Errorf("groq API request failed with status %s. Body: %s", resp.Status, string(responseBody))
 	}
 
 	if len(groqResp.Choices) == 0 || groqResp.Choices[0].Message.Content == "" {
@@ -211,14 +237,83 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 				return "N/A"
 			}(),
 			groqResp.Usage)
-		return "", fmt.Errorf("groq response contained no choices or empty message content. HTTP Status: %s", resp.Status)
+		return llmtypes.Response{}, fmt.Errorf("groq response contained no choices or empty message content. HTTP Status: %s", resp.Status)
+	}
+
+	return llmtypes.Response{
+		Text:  strings.TrimSpace(groqResp.Choices[0].Message.Content),
+		Model: groqResp.Model,
+		Usage: llmtypes.Usage{
+			PromptTokens:     groqResp.Usage.PromptTokens,
+			CompletionTokens: groqResp.Usage.CompletionTokens,
+			TotalTokens:      groqResp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// groqModelsResponse is the structure for the response from Groq's OpenAI-style /models endpoint.
+type groqModelsResponse struct {
+	Data []struct {
+		ID            string `json:"id"`
+		ContextWindow int    `json:"context_window"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// ListModels returns the models available to the configured API key.
+func (c *Client) ListModels(ctx context.Context) ([]llmtypes.ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", groqModelsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Groq request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Groq API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Groq response body: %w", err)
+	}
+	var modelsResp groqModelsResponse
+	if err := json.Unmarshal(responseBody, &modelsResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Groq models JSON: %w. Status: %s", err, resp.Status)
+	}
+	if modelsResp.Error != nil {
+		return nil, fmt.Errorf("groq API error: %s. HTTP Status: %s", modelsResp.Error.Message, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("groq API request failed with status %s", resp.Status)
 	}
 
-	return strings.TrimSpace(groqResp.Choices[0].Message.Content), nil
+	models := make([]llmtypes.ModelInfo, 0, len(modelsResp.Data))
+	for _, m := range modelsResp.Data {
+		// Groq doesn't report capabilities; its Whisper models only transcribe audio.
+		capability := "completion"
+		if strings.Contains(m.ID, "whisper") {
+			capability = "transcription"
+		}
+		models = append(models, llmtypes.ModelInfo{Name: m.ID, ContextWindow: m.ContextWindow, Capabilities: []string{capability}})
+	}
+	return models, nil
+}
+
+// ModelName returns the model this client sends requests to.
+func (c *Client) ModelName() string {
+	return c.modelName
 }
 
-// ProviderName returns the name of this provider.
+// ProviderName returns the name of the [llms] entry the client serves.
 func (c *Client) ProviderName() string {
+	if c.name != "" {
+		return c.name
+	}
 	return providerName
 }
 
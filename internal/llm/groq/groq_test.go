@@ -0,0 +1,107 @@
+package groq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtest"
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+func TestClient_Chat(t *testing.T) {
+	var gotReq groqChatCompletionRequest
+	var gotAuth, gotURL string
+	transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gotURL = req.URL.String()
+		gotAuth = req.Header.Get("Authorization")
+		json.NewDecoder(req.Body).Decode(&gotReq)
+		return llmtest.Reply(http.StatusOK, `{
+			"id": "chatcmpl-1",
+			"model": "llama3-8b-8192",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "  Bonjour  "}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+		}`), nil
+	})
+
+	client, err := NewClient("test-key", "", 5, false, Options{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	resp, err := client.Chat(context.Background(), []llmtypes.Message{
+		{Role: llmtypes.RoleSystem, Content: "Translate to French."},
+		{Role: llmtypes.RoleUser, Content: "Hello"},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if gotURL != groqAPIEndpoint {
+		t.Errorf("URL = %q, want %q", gotURL, groqAPIEndpoint)
+	}
+	if gotAuth != "Bearer test-key" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if gotReq.Model != defaultGroqModel || gotReq.Stream {
+		t.Errorf("request model = %q, stream = %v", gotReq.Model, gotReq.Stream)
+	}
+	if len(gotReq.Messages) != 2 || gotReq.Messages[0].Role != "system" || gotReq.Messages[1].Content != "Hello" {
+		t.Errorf("request messages = %+v", gotReq.Messages)
+	}
+	want := llmtypes.Response{Text: "Bonjour", Model: "llama3-8b-8192", Usage: llmtypes.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}}
+	if resp != want {
+		t.Errorf("Chat() = %+v, want %+v", resp, want)
+	}
+}
+
+func TestClient_Generate_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "API error", status: http.StatusUnauthorized, body: `{"error":{"message":"Invalid API Key","type":"invalid_request_error","code":"invalid_api_key"}}`, wantErr: "Invalid API Key"},
+		{name: "Status without error body", status: http.StatusServiceUnavailable, body: `{}`, wantErr: "status"},
+		{name: "No choices", status: http.StatusOK, body: `{"choices":[]}`, wantErr: "no choices"},
+		{name: "Not JSON", status: http.StatusBadGateway, body: `<html>bad gateway</html>`, wantErr: "unmarshal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return llmtest.Reply(tt.status, tt.body), nil
+			})
+			client, err := NewClient("test-key", "", 5, false, Options{Transport: transport})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			_, err = client.Generate(context.Background(), "hi")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_ListModels(t *testing.T) {
+	transport := llmtest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != groqModelsURL {
+			t.Errorf("URL = %q, want %q", req.URL, groqModelsURL)
+		}
+		return llmtest.Reply(http.StatusOK, `{"data":[{"id":"llama3-70b-8192","context_window":8192},{"id":"whisper-large-v3","context_window":448}]}`), nil
+	})
+	client, err := NewClient("test-key", "", 5, false, Options{Transport: transport})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0].ContextWindow != 8192 || models[1].Capabilities[0] != "transcription" {
+		t.Errorf("ListModels() = %+v", models)
+	}
+}
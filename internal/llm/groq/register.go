@@ -0,0 +1,23 @@
+package groq
+
+import (
+	"fmt"
+
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+func init() {
+	llm.Register(providerName, newFromConfig)
+}
+
+// newFromConfig creates a client for an [llms] entry of type groq.
+func newFromConfig(cfg llm.ProviderConfig) (llm.Client, error) {
+	apiKey, err := cfg.APIKey()
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key for Groq not found in configuration")
+	}
+	return NewClient(apiKey, cfg.String("model"), cfg.RequestTimeoutSeconds, cfg.Debug, Options{Name: cfg.Name, Transport: cfg.Transport})
+}
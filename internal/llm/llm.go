@@ -3,12 +3,57 @@ package llm
 
 import (
 	"context"
+	"io"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
 )
 
 // Client is the interface that all LLM provider clients must implement.
 type Client interface {
-	// Generate takes a context and a prompt string and returns the LLM's response string.
-	Generate(ctx context.Context, prompt string) (string, error)
-	// ProviderName returns the name of the LLM provider (e.g., "gemini", "ollama").
+	// Generate takes a context and a prompt string and returns the LLM's response
+	// along with the token usage reported by the provider.
+	Generate(ctx context.Context, prompt string) (Response, error)
+	// Chat sends a conversation and returns the model's next reply. Messages
+	// alternate between RoleUser and RoleAssistant, optionally preceded by a
+	// RoleSystem message, and end with a RoleUser message.
+	Chat(ctx context.Context, messages []Message) (Response, error)
+	// ProviderName returns the name of the [llms] entry the client serves,
+	// e.g. "ollama" or "gpu-box", which limits and usage are kept under.
 	ProviderName() string
 }
+
+// TimeoutClient is implemented by clients that set their own limit for each
+// request, such as local commands, which can take far longer than an HTTP
+// API. It replaces request_timeout_seconds for their requests.
+type TimeoutClient interface {
+	RequestTimeout() time.Duration
+}
+
+// WithTokenProgress returns a context asking clients that stream responses,
+// such as Ollama's, to report the tokens received so far to progress.
+func WithTokenProgress(ctx context.Context, progress func(tokens int)) context.Context {
+	return llmtypes.WithTokenProgress(ctx, progress)
+}
+
+// WithProgressWriter returns a context asking clients to write messages about
+// slow preparation, such as Ollama pulling a model, to w.
+func WithProgressWriter(ctx context.Context, w io.Writer) context.Context {
+	return llmtypes.WithProgressWriter(ctx, w)
+}
+
+// Response is the result of a single Generate call.
+type Response = llmtypes.Response
+
+// Message is one turn of a multi-turn conversation.
+type Message = llmtypes.Message
+
+// Roles of the messages in a conversation.
+const (
+	RoleSystem    = llmtypes.RoleSystem
+	RoleUser      = llmtypes.RoleUser
+	RoleAssistant = llmtypes.RoleAssistant
+)
+
+// Usage holds the token counts reported by a provider for one request.
+type Usage = llmtypes.Usage
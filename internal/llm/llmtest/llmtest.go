@@ -0,0 +1,26 @@
+// Package llmtest provides helpers for testing provider clients without a
+// network.
+package llmtest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RoundTripFunc serves requests without a network.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Reply returns a JSON response with the given status and body.
+func Reply(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
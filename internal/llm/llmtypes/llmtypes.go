@@ -0,0 +1,79 @@
+// Package llmtypes holds the types shared between the llm package and the
+// provider packages. It keeps the provider clients independent of llm, which
+// only their registration imports.
+package llmtypes
+
+import (
+	"context"
+	"io"
+)
+
+// Response is the result of a single Generate call.
+type Response struct {
+	Text  string // The generated text
+	Model string // The model that produced the response
+	Usage Usage  // Token usage reported by the provider, zero if unavailable
+}
+
+// Roles of the messages in a conversation.
+const (
+	RoleSystem    = "system"    // Instructions and data that frame the whole conversation
+	RoleUser      = "user"      // What the user asked
+	RoleAssistant = "assistant" // What the model answered
+)
+
+// Message is one turn of a multi-turn conversation.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Usage holds the token counts reported by a provider for one request.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// IsZero reports whether the provider returned no usage information.
+func (u Usage) IsZero() bool {
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0
+}
+
+// ModelInfo describes a model offered by a provider.
+type ModelInfo struct {
+	Name          string   // The name to use as `model` in the configuration
+	ContextWindow int      // Context size in tokens, zero if the provider does not report it
+	Capabilities  []string // e.g. "completion", "vision", "embedding"; empty if unknown
+}
+
+// tokenProgressKey is the context key of the WithTokenProgress callback.
+type tokenProgressKey struct{}
+
+// WithTokenProgress returns a context asking clients that can stream a
+// response to do so, calling progress with the number of tokens received so
+// far. The response is still returned whole.
+func WithTokenProgress(ctx context.Context, progress func(tokens int)) context.Context {
+	return context.WithValue(ctx, tokenProgressKey{}, progress)
+}
+
+// TokenProgress returns the callback set by WithTokenProgress, or nil.
+func TokenProgress(ctx context.Context) func(tokens int) {
+	progress, _ := ctx.Value(tokenProgressKey{}).(func(tokens int))
+	return progress
+}
+
+// progressWriterKey is the context key of the WithProgressWriter writer.
+type progressWriterKey struct{}
+
+// WithProgressWriter returns a context asking clients to write messages about
+// slow preparation, such as pulling a model, to w.
+func WithProgressWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, progressWriterKey{}, w)
+}
+
+// ProgressWriter returns the writer set by WithProgressWriter, or nil.
+func ProgressWriter(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(progressWriterKey{}).(io.Writer)
+	return w
+}
@@ -0,0 +1,256 @@
+// Package mock provides a deterministic LLM client that answers without a
+// model, for developing and testing pipelines offline.
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+const (
+	providerName     = "mock"
+	defaultMockModel = "mock"
+	// inputHeading introduces the input in prompts built by the prompt package.
+	inputHeading = "\n\n---\n\nInput:\n\n"
+)
+
+// Modes select how the client answers.
+const (
+	ModeEcho     = "echo"     // Return the input part of the prompt
+	ModePrompt   = "prompt"   // Return the whole prompt
+	ModeFile     = "file"     // Return the contents of a file
+	ModeRules    = "rules"    // Return the response of the first matching rule
+	ModeSequence = "sequence" // Return the responses in turn, starting over after the last
+)
+
+// ErrSimulated is wrapped by the errors the client is configured to return.
+var ErrSimulated = errors.New("simulated mock error")
+
+// Rule answers prompts matching Pattern with Response, in which $1 or ${name}
+// expand to the groups of the match, or fails them with Error.
+type Rule struct {
+	Pattern  string
+	Response string
+	Error    string
+}
+
+// Options configure the answers of the client.
+type Options struct {
+	// Name is the [llms] entry the client serves, returned by ProviderName;
+	// empty means "mock".
+	Name         string
+	Mode         string // One of the Mode* constants; empty means ModeEcho
+	ResponseFile string // Read once, for ModeFile
+	Responses    []string
+	Rules        []Rule
+	// Latency is a delay before each answer, cut short when the request is canceled.
+	Latency string
+	// Error fails requests with this message: every request, or every
+	// FailEvery-th one when FailEvery is set.
+	Error     string
+	FailEvery int
+}
+
+// compiledRule is a Rule with its pattern compiled.
+type compiledRule struct {
+	re       *regexp.Regexp
+	response string
+	err      string
+}
+
+// Client implements the llm.Client interface without a model.
+type Client struct {
+	name      string // The [llms] entry, see Options.Name
+	modelName string
+	mode      string
+	fixed     string // The file contents in ModeFile
+	responses []string
+	rules     []compiledRule
+	latency   time.Duration
+	errorText string
+	failEvery int
+
+	mu       sync.Mutex
+	requests int // Requests answered so far, for FailEvery and ModeSequence
+}
+
+// NewClient creates a mock client, checking opts up front so that mistakes
+// show up before the first request.
+func NewClient(modelOverride string, debugMode bool, opts Options) (*Client, error) {
+	c := &Client{
+		name:      opts.Name,
+		modelName: defaultMockModel,
+		mode:      opts.Mode,
+		responses: opts.Responses,
+		errorText: opts.Error,
+		failEvery: opts.FailEvery,
+	}
+	if modelOverride != "" {
+		c.modelName = modelOverride
+	}
+	if c.mode == "" {
+		c.mode = ModeEcho
+	}
+
+	switch c.mode {
+	case ModeEcho, ModePrompt:
+	case ModeFile:
+		if opts.ResponseFile == "" {
+			return nil, fmt.Errorf("mock mode %q requires response_file", ModeFile)
+		}
+		data, err := os.ReadFile(opts.ResponseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mock response_file: %w", err)
+		}
+		c.fixed = string(data)
+	case ModeRules:
+		if len(opts.Rules) == 0 {
+			return nil, fmt.Errorf("mock mode %q requires at least one [[llms.mock.rules]] entry", ModeRules)
+		}
+		for i, rule := range opts.Rules {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern in mock rule %d: %w", i+1, err)
+			}
+			c.rules = append(c.rules, compiledRule{re: re, response: rule.Response, err: rule.Error})
+		}
+	case ModeSequence:
+		if len(opts.Responses) == 0 {
+			return nil, fmt.Errorf("mock mode %q requires responses", ModeSequence)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mock mode %q (available: %s, %s, %s, %s, %s)", c.mode, ModeEcho, ModePrompt, ModeFile, ModeRules, ModeSequence)
+	}
+
+	if opts.Latency != "" {
+		latency, err := time.ParseDuration(opts.Latency)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("invalid mock latency %q: must be a duration such as \"500ms\"", opts.Latency)
+		}
+		c.latency = latency
+	}
+	if c.failEvery < 0 {
+		return nil, fmt.Errorf("invalid mock fail_every %d: must not be negative", c.failEvery)
+	}
+	if c.failEvery > 0 && c.errorText == "" {
+		c.errorText = "request failed"
+	}
+
+	if debugMode {
+		log.Printf("Using mock provider in %s mode", c.mode)
+	}
+	return c, nil
+}
+
+// Generate answers the prompt according to the client's mode.
+func (c *Client) Generate(ctx context.Context, prompt string) (llmtypes.Response, error) {
+	return c.answer(ctx, prompt, inputOf(prompt))
+}
+
+// Chat answers the conversation: rules see every message, and echo returns
+// the last one.
+func (c *Client) Chat(ctx context.Context, messages []llmtypes.Message) (llmtypes.Response, error) {
+	if len(messages) == 0 {
+		return llmtypes.Response{}, fmt.Errorf("mock chat requires at least one message")
+	}
+	contents := make([]string, len(messages))
+	for i, m := range messages {
+		contents[i] = m.Content
+	}
+	return c.answer(ctx, strings.Join(contents, "\n\n"), messages[len(messages)-1].Content)
+}
+
+// answer produces the response to prompt, with input being what echo returns.
+func (c *Client) answer(ctx context.Context, prompt, input string) (llmtypes.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	n := c.requests
+	c.mu.Unlock()
+
+	if c.latency > 0 {
+		timer := time.NewTimer(c.latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return llmtypes.Response{}, ctx.Err()
+		}
+	}
+	if c.errorText != "" && (c.failEvery == 0 || n%c.failEvery == 0) {
+		return llmtypes.Response{}, fmt.Errorf("%w: %s", ErrSimulated, c.errorText)
+	}
+
+	var text string
+	switch c.mode {
+	case ModeEcho:
+		text = input
+	case ModePrompt:
+		text = prompt
+	case ModeFile:
+		text = c.fixed
+	case ModeSequence:
+		text = c.responses[(n-1)%len(c.responses)]
+	case ModeRules:
+		rule, match := c.match(prompt)
+		if rule == nil {
+			return llmtypes.Response{}, fmt.Errorf("no mock rule matches the prompt")
+		}
+		if rule.err != "" {
+			return llmtypes.Response{}, fmt.Errorf("%w: %s", ErrSimulated, rule.err)
+		}
+		text = string(rule.re.ExpandString(nil, rule.response, prompt, match))
+	}
+	return llmtypes.Response{Text: text, Model: c.modelName}, nil
+}
+
+// match returns the first rule matching prompt and the indexes of its match.
+func (c *Client) match(prompt string) (*compiledRule, []int) {
+	for i := range c.rules {
+		if match := c.rules[i].re.FindStringSubmatchIndex(prompt); match != nil {
+			return &c.rules[i], match
+		}
+	}
+	return nil, nil
+}
+
+// inputOf returns the input part of a prompt built by the prompt package, or
+// the whole prompt if it has none.
+func inputOf(prompt string) string {
+	if i := strings.Index(prompt, inputHeading); i >= 0 {
+		return prompt[i+len(inputHeading):]
+	}
+	return prompt
+}
+
+// ListModels returns the configured model, so that `dreampipe config validate`
+// passes for the mock provider.
+func (c *Client) ListModels(ctx context.Context) ([]llmtypes.ModelInfo, error) {
+	return []llmtypes.ModelInfo{{Name: c.modelName, Capabilities: []string{"completion"}}}, nil
+}
+
+// ModelName returns the model name responses are attributed to.
+func (c *Client) ModelName() string {
+	return c.modelName
+}
+
+// ProviderName returns the name of the [llms] entry the client serves.
+func (c *Client) ProviderName() string {
+	if c.name != "" {
+		return c.name
+	}
+	return providerName
+}
+
+// Close is a placeholder.
+func (c *Client) Close() error {
+	return nil
+}
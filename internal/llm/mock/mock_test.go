@@ -0,0 +1,183 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+	"github.com/hiway/dreampipe/internal/prompt"
+)
+
+func TestClient_Generate(t *testing.T) {
+	responseFile := filepath.Join(t.TempDir(), "response.txt")
+	if err := os.WriteFile(responseFile, []byte("fixed answer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builtPrompt := prompt.Build("You are a filter.", "Translate to French", "Hello\nWorld", "")
+
+	tests := []struct {
+		name    string
+		opts    Options
+		prompts []string
+		want    []string
+		wantErr []bool
+	}{
+		{name: "Echo returns the input", opts: Options{}, prompts: []string{builtPrompt}, want: []string{"Hello\nWorld"}},
+		{name: "Echo without input heading", opts: Options{Mode: ModeEcho}, prompts: []string{"plain"}, want: []string{"plain"}},
+		{name: "Prompt returns the whole prompt", opts: Options{Mode: ModePrompt}, prompts: []string{builtPrompt}, want: []string{builtPrompt}},
+		{name: "File", opts: Options{Mode: ModeFile, ResponseFile: responseFile}, prompts: []string{"a", "b"}, want: []string{"fixed answer", "fixed answer"}},
+		{
+			name:    "Sequence starts over",
+			opts:    Options{Mode: ModeSequence, Responses: []string{"one", "two"}},
+			prompts: []string{"a", "b", "c"},
+			want:    []string{"one", "two", "one"},
+		},
+		{
+			name: "Rules",
+			opts: Options{Mode: ModeRules, Rules: []Rule{
+				{Pattern: `(?i)translate to (\w+)`, Response: "translated to $1"},
+				{Pattern: `boom`, Error: "rate limited"},
+				{Pattern: `(?P<word>\w+)$`, Response: "last word: ${word}"},
+			}},
+			prompts: []string{builtPrompt, "boom", "no rule for me", "!"},
+			want:    []string{"translated to French", "", "last word: me", ""},
+			wantErr: []bool{false, true, false, true},
+		},
+		{
+			name:    "Error on every request",
+			opts:    Options{Error: "provider down"},
+			prompts: []string{"a", "b"},
+			want:    []string{"", ""},
+			wantErr: []bool{true, true},
+		},
+		{
+			name:    "Fail every third request",
+			opts:    Options{Mode: ModePrompt, FailEvery: 3},
+			prompts: []string{"a", "b", "c", "d"},
+			want:    []string{"a", "b", "", "d"},
+			wantErr: []bool{false, false, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient("", false, tt.opts)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			for i, p := range tt.prompts {
+				wantErr := tt.wantErr != nil && tt.wantErr[i]
+				resp, err := client.Generate(context.Background(), p)
+				if (err != nil) != wantErr {
+					t.Fatalf("request %d: Generate() error = %v, wantErr %v", i+1, err, wantErr)
+				}
+				if resp.Text != tt.want[i] {
+					t.Errorf("request %d: Generate() = %q, want %q", i+1, resp.Text, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Generate_SimulatedError(t *testing.T) {
+	client, err := NewClient("", false, Options{Error: "quota exceeded"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	_, err = client.Generate(context.Background(), "hi")
+	if !errors.Is(err, ErrSimulated) || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Generate() error = %v, want ErrSimulated with the configured message", err)
+	}
+}
+
+func TestClient_Generate_Latency(t *testing.T) {
+	client, err := NewClient("", false, Options{Latency: "50ms"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := client.Generate(context.Background(), "hi"); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Generate() took %v, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := client.Generate(ctx, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Generate() with an expiring context: error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestClient_Chat(t *testing.T) {
+	client, err := NewClient("tiny", false, Options{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	resp, err := client.Chat(context.Background(), []llmtypes.Message{
+		{Role: llmtypes.RoleSystem, Content: "system"},
+		{Role: llmtypes.RoleUser, Content: "last question"},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp.Text != "last question" || resp.Model != "tiny" {
+		t.Errorf("Chat() = %+v, want the last message from model tiny", resp)
+	}
+}
+
+func TestNewClient_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "Unknown mode", opts: Options{Mode: "random"}},
+		{name: "File mode without file", opts: Options{Mode: ModeFile}},
+		{name: "Missing file", opts: Options{Mode: ModeFile, ResponseFile: filepath.Join(t.TempDir(), "missing")}},
+		{name: "Rules mode without rules", opts: Options{Mode: ModeRules}},
+		{name: "Invalid rule pattern", opts: Options{Mode: ModeRules, Rules: []Rule{{Pattern: "("}}}},
+		{name: "Sequence mode without responses", opts: Options{Mode: ModeSequence}},
+		{name: "Invalid latency", opts: Options{Latency: "soon"}},
+		{name: "Negative fail_every", opts: Options{FailEvery: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient("", false, tt.opts); err == nil {
+				t.Errorf("NewClient() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	client, err := newFromConfig(llm.ProviderConfig{Name: "canned", Settings: map[string]interface{}{
+		"model": "tiny",
+		"mode":  "rules",
+		"rules": []map[string]interface{}{
+			{"pattern": `hello (\w+)`, "response": "hi $1"},
+			{"pattern": `.`, "error": "no rule"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("newFromConfig() error = %v", err)
+	}
+	resp, err := client.Generate(context.Background(), "hello world")
+	if err != nil || resp.Text != "hi world" || resp.Model != "tiny" {
+		t.Errorf("Generate() = %+v, %v, want the first rule's answer from model tiny", resp, err)
+	}
+	if _, err := client.Generate(context.Background(), "bye"); !errors.Is(err, ErrSimulated) {
+		t.Errorf("Generate() error = %v, want the second rule's error", err)
+	}
+	if client.ProviderName() != "canned" {
+		t.Errorf("ProviderName() = %q, want the entry's name", client.ProviderName())
+	}
+}
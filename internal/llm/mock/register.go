@@ -0,0 +1,28 @@
+package mock
+
+import "github.com/hiway/dreampipe/internal/llm"
+
+func init() {
+	llm.Register(providerName, newFromConfig, "mode", "response_file", "responses", "rules", "latency", "error", "fail_every")
+}
+
+// newFromConfig creates a client for an [llms] entry of type mock, from its
+// mode, response_file, responses, rules, latency, error and fail_every.
+func newFromConfig(cfg llm.ProviderConfig) (llm.Client, error) {
+	var settings struct {
+		Rules []Rule `toml:"rules"`
+	}
+	if err := cfg.Decode(&settings); err != nil {
+		return nil, err
+	}
+	return NewClient(cfg.String("model"), cfg.Debug, Options{
+		Name:         cfg.Name,
+		Mode:         cfg.String("mode"),
+		ResponseFile: cfg.Path("response_file"),
+		Responses:    cfg.Strings("responses"),
+		Rules:        settings.Rules,
+		Latency:      cfg.String("latency"),
+		Error:        cfg.String("error"),
+		FailEvery:    cfg.Int("fail_every"),
+	})
+}
@@ -2,44 +2,83 @@
 package ollama
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
 	// No specific Ollama SDK is typically needed, use net/http.
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
 )
 
 const (
 	defaultOllamaModel = "llama3" // A common default, user can override in config
 	providerName       = "ollama"
 	generateAPIPath    = "/api/generate"
+	chatAPIPath        = "/api/chat"
+	pullAPIPath        = "/api/pull"
+	tagsAPIPath        = "/api/tags"
+	showAPIPath        = "/api/show"
 )
 
 // Client implements the llm.Client interface for Ollama.
 type Client struct {
+	name       string // The [llms] entry, see Options.Name
 	httpClient *http.Client
 	baseURL    string // e.g., "http://localhost:11434"
 	modelName  string
+	debugMode  bool
+	options    Options
+	keepAlive  interface{} // Sent as keep_alive: seconds as a number, or a duration string
+}
+
+// Options are optional Ollama-specific settings.
+type Options struct {
+	// Name is the [llms] entry the client serves, returned by ProviderName;
+	// empty means "ollama".
+	Name string
+	// AutoPull pulls the model when the server doesn't have it, then retries.
+	AutoPull bool
+	// KeepAlive is how long the server keeps the model loaded after a request,
+	// e.g. "30m", or a number of seconds. Empty uses the server default.
+	KeepAlive string
+	// PullProgress receives progress messages while pulling, unless the
+	// request's context has a llmtypes.ProgressWriter; nil discards them.
+	PullProgress io.Writer
+	// Transport sends the HTTP requests; nil uses http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
+// pullTimeout is how long pulling a model may take with AutoPull, on top of
+// the request timeout.
+const pullTimeout = time.Hour
+
+// errModelNotFound is returned by generate when the server doesn't have the model.
+var errModelNotFound = errors.New("model not found")
+
 // ollamaGenerateRequest is the structure for the request body to Ollama's /api/generate.
 type ollamaGenerateRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"` // We'll use false for dreampipe's current non-streaming behavior
+	Stream bool   `json:"stream"` // Only to report progress, see llmtypes.WithTokenProgress
+	// KeepAlive controls how long the model stays loaded after the request.
+	KeepAlive interface{} `json:"keep_alive,omitempty"`
 	// Add other options like System, Template, Context, Options if needed later
 	// System  string                 `json:"system,omitempty"`
 	// Options map[string]interface{} `json:"options,omitempty"`
 }
 
-// ollamaGenerateResponse is the structure for the response from Ollama's /api/generate
-// when stream is false.
+// ollamaGenerateResponse is the structure for the response from Ollama's
+// /api/generate, or one line of it when streamed.
 type ollamaGenerateResponse struct {
 	Model     string    `json:"model"`
 	CreatedAt time.Time `json:"created_at"`
@@ -48,9 +87,9 @@ type ollamaGenerateResponse struct {
 	// Context            []int                  `json:"context,omitempty"` // For subsequent requests
 	// TotalDuration      time.Duration          `json:"total_duration,omitempty"`
 	// LoadDuration       time.Duration          `json:"load_duration,omitempty"`
-	// PromptEvalCount    int                    `json:"prompt_eval_count,omitempty"`
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"` // Tokens in the prompt
 	// PromptEvalDuration time.Duration          `json:"prompt_eval_duration,omitempty"`
-	// EvalCount          int                    `json:"eval_count,omitempty"`
+	EvalCount int `json:"eval_count,omitempty"` // Tokens in the response
 	// EvalDuration       time.Duration          `json:"eval_duration,omitempty"`
 	Error string `json:"error,omitempty"` // Ollama might return an error field
 }
@@ -59,7 +98,7 @@ type ollamaGenerateResponse struct {
 // baseURL is the address of the Ollama server (e.g., "http://localhost:11434").
 // modelOverride is an optional model name to use instead of the default.
 // debugMode controls verbose logging.
-func NewClient(baseURL string, modelOverride string, requestTimeoutSeconds int, debugMode bool) (*Client, error) {
+func NewClient(baseURL string, modelOverride string, requestTimeoutSeconds int, debugMode bool, opts Options) (*Client, error) {
 	if baseURL == "" {
 		return nil, fmt.Errorf("Ollama base URL is required")
 	}
@@ -86,38 +125,253 @@ func NewClient(baseURL string, modelOverride string, requestTimeoutSeconds int,
 		}
 	}
 
+	keepAlive, err := parseKeepAlive(opts.KeepAlive)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PullProgress == nil {
+		opts.PullProgress = io.Discard
+	}
+
 	return &Client{
+		name: opts.Name,
 		httpClient: &http.Client{
-			Timeout: time.Duration(requestTimeoutSeconds) * time.Second,
+			Timeout:   time.Duration(requestTimeoutSeconds) * time.Second,
+			Transport: opts.Transport,
 		},
 		baseURL:   cleanedBaseURL,
 		modelName: modelToUse,
+		debugMode: debugMode,
+		options:   opts,
+		keepAlive: keepAlive,
 	}, nil
 }
 
-// Generate sends the prompt to the Ollama model and returns the text response.
-func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
+// parseKeepAlive converts the keep_alive setting to what the Ollama API
+// accepts: a number of seconds or a Go duration string.
+func parseKeepAlive(value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, nil
+	}
+	if _, err := time.ParseDuration(value); err != nil {
+		return nil, fmt.Errorf("invalid Ollama keep_alive '%s': use a duration such as \"30m\" or a number of seconds", value)
+	}
+	return value, nil
+}
+
+// Generate sends the prompt to the Ollama model and returns the text response and token usage.
+// With AutoPull set, a missing model is pulled and the request retried.
+func (c *Client) Generate(ctx context.Context, prompt string) (llmtypes.Response, error) {
 	if c.httpClient == nil {
-		return "", fmt.Errorf("Ollama client not initialized")
+		return llmtypes.Response{}, fmt.Errorf("Ollama client not initialized")
 	}
 
-	// Construct the request payload
+	// The response is only streamed to report progress; it is used whole.
+	progress := llmtypes.TokenProgress(ctx)
 	payload := ollamaGenerateRequest{
-		Model:  c.modelName,
-		Prompt: prompt,
-		Stream: false, // dreampipe reads full input, so non-streaming response is appropriate
+		Model:     c.modelName,
+		Prompt:    prompt,
+		Stream:    progress != nil,
+		KeepAlive: c.keepAlive,
 	}
+	return c.withAutoPull(ctx, func(ctx context.Context) (llmtypes.Response, error) {
+		if progress != nil {
+			return c.postStreaming(ctx, generateAPIPath, payload, progress, func(line []byte) (ollamaGenerateResponse, string, error) {
+				var part ollamaGenerateResponse
+				err := json.Unmarshal(line, &part)
+				return part, part.Response, err
+			})
+		}
+		var ollamaResp ollamaGenerateResponse
+		if err := c.post(ctx, generateAPIPath, payload, &ollamaResp); err != nil {
+			return llmtypes.Response{}, err
+		}
+		return ollamaResp.toResponse(ollamaResp.Response)
+	})
+}
+
+// ollamaChatMessage is a message in Ollama's /api/chat request and response.
+type ollamaChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
 
+// ollamaChatRequest is the structure for the request body to Ollama's /api/chat.
+type ollamaChatRequest struct {
+	Model     string              `json:"model"`
+	Messages  []ollamaChatMessage `json:"messages"`
+	Stream    bool                `json:"stream"`
+	KeepAlive interface{}         `json:"keep_alive,omitempty"`
+}
+
+// ollamaChatResponse is the structure for the response from Ollama's /api/chat,
+// or one line of it when streamed. It shares the status and usage fields with /api/generate.
+type ollamaChatResponse struct {
+	ollamaGenerateResponse
+	Message ollamaChatMessage `json:"message"`
+}
+
+// Chat sends a conversation to the Ollama model and returns the next reply and token usage.
+// With AutoPull set, a missing model is pulled and the request retried.
+func (c *Client) Chat(ctx context.Context, messages []llmtypes.Message) (llmtypes.Response, error) {
+	if c.httpClient == nil {
+		return llmtypes.Response{}, fmt.Errorf("Ollama client not initialized")
+	}
+
+	progress := llmtypes.TokenProgress(ctx)
+	payload := ollamaChatRequest{Model: c.modelName, Stream: progress != nil, KeepAlive: c.keepAlive}
+	for _, m := range messages {
+		payload.Messages = append(payload.Messages, ollamaChatMessage{Role: m.Role, Content: m.Content})
+	}
+	return c.withAutoPull(ctx, func(ctx context.Context) (llmtypes.Response, error) {
+		if progress != nil {
+			return c.postStreaming(ctx, chatAPIPath, payload, progress, func(line []byte) (ollamaGenerateResponse, string, error) {
+				var part ollamaChatResponse
+				err := json.Unmarshal(line, &part)
+				return part.ollamaGenerateResponse, part.Message.Content, err
+			})
+		}
+		var ollamaResp ollamaChatResponse
+		if err := c.post(ctx, chatAPIPath, payload, &ollamaResp); err != nil {
+			return llmtypes.Response{}, err
+		}
+		return ollamaResp.toResponse(ollamaResp.Message.Content)
+	})
+}
+
+// withAutoPull runs send and, if the model is missing and AutoPull is set,
+// pulls the model and runs send again.
+func (c *Client) withAutoPull(ctx context.Context, send func(ctx context.Context) (llmtypes.Response, error)) (llmtypes.Response, error) {
+	resp, err := send(ctx)
+	if !errors.Is(err, errModelNotFound) || !c.options.AutoPull {
+		return resp, err
+	}
+
+	// ctx allows for the pull, see RequestTimeout; each request is still
+	// bounded by the HTTP client's timeout.
+	if err := c.Pull(ctx); err != nil {
+		return llmtypes.Response{}, err
+	}
+	return send(ctx)
+}
+
+// RequestTimeout returns how long a request may take in all, which with
+// AutoPull includes pulling the model: up to pullTimeout longer than
+// request_timeout_seconds.
+func (c *Client) RequestTimeout() time.Duration {
+	if c.options.AutoPull {
+		return c.httpClient.Timeout + pullTimeout
+	}
+	return c.httpClient.Timeout
+}
+
+// toResponse checks a decoded response for errors and converts it, using text
+// as the generated text.
+func (r ollamaGenerateResponse) toResponse(text string) (llmtypes.Response, error) {
+	if r.Error != "" {
+		return llmtypes.Response{}, fmt.Errorf("Ollama returned an error in response: %s", r.Error)
+	}
+
+	// The main generated text is in the "response" field
+	if !r.Done && text == "" {
+		// This might happen if 'done' is false but no response is given yet,
+		// which is unusual for stream=false.
+		return llmtypes.Response{}, fmt.Errorf("Ollama response indicates not done but no text was returned")
+	}
+
+	return llmtypes.Response{
+		Text:  strings.TrimSpace(text),
+		Model: r.Model,
+		Usage: llmtypes.Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}, nil
+}
+
+// post sends payload as JSON to an Ollama API path and decodes the JSON
+// response into out. A missing model is reported as errModelNotFound.
+func (c *Client) post(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	resp, err := c.send(ctx, path, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read the response body
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Ollama response body: %w", err)
+	}
+
+	// Parse the response
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal Ollama response JSON: %w. Raw response: %s", err, string(responseBody))
+	}
+	return nil
+}
+
+// postStreaming is post for a streamed response, which Ollama sends as one
+// JSON object per line, each with about one token of text and the last with
+// done set and the usage. decode returns a line's status and text; progress
+// gets the number of lines so far.
+func (c *Client) postStreaming(ctx context.Context, path string, payload interface{}, progress func(tokens int), decode func(line []byte) (ollamaGenerateResponse, string, error)) (llmtypes.Response, error) {
+	resp, err := c.send(ctx, path, payload)
+	if err != nil {
+		return llmtypes.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var last ollamaGenerateResponse
+	tokens := 0
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		part, partText, err := decode(scanner.Bytes())
+		if err != nil {
+			return llmtypes.Response{}, fmt.Errorf("failed to unmarshal Ollama response JSON: %w. Raw line: %s", err, scanner.Text())
+		}
+		if part.Error != "" {
+			return llmtypes.Response{}, fmt.Errorf("Ollama returned an error in response: %s", part.Error)
+		}
+		text.WriteString(partText)
+		tokens++
+		progress(tokens)
+		last = part
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return llmtypes.Response{}, fmt.Errorf("Ollama request interrupted: %w", ctx.Err())
+		}
+		return llmtypes.Response{}, fmt.Errorf("failed to read Ollama response body: %w", err)
+	}
+	if !last.Done {
+		return llmtypes.Response{}, fmt.Errorf("Ollama response ended before it was done")
+	}
+	return last.toResponse(text.String())
+}
+
+// send sends payload as JSON to an Ollama API path and returns the response,
+// which the caller closes, when its status is OK.
+func (c *Client) send(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal Ollama request payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal Ollama request payload: %w", err)
 	}
 
 	// Construct the request
-	requestURL := c.baseURL + generateAPIPath
+	requestURL := c.baseURL + path
 	req, err := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create Ollama request: %w", err)
+		return nil, fmt.Errorf("failed to create Ollama request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
@@ -127,53 +381,204 @@ func (c *Client) Generate(ctx context.Context, prompt string) (string, error) {
 	if err != nil {
 		// Check if the error is due to context cancellation (e.g., timeout)
 		if ctx.Err() == context.Canceled {
-			return "", fmt.Errorf("Ollama request canceled: %w", ctx.Err())
+			return nil, fmt.Errorf("Ollama request canceled: %w", ctx.Err())
 		}
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("Ollama request timed out: %w", ctx.Err())
+			return nil, fmt.Errorf("Ollama request timed out: %w", ctx.Err())
 		}
-		return "", fmt.Errorf("failed to send request to Ollama server at %s: %w", requestURL, err)
+		return nil, fmt.Errorf("failed to send request to Ollama server at %s: %w", requestURL, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
 	}
 	defer resp.Body.Close()
 
-	// Read the response body
+	// Attempt to get more info from the body if possible
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read Ollama response body: %w", err)
+		return nil, fmt.Errorf("failed to read Ollama response body: %w", err)
+	}
+	var errResp ollamaGenerateResponse
+	if resp.StatusCode == http.StatusNotFound && json.Unmarshal(responseBody, &errResp) == nil && strings.Contains(errResp.Error, "not found") {
+		hint := fmt.Sprintf("run `ollama pull %s` or set auto_pull = true under [llms.%s]", c.modelName, c.ProviderName())
+		return nil, fmt.Errorf("Ollama %w: %s (%s)", errModelNotFound, errResp.Error, hint)
+	}
+	if json.Unmarshal(responseBody, &errResp) == nil && errResp.Error != "" {
+		return nil, fmt.Errorf("Ollama API error (status %d): %s. Raw: %s", resp.StatusCode, errResp.Error, string(responseBody))
+	}
+	return nil, fmt.Errorf("Ollama API request failed with status %s. Raw: %s", resp.Status, string(responseBody))
+}
+
+// ollamaPullProgress is one line of the streamed response from Ollama's /api/pull.
+type ollamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Pull downloads the client's model to the Ollama server, writing progress
+// to the context's llmtypes.ProgressWriter, or else Options.PullProgress.
+func (c *Client) Pull(ctx context.Context) error {
+	payloadBytes, err := json.Marshal(map[string]interface{}{"model": c.modelName, "stream": true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Ollama pull request: %w", err)
 	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+pullAPIPath, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create Ollama pull request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-	// Check HTTP status code
+	// The shared client's timeout would cut off large downloads.
+	resp, err := (&http.Client{Transport: c.httpClient.Transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send pull request to Ollama server: %w", err)
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		// Attempt to get more info from the body if possible
-		var errResp ollamaGenerateResponse
-		if json.Unmarshal(responseBody, &errResp) == nil && errResp.Error != "" {
-			return "", fmt.Errorf("Ollama API error (status %d): %s. Raw: %s", resp.StatusCode, errResp.Error, string(responseBody))
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Ollama pull failed with status %s. Raw: %s", resp.Status, string(body))
+	}
+
+	out := llmtypes.ProgressWriter(ctx)
+	if out == nil {
+		out = c.options.PullProgress
+	}
+	fmt.Fprintf(out, "Pulling Ollama model %s...\n", c.modelName)
+	lastLine := ""
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress ollamaPullProgress
+		if err := json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+			return fmt.Errorf("failed to unmarshal Ollama pull progress: %w", err)
 		}
-		return "", fmt.Errorf("Ollama API request failed with status %s. Raw: %s", resp.Status, string(responseBody))
+		if progress.Error != "" {
+			return fmt.Errorf("Ollama pull of %s failed: %s", c.modelName, progress.Error)
+		}
+		line := progress.Status
+		if progress.Total > 0 {
+			line = fmt.Sprintf("%s %d%%", progress.Status, progress.Completed*10/progress.Total*10)
+		}
+		// Download progress arrives many times a second; only print changes of 10%.
+		if line != lastLine {
+			fmt.Fprintf(out, "  %s\n", line)
+			lastLine = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read Ollama pull progress: %w", err)
 	}
+	if lastLine != "success" {
+		return fmt.Errorf("Ollama pull of %s did not complete", c.modelName)
+	}
+	return nil
+}
 
-	// Parse the response
-	var ollamaResp ollamaGenerateResponse
-	if err := json.Unmarshal(responseBody, &ollamaResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal Ollama response JSON: %w. Raw response: %s", err, string(responseBody))
+// ollamaTagsResponse is the structure for the response from Ollama's /api/tags,
+// which lists the models pulled on the server.
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// ListModels returns the models available on the Ollama server.
+func (c *Client) ListModels(ctx context.Context) ([]llmtypes.ModelInfo, error) {
+	requestURL := c.baseURL + tagsAPIPath
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ollama request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Ollama server at %s: %w", requestURL, err)
 	}
+	defer resp.Body.Close()
 
-	if ollamaResp.Error != "" {
-		return "", fmt.Errorf("Ollama returned an error in response: %s", ollamaResp.Error)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Ollama response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API request failed with status %s. Raw: %s", resp.Status, string(responseBody))
 	}
 
-	// The main generated text is in the "response" field
-	if !ollamaResp.Done && ollamaResp.Response == "" {
-		// This might happen if 'done' is false but no response is given yet,
-		// which is unusual for stream=false.
-		return "", fmt.Errorf("Ollama response indicates not done but no text was returned")
+	var tagsResp ollamaTagsResponse
+	if err := json.Unmarshal(responseBody, &tagsResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Ollama tags JSON: %w. Raw response: %s", err, string(responseBody))
+	}
+	models := make([]llmtypes.ModelInfo, 0, len(tagsResp.Models))
+	for _, m := range tagsResp.Models {
+		info := llmtypes.ModelInfo{Name: m.Name}
+		// Details are best effort; older servers don't report capabilities.
+		if show, err := c.showModel(ctx, m.Name); err == nil {
+			info.ContextWindow = show.contextLength()
+			info.Capabilities = show.Capabilities
+		} else if c.debugMode {
+			log.Printf("Ollama: could not get details of model %s: %v", m.Name, err)
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// ollamaShowResponse is the part of Ollama's /api/show response dreampipe uses.
+type ollamaShowResponse struct {
+	Capabilities []string               `json:"capabilities"`
+	ModelInfo    map[string]interface{} `json:"model_info"`
+}
+
+// contextLength returns the "<architecture>.context_length" entry of model_info.
+func (s ollamaShowResponse) contextLength() int {
+	for key, value := range s.ModelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// showModel returns the details of a locally available model.
+func (c *Client) showModel(ctx context.Context, name string) (ollamaShowResponse, error) {
+	var show ollamaShowResponse
+	body, err := json.Marshal(map[string]string{"model": name})
+	if err != nil {
+		return show, fmt.Errorf("failed to marshal Ollama request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+showAPIPath, bytes.NewBuffer(body))
+	if err != nil {
+		return show, fmt.Errorf("failed to create Ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return show, fmt.Errorf("failed to send request to Ollama server: %w", err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return show, fmt.Errorf("Ollama API request failed with status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return show, fmt.Errorf("failed to unmarshal Ollama show JSON: %w", err)
+	}
+	return show, nil
+}
 
-	return strings.TrimSpace(ollamaResp.Response), nil
+// ModelName returns the model this client sends requests to.
+func (c *Client) ModelName() string {
+	return c.modelName
 }
 
-// ProviderName returns the name of this provider.
+// ProviderName returns the name of the [llms] entry the client serves.
 func (c *Client) ProviderName() string {
+	if c.name != "" {
+		return c.name
+	}
 	return providerName
 }
 
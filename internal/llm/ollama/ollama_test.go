@@ -0,0 +1,225 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+func TestClient_Generate_AutoPull(t *testing.T) {
+	tests := []struct {
+		name      string
+		autoPull  bool
+		wantErr   bool
+		wantPulls int
+	}{
+		{name: "Pulls and retries", autoPull: true, wantPulls: 1},
+		{name: "Reports missing model without auto_pull", autoPull: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pulled := 0
+			var keepAlive interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case pullAPIPath:
+					pulled++
+					w.Write([]byte("{\"status\":\"pulling manifest\"}\n{\"status\":\"downloading\",\"total\":100,\"completed\":50}\n{\"status\":\"success\"}\n"))
+				case generateAPIPath:
+					var req map[string]interface{}
+					json.NewDecoder(r.Body).Decode(&req)
+					keepAlive = req["keep_alive"]
+					if pulled == 0 {
+						w.WriteHeader(http.StatusNotFound)
+						w.Write([]byte(`{"error":"model \"tiny\" not found, try pulling it first"}`))
+						return
+					}
+					w.Write([]byte(`{"model":"tiny","response":"hello","done":true}`))
+				}
+			}))
+			defer server.Close()
+
+			var progress strings.Builder
+			client, err := NewClient(server.URL, "tiny", 5, false, Options{Name: "local", AutoPull: tt.autoPull, KeepAlive: "30m", PullProgress: &progress})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			resp, err := client.Generate(context.Background(), "hi")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if pulled != tt.wantPulls {
+				t.Errorf("pulled %d times, want %d", pulled, tt.wantPulls)
+			}
+			if keepAlive != "30m" {
+				t.Errorf("keep_alive = %v, want 30m", keepAlive)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "auto_pull = true under [llms.local]") {
+					t.Errorf("error %q does not mention auto_pull for the entry", err)
+				}
+				return
+			}
+			if resp.Text != "hello" {
+				t.Errorf("Text = %q, want %q", resp.Text, "hello")
+			}
+			if !strings.Contains(progress.String(), "downloading 50%") {
+				t.Errorf("progress output %q does not show download progress", progress.String())
+			}
+		})
+	}
+}
+
+func TestClient_Pull_ProgressWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"status\":\"pulling manifest\"}\n{\"status\":\"success\"}\n"))
+	}))
+	defer server.Close()
+
+	var options, request strings.Builder
+	client, err := NewClient(server.URL, "tiny", 5, false, Options{PullProgress: &options})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := client.Pull(llmtypes.WithProgressWriter(context.Background(), &request)); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if !strings.Contains(request.String(), "pulling manifest") {
+		t.Errorf("context's writer got %q, want the pull progress", request.String())
+	}
+	if options.String() != "" {
+		t.Errorf("Options.PullProgress got %q, want nothing", options.String())
+	}
+}
+
+func TestClient_Generate_AutoPullCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case pullAPIPath:
+			// A download that doesn't finish before the caller gives up.
+			w.Write([]byte("{\"status\":\"pulling manifest\"}\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case generateAPIPath:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"model \"tiny\" not found, try pulling it first"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "tiny", 5, false, Options{AutoPull: true})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if got := client.RequestTimeout(); got != 5*time.Second+pullTimeout {
+		t.Errorf("RequestTimeout() = %v, want room for the pull", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.Generate(ctx, "hi"); err == nil {
+		t.Fatalf("Generate() error = nil, want the pull canceled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Generate() took %v after being canceled", elapsed)
+	}
+}
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    interface{}
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "300", want: 300},
+		{value: "-1", want: -1},
+		{value: "30m", want: "30m"},
+		{value: "forever", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseKeepAlive(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseKeepAlive(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseKeepAlive(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClient_Chat(t *testing.T) {
+	var req ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != chatAPIPath {
+			t.Errorf("request sent to %s, want %s", r.URL.Path, chatAPIPath)
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"model":"tiny","message":{"role":"assistant","content":" two "},"done":true,"prompt_eval_count":7,"eval_count":1}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "tiny", 5, false, Options{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	resp, err := client.Chat(context.Background(), []llmtypes.Message{
+		{Role: llmtypes.RoleSystem, Content: "Input: 1 2"},
+		{Role: llmtypes.RoleUser, Content: "first?"},
+		{Role: llmtypes.RoleAssistant, Content: "1"},
+		{Role: llmtypes.RoleUser, Content: "second?"},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if resp.Text != "two" || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Chat() = %+v, want text \"two\" and 8 tokens", resp)
+	}
+	if len(req.Messages) != 4 || req.Messages[2].Role != "assistant" {
+		t.Errorf("messages sent = %+v", req.Messages)
+	}
+}
+
+func TestClient_Generate_Streaming(t *testing.T) {
+	var stream bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaGenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		stream = req.Stream
+		w.Write([]byte(`{"model":"tiny","response":"Hel","done":false}
+{"model":"tiny","response":"lo","done":false}
+
+{"model":"tiny","response":"","done":true,"prompt_eval_count":3,"eval_count":2}
+`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "tiny", 5, false, Options{})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	var counts []int
+	ctx := llmtypes.WithTokenProgress(context.Background(), func(tokens int) { counts = append(counts, tokens) })
+	resp, err := client.Generate(ctx, "hi")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !stream {
+		t.Errorf("request did not ask for a stream")
+	}
+	if resp.Text != "Hello" || resp.Usage.TotalTokens != 5 {
+		t.Errorf("Generate() = %+v, want the joined text and the usage of the last line", resp)
+	}
+	if len(counts) != 3 || counts[2] != 3 {
+		t.Errorf("progress got %v, want a count for each line", counts)
+	}
+}
@@ -0,0 +1,25 @@
+package ollama
+
+import (
+	"fmt"
+
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+func init() {
+	llm.Register(providerName, newFromConfig)
+}
+
+// newFromConfig creates a client for an [llms] entry of type ollama.
+func newFromConfig(cfg llm.ProviderConfig) (llm.Client, error) {
+	baseURL := cfg.String("base_url")
+	if baseURL == "" {
+		return nil, fmt.Errorf("base URL for Ollama not found in configuration")
+	}
+	return NewClient(baseURL, cfg.String("model"), cfg.RequestTimeoutSeconds, cfg.Debug, Options{
+		Name:      cfg.Name,
+		AutoPull:  cfg.Bool("auto_pull"),
+		KeepAlive: cfg.String("keep_alive"),
+		Transport: cfg.Transport,
+	})
+}
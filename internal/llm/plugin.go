@@ -0,0 +1,240 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+// PluginPrefix is the prefix of the programs found on the PATH for providers
+// that aren't registered: type "acme" runs dreampipe-provider-acme.
+const PluginPrefix = "dreampipe-provider-"
+
+// PluginProtocolVersion is sent with every plugin request; plugins should
+// reject versions they don't know.
+const PluginProtocolVersion = 1
+
+// Methods of plugin requests.
+const (
+	PluginGenerate   = "generate"
+	PluginChat       = "chat"
+	PluginListModels = "list_models"
+)
+
+// PluginRequest is written as JSON to a plugin's stdin, one request per run.
+type PluginRequest struct {
+	Version  int                    `json:"version"`
+	Method   string                 `json:"method"`
+	Provider string                 `json:"provider"`
+	Model    string                 `json:"model,omitempty"`
+	Prompt   string                 `json:"prompt,omitempty"`
+	Messages []PluginMessage        `json:"messages,omitempty"`
+	APIKey   string                 `json:"api_key,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// PluginMessage is one turn of a chat request.
+type PluginMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PluginResponse is read as JSON from a plugin's stdout.
+type PluginResponse struct {
+	Text   string        `json:"text"`
+	Model  string        `json:"model,omitempty"`
+	Usage  PluginUsage   `json:"usage"`
+	Models []PluginModel `json:"models,omitempty"`
+	// Error fails the request with this message, whatever the exit status.
+	Error string `json:"error,omitempty"`
+}
+
+// PluginUsage holds the token counts a plugin reports, zero if unknown.
+type PluginUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// PluginModel describes a model in the response to list_models.
+type PluginModel struct {
+	Name          string   `json:"name"`
+	ContextWindow int      `json:"context_window,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+}
+
+// PluginsOnPath returns the plugin programs on the PATH by provider type,
+// the first of each type, as it is the one that runs.
+func PluginsOnPath() map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			providerType, ok := strings.CutPrefix(entry.Name(), PluginPrefix)
+			if !ok || providerType == "" || plugins[providerType] != "" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if found, err := exec.LookPath(path); err == nil {
+				plugins[providerType] = found
+			}
+		}
+	}
+	return plugins
+}
+
+// pluginClient runs an exec plugin for every request.
+type pluginClient struct {
+	path string
+	cfg  ProviderConfig
+}
+
+// newPluginClient returns a client running the program at path.
+func newPluginClient(path string, cfg ProviderConfig) *pluginClient {
+	return &pluginClient{path: path, cfg: cfg}
+}
+
+// Generate sends prompt to the plugin.
+func (c *pluginClient) Generate(ctx context.Context, prompt string) (Response, error) {
+	return c.request(ctx, PluginRequest{Method: PluginGenerate, Prompt: prompt})
+}
+
+// Chat sends the conversation to the plugin.
+func (c *pluginClient) Chat(ctx context.Context, messages []Message) (Response, error) {
+	req := PluginRequest{Method: PluginChat, Messages: make([]PluginMessage, 0, len(messages))}
+	for _, m := range messages {
+		req.Messages = append(req.Messages, PluginMessage{Role: m.Role, Content: m.Content})
+	}
+	return c.request(ctx, req)
+}
+
+// ListModels asks the plugin for its models.
+func (c *pluginClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	resp, err := c.run(ctx, PluginRequest{Method: PluginListModels})
+	if err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		models = append(models, ModelInfo{Name: m.Name, ContextWindow: m.ContextWindow, Capabilities: m.Capabilities})
+	}
+	return models, nil
+}
+
+// ModelName returns the configured model, which may be empty when the
+// plugin chooses one.
+func (c *pluginClient) ModelName() string {
+	return c.cfg.String("model")
+}
+
+// ProviderName returns the entry's name in [llms].
+func (c *pluginClient) ProviderName() string {
+	return c.cfg.Name
+}
+
+// request runs a generate or chat request and converts the response.
+func (c *pluginClient) request(ctx context.Context, req PluginRequest) (Response, error) {
+	resp, err := c.run(ctx, req)
+	if err != nil {
+		return Response{}, err
+	}
+	model := resp.Model
+	if model == "" {
+		model = c.ModelName()
+	}
+	return Response{
+		Text:  resp.Text,
+		Model: model,
+		Usage: llmtypes.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// run starts the plugin with req on stdin and decodes its stdout. A plugin
+// that exits non-zero fails the request with its error field or its stderr.
+func (c *pluginClient) run(ctx context.Context, req PluginRequest) (PluginResponse, error) {
+	apiKey, err := c.apiKey()
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	req.Version = PluginProtocolVersion
+	req.Provider = c.cfg.Name
+	req.Model = c.ModelName()
+	req.APIKey = apiKey
+	req.Settings = c.settings()
+	input, err := json.Marshal(req)
+	if err != nil {
+		return PluginResponse{}, fmt.Errorf("failed to encode request for plugin %s: %w", c.path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.cfg.RequestTimeoutSeconds)*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if c.cfg.Debug {
+		log.Printf("Running plugin %s for %s (%s)", c.path, c.cfg.Name, req.Method)
+	}
+	runErr := cmd.Run()
+
+	var resp PluginResponse
+	decodeErr := json.Unmarshal(stdout.Bytes(), &resp)
+	switch {
+	case decodeErr == nil && resp.Error != "":
+		return PluginResponse{}, fmt.Errorf("plugin %s: %s", c.cfg.Name, resp.Error)
+	case ctx.Err() != nil:
+		return PluginResponse{}, fmt.Errorf("plugin %s: %w", c.cfg.Name, ctx.Err())
+	case runErr != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return PluginResponse{}, fmt.Errorf("plugin %s failed: %w: %s", c.cfg.Name, runErr, msg)
+		}
+		return PluginResponse{}, fmt.Errorf("plugin %s failed: %w", c.cfg.Name, runErr)
+	case decodeErr != nil:
+		return PluginResponse{}, fmt.Errorf("plugin %s returned invalid JSON: %w", c.cfg.Name, decodeErr)
+	}
+	return resp, nil
+}
+
+// apiKey resolves the entry's API key when it configures one; plugins that
+// need none get an empty key.
+func (c *pluginClient) apiKey() (string, error) {
+	for _, key := range apiKeySettings {
+		if c.cfg.String(key) != "" {
+			return c.cfg.APIKey()
+		}
+	}
+	return "", nil
+}
+
+// settings returns the entry's settings without the ones the request carries
+// separately, so key commands and files aren't passed on.
+func (c *pluginClient) settings() map[string]interface{} {
+	settings := make(map[string]interface{}, len(c.cfg.Settings))
+	for key, value := range c.cfg.Settings {
+		settings[key] = value
+	}
+	for _, key := range append(apiKeySettings, "model", "plugin") {
+		delete(settings, key)
+	}
+	return settings
+}
+
+// apiKeySettings are the settings an API key is resolved from.
+var apiKeySettings = []string{"api_key", "api_key_cmd", "api_key_env", "api_key_file"}
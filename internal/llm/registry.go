@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+// Constructor creates a client for one [llms] entry. Provider packages
+// register a Constructor from their init function.
+type Constructor func(cfg ProviderConfig) (Client, error)
+
+// ProviderConfig is what a Constructor gets to create a client: the entry's
+// settings as a generic table plus the options that apply to every provider.
+type ProviderConfig struct {
+	// Name is the entry's name in [llms], which may differ from the
+	// registered provider when the entry sets type.
+	Name string
+	// Settings holds every key of the entry, e.g. "model" or "base_url".
+	Settings map[string]interface{}
+	// RequestTimeoutSeconds limits each HTTP request; it is always positive.
+	RequestTimeoutSeconds int
+	// Transport, when not nil, carries the provider's HTTP requests, e.g. to
+	// record or replay them.
+	Transport http.RoundTripper
+	// Replaying is set when requests are served from a cassette, so no API
+	// key is needed.
+	Replaying bool
+	Debug     bool
+
+	// resolvedAPIKey is the API key when it was resolved before the client
+	// was created, see newProviderClient.
+	resolvedAPIKey string
+}
+
+// String returns the string setting key, or "" when it is missing.
+func (p ProviderConfig) String(key string) string {
+	s, _ := p.Settings[key].(string)
+	return s
+}
+
+// Path returns the path setting key with a leading "~/" expanded, or "" when
+// it is missing.
+func (p ProviderConfig) Path(key string) string {
+	return config.ExpandHome(p.String(key))
+}
+
+// Bool returns the boolean setting key, or false when it is missing.
+func (p ProviderConfig) Bool(key string) bool {
+	b, _ := p.Settings[key].(bool)
+	return b
+}
+
+// Int returns the integer setting key, or 0 when it is missing.
+func (p ProviderConfig) Int(key string) int {
+	switch n := p.Settings[key].(type) {
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// Strings returns the string array setting key, skipping other values.
+func (p ProviderConfig) Strings(key string) []string {
+	switch values := p.Settings[key].(type) {
+	case []string:
+		return values
+	case []interface{}:
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+// Decode decodes the settings into v, a pointer to a struct with toml tags,
+// for providers with structured settings.
+func (p ProviderConfig) Decode(v interface{}) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(p.Settings); err != nil {
+		return fmt.Errorf("invalid settings for %s: %w", p.Name, err)
+	}
+	if _, err := toml.Decode(buf.String(), v); err != nil {
+		return fmt.Errorf("invalid settings for %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// APIKey resolves the entry's API key from api_key, api_key_cmd, api_key_env
+// or api_key_file. It is resolved only when a client is created, so key
+// commands don't run for providers that aren't used. The key itself is never
+// logged, only where it came from.
+func (p ProviderConfig) APIKey() (string, error) {
+	// Replayed requests never reach the provider, so they need no key.
+	if p.Replaying {
+		return "replay", nil
+	}
+	if p.resolvedAPIKey != "" {
+		return p.resolvedAPIKey, nil
+	}
+	llmCfg := config.LLMConfig{
+		APIKey:     p.String("api_key"),
+		APIKeyCmd:  p.String("api_key_cmd"),
+		APIKeyEnv:  p.String("api_key_env"),
+		APIKeyFile: p.String("api_key_file"),
+	}
+	apiKey, source, err := llmCfg.ResolveAPIKey()
+	if err != nil {
+		return "", fmt.Errorf("could not get API key for %s: %w", p.Name, err)
+	}
+	if p.Debug && apiKey != "" {
+		log.Printf("Using API key for %s from %s", p.Name, source)
+	}
+	return apiKey, nil
+}
+
+// --- Registry ---
+
+var (
+	registryMu    sync.RWMutex
+	registrations = map[string]registration{}
+)
+
+// registration is a registered provider.
+type registration struct {
+	constructor Constructor
+	settings    []string // Keys its entries read beyond those of config.LLMConfig
+}
+
+func init() {
+	config.SetProviderRegistry(configRegistry{})
+}
+
+// Register makes a provider available under name, the value of an entry's
+// type or, without one, the entry's name. settings are the keys its entries
+// may set beyond those of config.LLMConfig, which are otherwise reported as
+// unknown. It panics when name is empty or already registered, as both are
+// programming errors.
+func Register(name string, c Constructor, settings ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || c == nil {
+		panic("llm: Register needs a name and a constructor")
+	}
+	if _, exists := registrations[name]; exists {
+		panic(fmt.Sprintf("llm: provider %s registered twice", name))
+	}
+	registrations[name] = registration{constructor: c, settings: settings}
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registrations))
+	for name := range registrations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configRegistry lets package config check provider types against the registry.
+type configRegistry struct{}
+
+func (configRegistry) Types() []string {
+	return Providers()
+}
+
+func (configRegistry) SettingKeys(providerType string) ([]string, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registrations[providerType]
+	return r.settings, ok
+}
+
+// lookupConstructor returns the constructor registered as name.
+func lookupConstructor(name string) (Constructor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registrations[name]
+	return r.constructor, ok
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+// stubClient is returned by the constructor registered for these tests.
+type stubClient struct{ cfg ProviderConfig }
+
+func (c *stubClient) Generate(ctx context.Context, prompt string) (Response, error) {
+	return Response{Text: prompt}, nil
+}
+
+func (c *stubClient) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return Response{}, nil
+}
+
+func (c *stubClient) ProviderName() string { return c.cfg.Name }
+
+func init() {
+	Register("stub", func(cfg ProviderConfig) (Client, error) { return &stubClient{cfg: cfg}, nil })
+}
+
+// loadConfig writes content as a configuration file and loads it.
+func loadConfig(t *testing.T, content string) config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	return cfg
+}
+
+// writePlugin writes a plugin script to dir and returns its path.
+func writePlugin(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewProviderClient_Registry(t *testing.T) {
+	cfg := loadConfig(t, `default_provider = "work"
+[llms.work]
+type = "stub"
+model = "m1"
+region = "eu"
+`)
+	client, err := NewProviderClient(cfg, "work", false)
+	if err != nil {
+		t.Fatalf("NewProviderClient() error = %v", err)
+	}
+	stub, ok := client.(*stubClient)
+	if !ok {
+		t.Fatalf("NewProviderClient() = %T, want the registered stub", client)
+	}
+	if stub.cfg.Name != "work" || stub.cfg.String("model") != "m1" || stub.cfg.String("region") != "eu" {
+		t.Errorf("constructor got %+v, want the work entry's settings", stub.cfg)
+	}
+	if stub.cfg.RequestTimeoutSeconds != 60 {
+		t.Errorf("RequestTimeoutSeconds = %d, want the default 60", stub.cfg.RequestTimeoutSeconds)
+	}
+}
+
+func TestNewProviderClient_Unsupported(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	cfg := loadConfig(t, "default_provider = \"acme\"\n[llms.acme]\ntype = \"acme\"\nmodel = \"x\"\n")
+	_, err := NewProviderClient(cfg, "acme", false)
+	if err == nil || !strings.Contains(err.Error(), "stub") || !strings.Contains(err.Error(), PluginPrefix+"acme") {
+		t.Errorf("NewProviderClient() error = %v, want the available providers and the plugin name", err)
+	}
+}
+
+func TestNewProviderClient_UnknownNameRunsNoPlugin(t *testing.T) {
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	writePlugin(t, dir, PluginPrefix+"olama", "touch \""+ran+"\"\n")
+	t.Setenv("PATH", dir)
+	cfg := loadConfig(t, "default_provider = \"olama\"\n[llms.olama]\nmodel = \"x\"\n")
+
+	client, err := NewProviderClient(cfg, "olama", false)
+	if err == nil || !strings.Contains(err.Error(), "unknown provider: olama") {
+		t.Fatalf("NewProviderClient() = %T, %v, want an unknown provider error", client, err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Errorf("the plugin ran for an entry without type or plugin")
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() of a taken name did not panic")
+		}
+	}()
+	Register("stub", func(ProviderConfig) (Client, error) { return nil, nil })
+}
+
+func TestProviders(t *testing.T) {
+	found := false
+	for _, name := range Providers() {
+		found = found || name == "stub"
+	}
+	if !found {
+		t.Errorf("Providers() = %v, want it to include stub", Providers())
+	}
+}
+
+func TestPluginClient(t *testing.T) {
+	dir := t.TempDir()
+	requestFile := filepath.Join(dir, "request.json")
+	writePlugin(t, dir, PluginPrefix+"acme", `cat > "`+requestFile+`"
+echo '{"text": "hi from acme", "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}, "models": [{"name": "acme-1", "context_window": 8192}]}'
+`)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cfg := loadConfig(t, `default_provider = "acme"
+[llms.acme]
+type = "acme"
+model = "acme-1"
+api_key = "secret"
+region = "eu"
+`)
+
+	client, err := NewProviderClient(cfg, "acme", false)
+	if err != nil {
+		t.Fatalf("NewProviderClient() error = %v", err)
+	}
+	resp, err := client.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if resp.Text != "hi from acme" || resp.Model != "acme-1" || resp.Usage.TotalTokens != 5 {
+		t.Errorf("Generate() = %+v", resp)
+	}
+
+	data, err := os.ReadFile(requestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req PluginRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("plugin got invalid JSON %q: %v", data, err)
+	}
+	if req.Version != PluginProtocolVersion || req.Method != PluginGenerate || req.Provider != "acme" ||
+		req.Model != "acme-1" || req.Prompt != "hello" || req.APIKey != "secret" {
+		t.Errorf("plugin request = %+v", req)
+	}
+	if req.Settings["region"] != "eu" || req.Settings["api_key"] != nil {
+		t.Errorf("plugin settings = %v, want region without api_key", req.Settings)
+	}
+
+	models, err := client.(ModelLister).ListModels(context.Background())
+	if err != nil || len(models) != 1 || models[0].ContextWindow != 8192 {
+		t.Errorf("ListModels() = %+v, %v", models, err)
+	}
+}
+
+func TestPluginClient_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "Exit status with stderr", body: "echo 'quota exceeded' >&2\nexit 3\n", wantErr: "quota exceeded"},
+		{name: "Error field", body: "echo '{\"error\": \"model not found\"}'\nexit 1\n", wantErr: "model not found"},
+		{name: "Invalid JSON", body: "echo 'not json'\n", wantErr: "invalid JSON"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePlugin(t, dir, "plugin"+string(rune('a'+i)), "cat > /dev/null\n"+tt.body)
+			cfg := config.Config{DefaultProvider: "p", LLMs: map[string]config.LLMConfig{"p": {Plugin: path}}}
+			client, err := NewProviderClient(cfg, "p", false)
+			if err != nil {
+				t.Fatalf("NewProviderClient() error = %v", err)
+			}
+			_, err = client.Generate(context.Background(), "x")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Generate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm/llmtypes"
+)
+
+// ModelLister is implemented by clients that can list the models available to them.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	// ModelName returns the model the client sends requests to.
+	ModelName() string
+}
+
+// ModelInfo describes a model offered by a provider.
+type ModelInfo = llmtypes.ModelInfo
+
+// CheckStatus is the outcome of a single validation check.
+type CheckStatus int
+
+const (
+	CheckOK   CheckStatus = iota // The check passed
+	CheckWarn                    // Something looks wrong but may still work
+	CheckFail                    // The provider will not work as configured
+)
+
+// Check is the result of one validation step for a provider entry.
+type Check struct {
+	Provider string
+	Status   CheckStatus
+	Message  string
+}
+
+// apiKeyPrefixes are the prefixes of well-formed API keys per provider.
+var apiKeyPrefixes = map[string]string{
+	"gemini": "AIza",
+	"groq":   "gsk_",
+}
+
+// ValidateConfig checks every configured provider entry in cfg: that its settings are
+// complete and well-formed and, unless offline, that the provider is reachable
+// and the configured model exists. Providers are checked in name order.
+func ValidateConfig(ctx context.Context, cfg config.Config, offline bool) []Check {
+	var checks []Check
+	names := ConfiguredProviders(cfg)
+	if _, exists := cfg.LLMs[cfg.DefaultProvider]; !exists {
+		if !cfg.HasProvider(cfg.DefaultProvider) {
+			checks = append(checks, Check{Provider: cfg.DefaultProvider, Status: CheckFail, Message: "default provider has no [llms] entry"})
+		} else {
+			// A registered provider without an entry runs from its defaults,
+			// which must do.
+			names = append(names, cfg.DefaultProvider)
+			sort.Strings(names)
+		}
+	}
+
+	for _, name := range names {
+		checks = append(checks, validateProvider(ctx, cfg, name, offline)...)
+	}
+	return checks
+}
+
+// ConfiguredProviders returns the providers the user has set up in cfg, in
+// name order. The default provider is included whenever it has an entry.
+func ConfiguredProviders(cfg config.Config) []string {
+	names := make([]string, 0, len(cfg.LLMs))
+	defaults := config.Default().LLMs
+	for name, llmCfg := range cfg.LLMs {
+		// Entries left as built-in defaults are providers the user never set up.
+		defaultCfg, isDefault := defaults[name]
+		if isDefault && reflect.DeepEqual(llmCfg, defaultCfg) && name != cfg.DefaultProvider {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateProvider runs the checks for a single provider entry.
+func validateProvider(ctx context.Context, cfg config.Config, name string, offline bool) []Check {
+	llmCfg := cfg.LLMs[name]
+	var checks []Check
+	add := func(status CheckStatus, format string, args ...interface{}) {
+		checks = append(checks, Check{Provider: name, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// The key is resolved once, for the checks and the client, so
+	// api_key_cmd runs only once.
+	var apiKey string
+	providerType := ProviderType(name, llmCfg)
+	if prefix, ok := apiKeyPrefixes[providerType]; ok {
+		key, source, err := llmCfg.ResolveAPIKey()
+		apiKey = key
+		switch {
+		case err != nil:
+			add(CheckFail, "API key: %v", err)
+			return checks
+		case apiKey == "":
+			add(CheckFail, "no API key configured")
+			return checks
+		case !strings.HasPrefix(apiKey, prefix):
+			add(CheckWarn, "API key from %s does not look like a %s key (expected prefix %s)", source, providerType, prefix)
+		default:
+			add(CheckOK, "API key from %s is well-formed", source)
+		}
+	}
+
+	client, err := newProviderClient(cfg, name, false, apiKey)
+	if err != nil {
+		add(CheckFail, "%v", err)
+		return checks
+	}
+	if offline {
+		return checks
+	}
+
+	lister, ok := client.(ModelLister)
+	if !ok {
+		add(CheckWarn, "provider cannot list models, skipping online checks")
+		return checks
+	}
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		add(CheckFail, "could not reach provider: %v", err)
+		return checks
+	}
+	add(CheckOK, "provider reachable, %d models available", len(models))
+
+	model := lister.ModelName()
+	if hasModel(models, model) {
+		add(CheckOK, "model %s exists", model)
+	} else {
+		add(CheckFail, "model %s not found, see `dreampipe models --provider %s`", model, name)
+	}
+	return checks
+}
+
+// hasModel reports whether model is in models. Ollama lists models with their
+// tag, so "llama3" matches "llama3:latest".
+func hasModel(models []ModelInfo, model string) bool {
+	for _, m := range models {
+		if m.Name == model || m.Name == model+":latest" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+	_ "github.com/hiway/dreampipe/internal/llm/builtin"
+)
+
+func TestValidateConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [{"name": "llama3:latest"}, {"name": "phi3:mini"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		offline  bool
+		wantFail bool
+	}{
+		{
+			name: "Ollama model exists",
+			cfg:  config.Config{DefaultProvider: "ollama", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: server.URL, Model: "llama3"}}},
+		},
+		{
+			name:     "Ollama model missing",
+			cfg:      config.Config{DefaultProvider: "ollama", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: server.URL, Model: "mistral"}}},
+			wantFail: true,
+		},
+		{
+			name:     "Ollama unreachable",
+			cfg:      config.Config{DefaultProvider: "ollama", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: "http://127.0.0.1:1"}}},
+			wantFail: true,
+		},
+		{
+			name:    "Ollama unreachable offline",
+			cfg:     config.Config{DefaultProvider: "ollama", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: "http://127.0.0.1:1"}}},
+			offline: true,
+		},
+		{
+			name:     "Groq missing key",
+			cfg:      config.Config{DefaultProvider: "groq", LLMs: map[string]config.LLMConfig{"groq": {}}},
+			offline:  true,
+			wantFail: true,
+		},
+		{
+			name:    "Mock without entry",
+			cfg:     config.Config{DefaultProvider: "mock"},
+			offline: true,
+		},
+		{
+			name:     "Unknown default provider",
+			cfg:      config.Config{DefaultProvider: "gorq", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: server.URL}}},
+			offline:  true,
+			wantFail: true,
+		},
+		{
+			name:     "Default provider not configured",
+			cfg:      config.Config{DefaultProvider: "gemini", LLMs: map[string]config.LLMConfig{"ollama": {BaseURL: server.URL}}},
+			offline:  true,
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failed := false
+			for _, check := range llm.ValidateConfig(context.Background(), tt.cfg, tt.offline) {
+				if check.Status == llm.CheckFail {
+					failed = true
+				}
+			}
+			if failed != tt.wantFail {
+				t.Errorf("ValidateConfig() failed = %v, want %v: %+v", failed, tt.wantFail, llm.ValidateConfig(context.Background(), tt.cfg, tt.offline))
+			}
+		})
+	}
+}
+
+func TestValidateConfig_KeyCommandRunsOnce(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	cfg := config.Config{DefaultProvider: "groq", LLMs: map[string]config.LLMConfig{
+		"groq": {APIKeyCmd: "echo run >> " + runs + " && echo gsk_0123456789abcdef"},
+	}}
+	for _, check := range llm.ValidateConfig(context.Background(), cfg, true) {
+		if check.Status == llm.CheckFail {
+			t.Errorf("ValidateConfig() failed: %+v", check)
+		}
+	}
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "run"); n != 1 {
+		t.Errorf("api_key_cmd ran %d times, want once", n)
+	}
+}
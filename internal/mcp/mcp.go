@@ -0,0 +1,443 @@
+// Package mcp serves scripts as tools over the Model Context Protocol, so
+// MCP clients such as editors and desktop assistants can call them. Messages
+// are JSON-RPC 2.0, one per line, on stdin and stdout.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// protocolVersions are the protocol versions the server speaks, latest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxMessageBytes caps a single message; tool inputs can be whole files.
+const maxMessageBytes = 32 << 20
+
+// toolNamePattern matches the names MCP clients accept for tools. Scripts with
+// other names are not listed.
+var toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Server answers MCP requests with the scripts of a library.
+type Server struct {
+	cfg     config.Config
+	library *script.Library
+	version string
+	debug   bool
+	// logOutput receives the warnings and debug messages of runs, usually
+	// stderr, as stdout carries the protocol.
+	logOutput io.Writer
+	// clientFactory creates the LLM clients; nil uses llm.GetClient.
+	clientFactory func(cfg config.Config, debugMode bool) (llm.Client, error)
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	callsMu sync.Mutex
+	calls   map[string]context.CancelFunc // Running tool calls by request ID
+	// spend is shared by the runners of all tool calls, so that concurrent
+	// ones count against daily_spend_usd together.
+	spend *app.SpendGuard
+}
+
+// Options configure a Server.
+type Options struct {
+	Version   string // Reported to clients as the server's version
+	Debug     bool
+	LogOutput io.Writer // Receives the runs' warnings; defaults to io.Discard
+}
+
+// New returns a server running the scripts of library with cfg.
+func New(cfg config.Config, library *script.Library, opts Options) *Server {
+	s := &Server{
+		cfg:       cfg,
+		library:   library,
+		version:   opts.Version,
+		debug:     opts.Debug,
+		logOutput: opts.LogOutput,
+		calls:     make(map[string]context.CancelFunc),
+		spend:     app.NewSpendGuard(),
+	}
+	if s.logOutput == nil {
+		s.logOutput = io.Discard
+	}
+	return s
+}
+
+// SetClientFactory makes the server create its LLM clients with factory
+// instead of llm.GetClient.
+func (s *Server) SetClientFactory(factory func(cfg config.Config, debugMode bool) (llm.Client, error)) {
+	s.clientFactory = factory
+}
+
+// --- JSON-RPC ---
+
+// request is a JSON-RPC request, or a notification when ID is empty.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC response with either Result or Error.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a failed request.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Serve reads requests from in and writes responses to out until in ends or
+// ctx is done. Tool calls run concurrently; when in ends, the running ones
+// finish before Serve returns, and when ctx is done they are cancelled.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageBytes)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			var req request
+			if err := json.Unmarshal(line, &req); err != nil {
+				s.reply(nil, nil, &rpcError{Code: codeParseError, Message: fmt.Sprintf("invalid JSON: %v", err)})
+				continue
+			}
+			if req.JSONRPC != "2.0" || req.Method == "" {
+				s.reply(req.ID, nil, &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"})
+				continue
+			}
+			if len(req.ID) == 0 {
+				s.notify(req)
+				continue
+			}
+			if req.Method != "tools/call" {
+				result, err := s.handle(req)
+				s.reply(req.ID, result, err)
+				continue
+			}
+			// Tool calls can take minutes, so they don't hold up other requests.
+			callCtx, callCancel := context.WithCancel(ctx)
+			s.track(req.ID, callCancel)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.untrack(req.ID)
+				result, err := s.callTool(callCtx, req.Params)
+				if callCtx.Err() != nil && ctx.Err() == nil {
+					// The client cancelled the call and expects no response.
+					return
+				}
+				s.reply(req.ID, result, err)
+			}()
+		}
+	}
+}
+
+// handle answers the requests other than tools/call.
+func (s *Server) handle(req request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+			}
+		}
+		return map[string]interface{}{
+			"protocolVersion": negotiateVersion(params.ProtocolVersion),
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			"serverInfo":      map[string]interface{}{"name": "dreampipe", "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		tools, err := s.tools()
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not found", req.Method)}
+}
+
+// notify handles a notification, which gets no response.
+func (s *Server) notify(req request) {
+	if req.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return
+	}
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(params.RequestID)]; ok {
+		cancel()
+	}
+}
+
+// track remembers how to cancel the call with id.
+func (s *Server) track(id json.RawMessage, cancel context.CancelFunc) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	s.calls[string(id)] = cancel
+}
+
+// untrack forgets the call with id once it is done.
+func (s *Server) untrack(id json.RawMessage) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(id)]; ok {
+		cancel()
+		delete(s.calls, string(id))
+	}
+}
+
+// reply writes the response to the request with id.
+func (s *Server) reply(id json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Result: result}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = rpcErr
+	}
+	data, marshalErr := json.Marshal(resp)
+	if marshalErr != nil {
+		data, _ = json.Marshal(response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: codeInternalError, Message: marshalErr.Error()}})
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+// negotiateVersion returns the client's protocol version when the server
+// speaks it, and otherwise the latest the server does.
+func negotiateVersion(requested string) string {
+	for _, v := range protocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return protocolVersions[0]
+}
+
+// --- Tools ---
+
+// tool describes a script in the response to tools/list.
+type tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema inputSchema `json:"inputSchema"`
+}
+
+// inputSchema is the JSON schema of a tool's arguments: the input and the
+// script's params.
+type inputSchema struct {
+	Type       string                    `json:"type"`
+	Properties map[string]schemaProperty `json:"properties"`
+	Required   []string                  `json:"required"`
+}
+
+// schemaProperty is one argument of a tool; all are strings.
+type schemaProperty struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Default     string   `json:"default,omitempty"`
+}
+
+// tools returns a tool for every script whose name clients accept.
+func (s *Server) tools() ([]tool, error) {
+	entries, err := s.library.List()
+	if err != nil {
+		return nil, err
+	}
+	tools := []tool{}
+	for _, entry := range entries {
+		if !toolNamePattern.MatchString(entry.Name) {
+			continue
+		}
+		sc, err := script.Load(entry.Path)
+		if err != nil {
+			fmt.Fprintf(s.logOutput, "⚠️  Skipping script %s: %v\n", entry.Name, err)
+			continue
+		}
+		tools = append(tools, newTool(entry, sc))
+	}
+	return tools, nil
+}
+
+// newTool describes the script sc of the library entry as a tool.
+func newTool(entry script.Entry, sc script.Script) tool {
+	description := strings.TrimSpace(sc.Meta.Description)
+	if description == "" {
+		description = entry.Description
+	}
+	schema := inputSchema{
+		Type: "object",
+		Properties: map[string]schemaProperty{
+			script.InputParam: {Type: "string", Description: "The text to process, as the script's standard input"},
+		},
+		Required: []string{script.InputParam},
+	}
+	for _, p := range sc.Meta.Params {
+		schema.Properties[p.Name] = schemaProperty{Type: "string", Description: p.Description, Enum: p.Values, Default: p.Default}
+		if p.Required {
+			schema.Required = append(schema.Required, p.Name)
+		}
+	}
+	return tool{Name: entry.Name, Description: description, InputSchema: schema}
+}
+
+// toolResult is the result of tools/call. A failed run is a result with
+// IsError set, so the model sees why; protocol errors are JSON-RPC errors.
+type toolResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError"`
+}
+
+// textContent is the text content of a tool result.
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// callTool runs the script a tools/call request names.
+func (s *Server) callTool(ctx context.Context, rawParams json.RawMessage) (interface{}, error) {
+	var params struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	if !toolNamePattern.MatchString(params.Name) {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+	}
+	path, err := s.library.Find(params.Name)
+	if err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+	}
+	input, values, err := splitArguments(params.Arguments)
+	if err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	var stdout bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader(input), Out: &stdout, Err: s.logOutput}
+	runner := app.NewRunner(s.cfg, streams, s.debug)
+	runner.SetRecordLastRun(false)
+	runner.SetProgress(false)
+	runner.SetParams(values)
+	runner.SetSpendGuard(s.spend)
+	if s.clientFactory != nil {
+		runner.SetClientFactory(s.clientFactory)
+	}
+	if err := runner.RunContext(ctx, app.ModeScript, path, ""); err != nil {
+		return toolResult{Content: []textContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return toolResult{Content: []textContent{{Type: "text", Text: strings.TrimSuffix(stdout.String(), "\n")}}}, nil
+}
+
+// splitArguments returns the input argument and the others as param values.
+// Clients may send params as numbers or booleans; they are used as text.
+func splitArguments(args map[string]interface{}) (string, map[string]string, error) {
+	var input string
+	if raw, ok := args[script.InputParam]; ok && raw != nil {
+		s, isString := raw.(string)
+		if !isString {
+			return "", nil, fmt.Errorf("argument %q must be a string", script.InputParam)
+		}
+		input = s
+	}
+	values := make(map[string]string, len(args))
+	for name, arg := range args {
+		if name == script.InputParam {
+			continue
+		}
+		switch v := arg.(type) {
+		case string:
+			values[name] = v
+		case float64, bool:
+			values[name] = fmt.Sprint(v)
+		case nil:
+			// A null argument is the same as leaving it out.
+		default:
+			return "", nil, fmt.Errorf("argument %q must be a string", name)
+		}
+	}
+	return input, values, nil
+}
@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/llm/mock"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// session is a server running on pipes, as a client sees it.
+type session struct {
+	t   *testing.T
+	in  *io.PipeWriter
+	out *bufio.Scanner
+}
+
+// newSession starts a server for a scripts directory with "translate", which
+// declares params, "shout" and "bad name", using a mock client with opts.
+func newSession(t *testing.T, opts mock.Options) *session {
+	t.Helper()
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"translate": "#!/usr/bin/env dreampipe\n+++\ndescription = \"Translates text.\"\n" +
+			"[[params]]\nname = \"lang\"\ndescription = \"Target language\"\nvalues = [\"fr\", \"de\"]\ndefault = \"fr\"\n" +
+			"[[params]]\nname = \"tone\"\nrequired = true\n+++\nTranslate to {{lang}} in a {{tone}} tone.\n",
+		"shout":    "#!/usr/bin/env dreampipe\nRepeat the input.\n",
+		"bad name": "#!/usr/bin/env dreampipe\nIgnored.\n",
+	}
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Default()
+	cfg.DefaultProvider = "mock"
+	cfg.RecordUsage = false
+	srv := New(cfg, &script.Library{Dirs: []string{dir}}, Options{Version: "test"})
+	srv.SetClientFactory(func(config.Config, bool) (llm.Client, error) { return mock.NewClient("", false, opts) })
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		io.Copy(io.Discard, outR)
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return &session{t: t, in: inW, out: bufio.NewScanner(outR)}
+}
+
+// send writes a message.
+func (s *session) send(msg string) {
+	s.t.Helper()
+	if _, err := io.WriteString(s.in, msg+"\n"); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// receive reads the next response.
+func (s *session) receive() response {
+	s.t.Helper()
+	if !s.out.Scan() {
+		s.t.Fatalf("no response: %v", s.out.Err())
+	}
+	var resp response
+	if err := json.Unmarshal(s.out.Bytes(), &resp); err != nil {
+		s.t.Fatalf("invalid response %q: %v", s.out.Text(), err)
+	}
+	return resp
+}
+
+// call sends a request and decodes the result of its response into result.
+func (s *session) call(id int, method, params string, result interface{}) *rpcError {
+	s.t.Helper()
+	idJSON, _ := json.Marshal(id)
+	s.send(`{"jsonrpc": "2.0", "id": ` + string(idJSON) + `, "method": "` + method + `", "params": ` + params + `}`)
+	resp := s.receive()
+	if string(resp.ID) != string(idJSON) {
+		s.t.Fatalf("response id = %s, want %s", resp.ID, idJSON)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	data, _ := json.Marshal(resp.Result)
+	if err := json.Unmarshal(data, result); err != nil {
+		s.t.Fatalf("invalid result %s: %v", data, err)
+	}
+	return nil
+}
+
+func TestInitialize(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+	}{
+		{name: "Supported version", requested: "2025-03-26", want: "2025-03-26"},
+		{name: "Unknown version", requested: "2099-01-01", want: protocolVersions[0]},
+	}
+
+	s := newSession(t, mock.Options{})
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result struct {
+				ProtocolVersion string `json:"protocolVersion"`
+				ServerInfo      struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"serverInfo"`
+			}
+			if err := s.call(i, "initialize", `{"protocolVersion": "`+tt.requested+`", "capabilities": {}}`, &result); err != nil {
+				t.Fatalf("initialize error = %v", err)
+			}
+			if result.ProtocolVersion != tt.want || result.ServerInfo.Name != "dreampipe" || result.ServerInfo.Version != "test" {
+				t.Errorf("initialize = %+v, want version %s", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolsList(t *testing.T) {
+	s := newSession(t, mock.Options{})
+	s.send(`{"jsonrpc": "2.0", "method": "notifications/initialized"}`)
+	var result struct {
+		Tools []tool `json:"tools"`
+	}
+	if err := s.call(1, "tools/list", `{}`, &result); err != nil {
+		t.Fatalf("tools/list error = %v", err)
+	}
+	if len(result.Tools) != 2 || result.Tools[0].Name != "shout" || result.Tools[1].Name != "translate" {
+		t.Fatalf("tools/list = %+v, want shout and translate", result.Tools)
+	}
+
+	shout := result.Tools[0]
+	if shout.Description != "Repeat the input." || len(shout.InputSchema.Properties) != 1 {
+		t.Errorf("shout = %+v", shout)
+	}
+	translate := result.Tools[1]
+	lang := translate.InputSchema.Properties["lang"]
+	if translate.Description != "Translates text." || lang.Default != "fr" || len(lang.Enum) != 2 || lang.Description != "Target language" {
+		t.Errorf("translate = %+v", translate)
+	}
+	if got := strings.Join(translate.InputSchema.Required, ","); got != "input,tone" {
+		t.Errorf("translate required = %s, want input,tone", got)
+	}
+}
+
+func TestToolsCall(t *testing.T) {
+	s := newSession(t, mock.Options{Mode: mock.ModePrompt})
+	tests := []struct {
+		name        string
+		params      string
+		wantText    string
+		wantIsError bool
+		wantCode    int
+	}{
+		{
+			name:     "Params",
+			params:   `{"name": "translate", "arguments": {"input": "hello", "lang": "de", "tone": "formal"}}`,
+			wantText: "Translate to de in a formal tone.",
+		},
+		{
+			name:        "Missing required param",
+			params:      `{"name": "translate", "arguments": {"input": "hello"}}`,
+			wantText:    "tone",
+			wantIsError: true,
+		},
+		{name: "Unknown tool", params: `{"name": "whisper", "arguments": {"input": "x"}}`, wantCode: codeInvalidParams},
+		{name: "Input not a string", params: `{"name": "shout", "arguments": {"input": 3}}`, wantCode: codeInvalidParams},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result toolResult
+			err := s.call(i, "tools/call", tt.params, &result)
+			if tt.wantCode != 0 {
+				if err == nil || err.Code != tt.wantCode {
+					t.Errorf("tools/call error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tools/call error = %v", err)
+			}
+			if result.IsError != tt.wantIsError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, tt.wantText) {
+				t.Errorf("tools/call = %+v, want %q with isError %v", result, tt.wantText, tt.wantIsError)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := newSession(t, mock.Options{Latency: "10s"})
+	s.send(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "shout", "arguments": {"input": "x"}}}`)
+	s.send(`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 1}}`)
+
+	start := time.Now()
+	var result struct{}
+	if err := s.call(2, "ping", `{}`, &result); err != nil {
+		t.Fatalf("ping error = %v", err)
+	}
+	// The cancelled call gets no response, so the next one is for a new request.
+	if err := s.call(3, "ping", `{}`, &result); err != nil {
+		t.Fatalf("ping error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("requests took %v, want the call not to hold them up", elapsed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newSession(t, mock.Options{})
+	s.send(`{not json`)
+	if resp := s.receive(); resp.Error == nil || resp.Error.Code != codeParseError || string(resp.ID) != "null" {
+		t.Errorf("invalid JSON got %+v, want a parse error with a null id", resp)
+	}
+	var result struct{}
+	if err := s.call(1, "resources/list", `{}`, &result); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("unknown method error = %v, want code %d", err, codeMethodNotFound)
+	}
+}
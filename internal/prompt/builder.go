@@ -33,3 +33,21 @@ func Build(agentPrompt, userTask, inputData, contextData string) string {
 		inputData,
 	)
 }
+
+// BuildSystem constructs the system message of a conversation about inputData:
+// the agent prompt, the optional context data and the input, without a task.
+// The tasks arrive as the user messages of the conversation.
+func BuildSystem(agentPrompt, inputData, contextData string) string {
+	agentPrompt = strings.TrimSpace(agentPrompt)
+	inputData = strings.TrimSpace(inputData)
+	contextData = strings.TrimSpace(contextData)
+
+	if contextData == "" {
+		return fmt.Sprintf("%s\n\n---\n\nInput:\n\n%s", agentPrompt, inputData)
+	}
+	return fmt.Sprintf("%s\n\n---\n\nContext:\n\n%s\n\n---\n\nInput:\n\n%s",
+		agentPrompt,
+		contextData,
+		inputData,
+	)
+}
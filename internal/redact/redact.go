@@ -0,0 +1,180 @@
+// Package redact replaces secrets and personal information in text with
+// placeholders before it is sent to an LLM provider, and can put the original
+// values back into the provider's response.
+package redact
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+// Rule detects one kind of sensitive value.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Validate optionally rejects false positives among the pattern's matches.
+	Validate func(match string) bool
+}
+
+// BuiltinRules returns the rules applied unless disabled in the configuration.
+// Rules are applied in order, so multi-line and more specific patterns come first.
+func BuiltinRules() []Rule {
+	return []Rule{
+		{
+			Name:    "private_key",
+			Pattern: regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+		},
+		{
+			Name: "api_key",
+			Pattern: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|gsk_[A-Za-z0-9]{20,}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|` +
+				`xox[abprs]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35})`),
+		},
+		{
+			Name:    "token",
+			Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+|(?i)\bbearer\s+[A-Za-z0-9._~+/-]{16,}=*`),
+		},
+		{
+			Name:     "credit_card",
+			Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			Validate: luhnValid,
+		},
+		{
+			Name:    "email",
+			Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		},
+		{
+			Name:    "ipv4",
+			Pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+		},
+		{
+			Name:     "ipv6",
+			Pattern:  regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){1,7}(?::[0-9a-f]{1,4}){0,6}(?:[0-9a-f]{1,4}|:)`),
+			Validate: func(match string) bool { return strings.Count(match, ":") >= 2 && net.ParseIP(match) != nil },
+		},
+	}
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by payment cards.
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// Redactor replaces matches of its rules with numbered placeholders such as
+// [REDACTED_EMAIL_1]. The same value always gets the same placeholder, across
+// all texts passed to one Redactor, so the LLM can still relate them.
+type Redactor struct {
+	rules        []Rule
+	placeholders map[string]string // original value -> placeholder
+	originals    map[string]string // placeholder -> original value
+	counts       map[string]int    // rule name -> number of distinct values
+}
+
+// New returns a Redactor applying rules in order.
+func New(rules []Rule) *Redactor {
+	return &Redactor{
+		rules:        rules,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+// Redact returns text with all sensitive values replaced by placeholders.
+func (r *Redactor) Redact(text string) string {
+	for _, rule := range r.rules {
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.Validate != nil && !rule.Validate(match) {
+				return match
+			}
+			if placeholder, ok := r.placeholders[match]; ok {
+				return placeholder
+			}
+			r.counts[rule.Name]++
+			placeholder := fmt.Sprintf("[REDACTED_%s_%d]", strings.ToUpper(rule.Name), r.counts[rule.Name])
+			r.placeholders[match] = placeholder
+			r.originals[placeholder] = match
+			return placeholder
+		})
+	}
+	return text
+}
+
+// Restore returns text with every known placeholder replaced by its original value.
+func (r *Redactor) Restore(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.originals))
+	for placeholder, original := range r.originals {
+		pairs = append(pairs, placeholder, original)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Summary describes how many distinct values were redacted per rule,
+// e.g. "email: 2, ipv4: 1", without revealing the values.
+func (r *Redactor) Summary() string {
+	names := make([]string, 0, len(r.counts))
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, r.counts[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Count returns the number of distinct values redacted so far.
+func (r *Redactor) Count() int {
+	return len(r.originals)
+}
+
+// RulesFromConfig returns the built-in rules not disabled in cfg, followed by
+// the custom rules defined in cfg.
+func RulesFromConfig(cfg config.RedactionConfig) ([]Rule, error) {
+	disabled := make(map[string]bool, len(cfg.DisableRules))
+	for _, name := range cfg.DisableRules {
+		disabled[name] = true
+	}
+
+	var rules []Rule
+	for _, rule := range BuiltinRules() {
+		if !disabled[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	for _, custom := range cfg.Rules {
+		pattern, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for redaction rule '%s': %w", custom.Name, err)
+		}
+		rules = append(rules, Rule{Name: custom.Name, Pattern: pattern})
+	}
+	return rules, nil
+}
@@ -0,0 +1,208 @@
+package script
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	libraryDirName = "scripts"
+	// installExt is stripped from installed file names, so examples/eli5.md
+	// becomes the script eli5.
+	installExt = ".md"
+	// descriptionWidth is how much of the instruction List uses as description.
+	descriptionWidth = 60
+)
+
+// ErrNotFound is returned when no directory of a library has the script.
+var ErrNotFound = errors.New("script not found")
+
+// LibraryDir returns the user's script library, based on XDG specs:
+// $XDG_DATA_HOME/dreampipe/scripts, or ~/.local/share/dreampipe/scripts.
+func LibraryDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home directory: %w", err)
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataHome, appName, libraryDirName), nil
+}
+
+// Library finds scripts by name in a list of directories. Earlier directories
+// win when several have a script with the same name.
+type Library struct {
+	Dirs []string
+}
+
+// NewLibrary returns a library searching LibraryDir first and then dirs.
+func NewLibrary(dirs ...string) (*Library, error) {
+	libraryDir, err := LibraryDir()
+	if err != nil {
+		return nil, err
+	}
+	l := &Library{}
+	seen := make(map[string]bool)
+	for _, dir := range append([]string{libraryDir}, dirs...) {
+		if dir == "" || seen[filepath.Clean(dir)] {
+			continue
+		}
+		seen[filepath.Clean(dir)] = true
+		l.Dirs = append(l.Dirs, dir)
+	}
+	return l, nil
+}
+
+// Entry is a script of a library.
+type Entry struct {
+	Name        string
+	Path        string
+	Description string // Start of the instruction
+}
+
+// Find returns the path of the script called name.
+func (l *Library) Find(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	for _, dir := range l.Dirs {
+		path := filepath.Join(dir, name)
+		if IsScript(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (searched %s)", ErrNotFound, name, strings.Join(l.Dirs, ", "))
+}
+
+// List returns the scripts of all directories sorted by name, leaving out
+// those hidden by a script of the same name in an earlier directory.
+// Directories that don't exist are skipped.
+func (l *Library) List() ([]Entry, error) {
+	var entries []Entry
+	seen := make(map[string]bool)
+	for _, dir := range l.Dirs {
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read script directory %s: %w", dir, err)
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, file.Name())
+			if seen[file.Name()] || file.IsDir() || !IsScript(path) {
+				continue
+			}
+			seen[file.Name()] = true
+			entry := Entry{Name: file.Name(), Path: path}
+			if s, err := Load(path); err == nil {
+				entry.Description = describe(s)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// IsScript reports whether path is a file whose shebang runs dreampipe, which
+// tells scripts apart from other programs in directories such as ~/.local/bin.
+func IsScript(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	return strings.HasPrefix(line, "#!") && strings.Contains(line, appName)
+}
+
+// Install copies the script at src, or every script in the directory src, into
+// dir and returns the installed paths. A trailing .md is dropped from the
+// names. Existing scripts are only replaced if force is set.
+func Install(src, dir string, force bool) ([]string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	sources := []string{src}
+	if info.IsDir() {
+		files, err := os.ReadDir(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", src, err)
+		}
+		sources = nil
+		for _, file := range files {
+			path := filepath.Join(src, file.Name())
+			if !file.IsDir() && IsScript(path) {
+				sources = append(sources, path)
+			}
+		}
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("no dreampipe scripts found in %s", src)
+		}
+	} else if !IsScript(src) {
+		return nil, fmt.Errorf("%s is not a dreampipe script: its first line must be %q", src, Shebang)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create script directory %s: %w", dir, err)
+	}
+	var installed []string
+	for _, source := range sources {
+		// Reject broken scripts now rather than when they are run.
+		if _, err := Load(source); err != nil {
+			return installed, err
+		}
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return installed, fmt.Errorf("failed to read script %s: %w", source, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(source), installExt)
+		if err := ValidateName(name); err != nil {
+			return installed, err
+		}
+		path := filepath.Join(dir, name)
+		if err := writeScript(path, data, force); err != nil {
+			return installed, err
+		}
+		installed = append(installed, path)
+	}
+	return installed, nil
+}
+
+// describe returns the script's description, or the first line of its
+// instruction or of its first step's, shortened to descriptionWidth.
+func describe(s Script) string {
+	if s.Meta.Description != "" {
+		line, _, _ := strings.Cut(s.Meta.Description, "\n")
+		return shorten(strings.TrimSpace(line))
+	}
+	instruction, prefix := s.Instruction, ""
+	if len(s.Meta.Steps) > 0 {
+		instruction, prefix = s.Meta.Steps[0].Instruction, fmt.Sprintf("[%d steps] ", len(s.Meta.Steps))
+	}
+	line, _, _ := strings.Cut(instruction, "\n")
+	return shorten(prefix + strings.TrimSpace(line))
+}
+
+// shorten cuts line to descriptionWidth.
+func shorten(line string) string {
+	if runes := []rune(line); len(runes) > descriptionWidth {
+		line = string(runes[:descriptionWidth-1]) + "…"
+	}
+	return line
+}
@@ -0,0 +1,108 @@
+package script
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "data"))
+	libraryDir, err := LibraryDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binDir := filepath.Join(tmp, "bin")
+
+	writeFile(t, filepath.Join(libraryDir, "eli5"), "#!/usr/bin/env dreampipe\n\nExplain like I'm 5.\n")
+	writeFile(t, filepath.Join(binDir, "eli5"), "#!/usr/bin/env dreampipe\n\nShadowed.\n")
+	writeFile(t, filepath.Join(binDir, "haiku"), "#!/usr/bin/env dreampipe\n\nWrite a haiku.\n")
+	writeFile(t, filepath.Join(binDir, "ls-all"), "#!/bin/sh\nls -a\n")
+
+	library, err := NewLibrary(binDir, libraryDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{libraryDir, binDir}; len(library.Dirs) != 2 || library.Dirs[0] != want[0] || library.Dirs[1] != want[1] {
+		t.Errorf("Dirs = %v, want %v", library.Dirs, want)
+	}
+
+	findTests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: "eli5", want: filepath.Join(libraryDir, "eli5")},
+		{name: "haiku", want: filepath.Join(binDir, "haiku")},
+		{name: "ls-all", wantErr: ErrNotFound},
+		{name: "missing", wantErr: ErrNotFound},
+	}
+	for _, tt := range findTests {
+		got, err := library.Find(tt.name)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Find(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	entries, err := library.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []Entry{
+		{Name: "eli5", Path: filepath.Join(libraryDir, "eli5"), Description: "Explain like I'm 5."},
+		{Name: "haiku", Path: filepath.Join(binDir, "haiku"), Description: "Write a haiku."},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("List() = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("List()[%d] = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "examples")
+	dir := filepath.Join(tmp, "scripts")
+	writeFile(t, filepath.Join(src, "eli5.md"), "#!/usr/bin/env dreampipe\n\nExplain like I'm 5.\n")
+	writeFile(t, filepath.Join(src, "to-json.md"), "#!/usr/bin/env dreampipe\n\nConvert to JSON.\n")
+	writeFile(t, filepath.Join(src, "README.md"), "# Examples\n")
+
+	installed, err := Install(src, dir, false)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if len(installed) != 2 || installed[0] != filepath.Join(dir, "eli5") || installed[1] != filepath.Join(dir, "to-json") {
+		t.Errorf("Install() = %v, want eli5 and to-json", installed)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "eli5")); err != nil || info.Mode().Perm() != ScriptPerm {
+		t.Errorf("installed script is not executable: %v, %v", info, err)
+	}
+
+	if _, err := Install(filepath.Join(src, "eli5.md"), dir, false); err == nil {
+		t.Errorf("Install() overwrote an existing script without force")
+	}
+	if _, err := Install(filepath.Join(src, "eli5.md"), dir, true); err != nil {
+		t.Errorf("Install() with force error = %v", err)
+	}
+	if _, err := Install(filepath.Join(src, "README.md"), dir, false); err == nil {
+		t.Errorf("Install() accepted a file without the dreampipe shebang")
+	}
+}
@@ -0,0 +1,128 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Param is a parameter a script declares in its front-matter. Its value
+// replaces {{name}} in the script's instructions.
+type Param struct {
+	Name        string   `toml:"name"`
+	Description string   `toml:"description,omitempty"`
+	Values      []string `toml:"values,omitempty"`  // The allowed values; any value when empty
+	Default     string   `toml:"default,omitempty"` // Used when no value is given
+	Required    bool     `toml:"required,omitempty"`
+}
+
+// InputParam is reserved for the input of tools built from scripts.
+const InputParam = "input"
+
+// paramNamePattern matches parameter names, which must also work as tool
+// argument names and in {{name}} placeholders.
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// validateParams checks that parameter names are valid and unique, and that
+// defaults are allowed values.
+func validateParams(params []Param) error {
+	seen := make(map[string]bool)
+	for i, p := range params {
+		if !paramNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("param %d: invalid name %q, use letters, digits, '_' and '-'", i+1, p.Name)
+		}
+		if p.Name == InputParam {
+			return fmt.Errorf("param %q is reserved for the script's input", InputParam)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("param %q is declared twice", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Default != "" && !p.allows(p.Default) {
+			return fmt.Errorf("param %q: default %q is not one of its values", p.Name, p.Default)
+		}
+		if p.Required && p.Default != "" {
+			return fmt.Errorf("param %q is required, so its default is never used", p.Name)
+		}
+	}
+	return nil
+}
+
+// allows reports whether value is one of the parameter's values.
+func (p Param) allows(value string) bool {
+	if len(p.Values) == 0 {
+		return true
+	}
+	for _, v := range p.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveParams checks values against the declared parameters and returns
+// the value of every parameter, using defaults for those not given.
+func (m Meta) ResolveParams(values map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(m.Params))
+	resolved := make(map[string]string, len(m.Params))
+	for _, p := range m.Params {
+		declared[p.Name] = true
+		value, given := values[p.Name]
+		switch {
+		case !given && p.Required:
+			return nil, fmt.Errorf("missing required param %q", p.Name)
+		case !given:
+			value = p.Default
+		case !p.allows(value):
+			return nil, fmt.Errorf("param %q must be one of %s, got %q", p.Name, strings.Join(p.Values, ", "), value)
+		}
+		resolved[p.Name] = value
+	}
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown params: %s", strings.Join(unknown, ", "))
+	}
+	return resolved, nil
+}
+
+// ExpandParams replaces {{name}} in text with the value of each parameter, in
+// one pass: placeholders in the values are left as they are.
+func ExpandParams(text string, values map[string]string) string {
+	oldnew := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		oldnew = append(oldnew, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(oldnew...).Replace(text)
+}
+
+// WithParams returns a copy of s with the parameters' values in its
+// instructions: the instruction, the steps' and map-reduce's reduce.
+func (s Script) WithParams(values map[string]string) (Script, error) {
+	resolved, err := s.Meta.ResolveParams(values)
+	if err != nil {
+		return Script{}, err
+	}
+	s.Instruction = ExpandParams(s.Instruction, resolved)
+	steps := make([]Step, len(s.Meta.Steps))
+	for i, step := range s.Meta.Steps {
+		step.Instruction = ExpandParams(step.Instruction, resolved)
+		steps[i] = step
+	}
+	if s.Meta.Steps != nil {
+		s.Meta.Steps = steps
+	}
+	if s.Meta.MapReduce != nil {
+		mr := *s.Meta.MapReduce
+		mr.Reduce = ExpandParams(mr.Reduce, resolved)
+		s.Meta.MapReduce = &mr
+	}
+	return s, nil
+}
@@ -0,0 +1,139 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	appName         = "dreampipe"
+	lastRunFileName = "last-run.json"
+	// ScriptPerm makes saved scripts executable, so they run via the shebang.
+	ScriptPerm = 0755
+)
+
+// LastRun is the most recent successful ad-hoc run, which `dreampipe save`
+// turns into a script.
+type LastRun struct {
+	Time        time.Time `json:"time"`
+	Instruction string    `json:"instruction"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model,omitempty"`
+}
+
+// Script returns a script that repeats the run with the same provider and model.
+func (l LastRun) Script() Script {
+	return Script{
+		Meta:        Meta{Provider: l.Provider, Model: l.Model},
+		Instruction: l.Instruction,
+	}
+}
+
+// LastRunPath returns where the last run is kept, based on XDG specs:
+// $XDG_STATE_HOME/dreampipe/last-run.json, or ~/.local/state/dreampipe/last-run.json.
+func LastRunPath() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home directory: %w", err)
+		}
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, appName, lastRunFileName), nil
+}
+
+// RecordLastRun remembers run as the most recent ad-hoc run.
+func RecordLastRun(run LastRun) error {
+	path, err := LastRunPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode last run: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// LoadLastRun returns the most recent ad-hoc run.
+func LoadLastRun() (LastRun, error) {
+	path, err := LastRunPath()
+	if err != nil {
+		return LastRun{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return LastRun{}, errors.New("no ad-hoc run to save yet; run dreampipe with an instruction first")
+	}
+	if err != nil {
+		return LastRun{}, fmt.Errorf("failed to read last run: %w", err)
+	}
+	var run LastRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return LastRun{}, fmt.Errorf("failed to decode last run %s: %w", path, err)
+	}
+	return run, nil
+}
+
+// ValidateName checks that name can be used as a script file name.
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid script name %q: use a plain file name such as \"summarize\"", name)
+	}
+	return nil
+}
+
+// Save writes s as an executable script called name in dir and returns its
+// path. An existing file is only replaced if force is set.
+func Save(dir, name string, s Script, force bool) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	data, err := s.Render()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create scripts directory %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := writeScript(path, data, force); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeScript writes data to path with ScriptPerm. An existing file is only
+// replaced if force is set.
+func writeScript(path string, data []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, ScriptPerm)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("script %s already exists (use --force to overwrite)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create script %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write script %s: %w", path, err)
+	}
+	// The umask may have removed execute bits; scripts must be runnable.
+	if err := f.Chmod(ScriptPerm); err != nil {
+		return fmt.Errorf("failed to make script %s executable: %w", path, err)
+	}
+	return nil
+}
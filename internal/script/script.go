@@ -0,0 +1,210 @@
+// Package script reads and writes dreampipe natural language scripts: files
+// starting with a `#!/usr/bin/env dreampipe` shebang, optional TOML
+// front-matter between `+++` lines, and the instruction.
+package script
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hiway/dreampipe/internal/filters"
+)
+
+// Shebang is the first line of every script dreampipe writes.
+const Shebang = "#!/usr/bin/env dreampipe"
+
+// frontMatterDelimiter opens and closes the TOML front-matter.
+const frontMatterDelimiter = "+++"
+
+// Meta is the script's front-matter. Empty fields use the configuration.
+type Meta struct {
+	// Description says what the script does, e.g. for `dreampipe scripts list`
+	// and tools built from the script. The instruction's first line is used
+	// when it's empty.
+	Description string `toml:"description,omitempty"`
+	Provider    string `toml:"provider,omitempty"` // Provider to use instead of default_provider
+	Model       string `toml:"model,omitempty"`    // Model to use with that provider
+	Steps       []Step `toml:"steps,omitempty"`    // Pipeline run instead of a single instruction
+	// MapReduce, when present, always splits the input and combines the results.
+	MapReduce *MapReduce `toml:"map_reduce,omitempty"`
+	// Params are the values the script takes besides its input, used as
+	// {{name}} in its instructions.
+	Params []Param `toml:"params,omitempty"`
+}
+
+// MapReduce configures map-reduce processing: the instruction is applied to
+// each chunk of the input in parallel, and the partial results are combined
+// with the reduce instruction, repeatedly until one result is left.
+// Zero fields use built-in defaults.
+type MapReduce struct {
+	Reduce      string `toml:"reduce,omitempty"`      // Instruction combining partial results
+	Parallel    int    `toml:"parallel,omitzero"`     // Chunks processed at the same time
+	ChunkTokens int    `toml:"chunk_tokens,omitzero"` // Input tokens per chunk, by default what fits the context window
+}
+
+// Merge returns m with the non-zero fields of override applied.
+func (m MapReduce) Merge(override MapReduce) MapReduce {
+	if override.Reduce != "" {
+		m.Reduce = override.Reduce
+	}
+	if override.Parallel != 0 {
+		m.Parallel = override.Parallel
+	}
+	if override.ChunkTokens != 0 {
+		m.ChunkTokens = override.ChunkTokens
+	}
+	return m
+}
+
+// Validate checks that the numbers make sense.
+func (m MapReduce) Validate() error {
+	if m.Parallel < 0 {
+		return fmt.Errorf("map_reduce parallel must be positive, or 0 for the default, got %d", m.Parallel)
+	}
+	if m.ChunkTokens < 0 {
+		return fmt.Errorf("map_reduce chunk_tokens must be positive, or 0 for the default, got %d", m.ChunkTokens)
+	}
+	return nil
+}
+
+// Step is one instruction of a multi-step script. Its input is the output of
+// the previous step, or stdin for the first step.
+type Step struct {
+	Name        string   `toml:"name,omitempty"`     // Refers to the step's output in the context of later steps
+	Instruction string   `toml:"instruction"`        // What to do with the input
+	Provider    string   `toml:"provider,omitempty"` // Provider for this step, defaults to the script's
+	Model       string   `toml:"model,omitempty"`    // Model for this step, defaults to the script's
+	Filters     []string `toml:"filters,omitempty"`  // Output filters; unset means filters.DefaultFilters
+	Context     []string `toml:"context,omitempty"`  // Names of earlier steps whose output is added as context
+}
+
+// IsZero reports whether the front-matter sets nothing.
+func (m Meta) IsZero() bool {
+	return m.Description == "" && m.Provider == "" && m.Model == "" && len(m.Steps) == 0 && m.MapReduce == nil && len(m.Params) == 0
+}
+
+// Script is a parsed natural language script.
+type Script struct {
+	Meta        Meta
+	Instruction string
+}
+
+// Load reads and parses the script at path.
+func Load(path string) (Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Script{}, fmt.Errorf("failed to read script file '%s': %w", path, err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return Script{}, fmt.Errorf("script file '%s': %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses a script: an optional shebang line, optional front-matter and
+// the instruction, which is everything after them.
+func Parse(data []byte) (Script, error) {
+	content := string(data)
+	if strings.HasPrefix(content, "#!") {
+		newline := strings.IndexByte(content, '\n')
+		if newline == -1 {
+			return Script{}, errors.New("seems to contain only a shebang line or is missing a newline after it")
+		}
+		content = content[newline+1:]
+	}
+
+	var s Script
+	body := strings.TrimLeft(content, " \t\r\n")
+	if strings.HasPrefix(body, frontMatterDelimiter+"\n") {
+		rest := body[len(frontMatterDelimiter)+1:]
+		end := strings.Index("\n"+rest, "\n"+frontMatterDelimiter)
+		if end == -1 {
+			return Script{}, fmt.Errorf("front-matter is missing its closing %s line", frontMatterDelimiter)
+		}
+		meta, err := toml.Decode(rest[:end], &s.Meta)
+		if err != nil {
+			return Script{}, fmt.Errorf("invalid front-matter: %w", err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return Script{}, fmt.Errorf("unknown front-matter keys: %v", undecoded)
+		}
+		content = rest[end+len(frontMatterDelimiter):]
+	}
+
+	s.Instruction = strings.TrimSpace(content)
+	if s.Meta.MapReduce != nil {
+		if len(s.Meta.Steps) > 0 {
+			return Script{}, errors.New("map_reduce can't be combined with steps")
+		}
+		if err := s.Meta.MapReduce.Validate(); err != nil {
+			return Script{}, err
+		}
+	}
+	if err := validateParams(s.Meta.Params); err != nil {
+		return Script{}, err
+	}
+	if len(s.Meta.Steps) > 0 {
+		if s.Instruction != "" {
+			return Script{}, errors.New("a script with steps takes its instructions from the steps; move the text after the front-matter into a step")
+		}
+		if err := validateSteps(s.Meta.Steps); err != nil {
+			return Script{}, err
+		}
+	}
+	return s, nil
+}
+
+// validateSteps checks that every step has an instruction, that names are
+// unique, that context only refers to earlier steps, and that filters exist.
+func validateSteps(steps []Step) error {
+	names := make(map[string]bool)
+	for i, step := range steps {
+		label := fmt.Sprintf("step %d", i+1)
+		if step.Name != "" {
+			label = fmt.Sprintf("step %d (%s)", i+1, step.Name)
+		}
+		if strings.TrimSpace(step.Instruction) == "" {
+			return fmt.Errorf("%s has no instruction", label)
+		}
+		for _, name := range step.Context {
+			if !names[name] {
+				return fmt.Errorf("%s uses %q as context, which is not the name of an earlier step", label, name)
+			}
+		}
+		for _, name := range step.Filters {
+			if _, err := filters.Lookup(name); err != nil {
+				return fmt.Errorf("%s: %w", label, err)
+			}
+		}
+		if step.Name != "" {
+			if names[step.Name] {
+				return fmt.Errorf("%s: another step is already called %q", label, step.Name)
+			}
+			names[step.Name] = true
+		}
+	}
+	return nil
+}
+
+// Render returns the script file contents: shebang, front-matter if any
+// field is set, and the instruction.
+func (s Script) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(Shebang + "\n\n")
+	if !s.Meta.IsZero() {
+		buf.WriteString(frontMatterDelimiter + "\n")
+		if err := toml.NewEncoder(&buf).Encode(s.Meta); err != nil {
+			return nil, fmt.Errorf("failed to encode front-matter: %w", err)
+		}
+		buf.WriteString(frontMatterDelimiter + "\n\n")
+	}
+	if s.Instruction != "" {
+		buf.WriteString(strings.TrimSpace(s.Instruction) + "\n")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Script
+		wantErr bool
+	}{
+		{
+			name: "Shebang and instruction",
+			data: "#!/usr/bin/env dreampipe\n\nExplain like I'm 5.\n",
+			want: Script{Instruction: "Explain like I'm 5."},
+		},
+		{
+			name: "Front-matter",
+			data: "#!/usr/bin/env dreampipe\n\n+++\nprovider = \"groq\"\nmodel = \"llama3-70b-8192\"\n+++\n\nSummarize.\n",
+			want: Script{Meta: Meta{Provider: "groq", Model: "llama3-70b-8192"}, Instruction: "Summarize."},
+		},
+		{
+			name: "No shebang",
+			data: "Translate to French.",
+			want: Script{Instruction: "Translate to French."},
+		},
+		{
+			name: "Steps",
+			data: "#!/usr/bin/env dreampipe\n+++\n[[steps]]\nname = \"facts\"\ninstruction = \"Extract facts.\"\n[[steps]]\ninstruction = \"Format as JSON.\"\ncontext = [\"facts\"]\nfilters = []\n+++\n",
+			want: Script{Meta: Meta{Steps: []Step{
+				{Name: "facts", Instruction: "Extract facts."},
+				{Instruction: "Format as JSON.", Context: []string{"facts"}, Filters: []string{}},
+			}}},
+		},
+		{name: "Steps and instruction", data: "+++\n[[steps]]\ninstruction = \"a\"\n+++\nb\n", wantErr: true},
+		{name: "Step without instruction", data: "+++\n[[steps]]\nname = \"a\"\n+++\n", wantErr: true},
+		{name: "Step context names a later step", data: "+++\n[[steps]]\ninstruction = \"a\"\ncontext = [\"b\"]\n[[steps]]\nname = \"b\"\ninstruction = \"b\"\n+++\n", wantErr: true},
+		{name: "Duplicate step names", data: "+++\n[[steps]]\nname = \"a\"\ninstruction = \"a\"\n[[steps]]\nname = \"a\"\ninstruction = \"b\"\n+++\n", wantErr: true},
+		{name: "Unknown filter", data: "+++\n[[steps]]\ninstruction = \"a\"\nfilters = [\"nope\"]\n+++\n", wantErr: true},
+		{
+			name: "Map-reduce",
+			data: "+++\n[map_reduce]\nparallel = 2\n+++\nSummarize.\n",
+			want: Script{Meta: Meta{MapReduce: &MapReduce{Parallel: 2}}, Instruction: "Summarize."},
+		},
+		{name: "Map-reduce and steps", data: "+++\n[map_reduce]\n[[steps]]\ninstruction = \"a\"\n+++\n", wantErr: true},
+		{name: "Negative map-reduce chunk size", data: "+++\n[map_reduce]\nchunk_tokens = -1\n+++\nSummarize.\n", wantErr: true},
+		{
+			name: "Description and params",
+			data: "+++\ndescription = \"Translates text.\"\n[[params]]\nname = \"lang\"\nvalues = [\"fr\", \"de\"]\ndefault = \"fr\"\n+++\nTranslate to {{lang}}.\n",
+			want: Script{Meta: Meta{Description: "Translates text.", Params: []Param{{Name: "lang", Values: []string{"fr", "de"}, Default: "fr"}}}, Instruction: "Translate to {{lang}}."},
+		},
+		{name: "Invalid param name", data: "+++\n[[params]]\nname = \"a b\"\n+++\nx\n", wantErr: true},
+		{name: "Reserved param name", data: "+++\n[[params]]\nname = \"input\"\n+++\nx\n", wantErr: true},
+		{name: "Duplicate params", data: "+++\n[[params]]\nname = \"a\"\n[[params]]\nname = \"a\"\n+++\nx\n", wantErr: true},
+		{name: "Param default not a value", data: "+++\n[[params]]\nname = \"a\"\nvalues = [\"x\"]\ndefault = \"y\"\n+++\nx\n", wantErr: true},
+		{name: "Only shebang", data: "#!/usr/bin/env dreampipe", wantErr: true},
+		{name: "Unclosed front-matter", data: "#!/usr/bin/env dreampipe\n+++\nmodel = \"x\"\nSummarize.\n", wantErr: true},
+		{name: "Unknown front-matter key", data: "#!/usr/bin/env dreampipe\n+++\nmodle = \"x\"\n+++\nSummarize.\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithParams(t *testing.T) {
+	s := Script{
+		Meta: Meta{Params: []Param{
+			{Name: "lang", Values: []string{"fr", "de"}, Default: "fr"},
+			{Name: "tone", Required: true},
+		}},
+		Instruction: "Translate to {{lang}} in a {{tone}} tone.",
+	}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "Default", values: map[string]string{"tone": "formal"}, want: "Translate to fr in a formal tone."},
+		{name: "Given", values: map[string]string{"lang": "de", "tone": "casual"}, want: "Translate to de in a casual tone."},
+		{name: "Placeholder in value", values: map[string]string{"tone": "{{lang}}"}, want: "Translate to fr in a {{lang}} tone."},
+		{name: "Missing required", values: map[string]string{"lang": "de"}, wantErr: true},
+		{name: "Value not allowed", values: map[string]string{"lang": "es", "tone": "formal"}, wantErr: true},
+		{name: "Unknown param", values: map[string]string{"tone": "formal", "style": "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.WithParams(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WithParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Instruction != tt.want {
+				t.Errorf("WithParams() instruction = %q, want %q", got.Instruction, tt.want)
+			}
+		})
+	}
+	if s.Instruction != "Translate to {{lang}} in a {{tone}} tone." {
+		t.Errorf("WithParams() changed the original script")
+	}
+}
+
+func TestExpandParams(t *testing.T) {
+	// Values that look like placeholders are inserted as they are, whatever
+	// order the parameters are replaced in.
+	values := map[string]string{"a": "{{b}}", "b": "{{c}}", "c": "{{d}}", "d": "{{e}}", "e": "done"}
+	got := ExpandParams("{{a}} {{b}} {{c}} {{d}} {{e}} {{f}}", values)
+	if want := "{{b}} {{c}} {{d}} {{e}} done {{f}}"; got != want {
+		t.Errorf("ExpandParams() = %q, want %q", got, want)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "bin")
+	s := Script{Meta: Meta{Provider: "ollama", Model: "llama3"}, Instruction: "Summarize as bullet points."}
+
+	path, err := Save(dir, "bullets", s, false)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Mode().Perm() != ScriptPerm {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(ScriptPerm))
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, s) {
+		t.Errorf("Load() = %+v, want %+v", loaded, s)
+	}
+
+	if _, err := Save(dir, "bullets", s, false); err == nil {
+		t.Errorf("Save() overwrote an existing script without force")
+	}
+	if _, err := Save(dir, "bullets", s, true); err != nil {
+		t.Errorf("Save() with force error = %v", err)
+	}
+	if _, err := Save(dir, "../escape", s, false); err == nil {
+		t.Errorf("Save() accepted a name with a path")
+	}
+}
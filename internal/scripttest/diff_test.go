@@ -0,0 +1,33 @@
+package scripttest
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     string
+	}{
+		{name: "Equal", expected: "a\nb", actual: "a\nb", want: ""},
+		{
+			name:     "Changed line",
+			expected: "a\nb\nc",
+			actual:   "a\nB\nc",
+			want:     "--- expected\n+++ actual\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:     "Unchanged lines collapsed",
+			expected: "1\n2\n3\n4\n5\n6\n7",
+			actual:   "1\n2\n3\n4\n5\n6\nseven",
+			want:     "--- expected\n+++ actual\n@@ 4 unchanged lines @@\n 5\n 6\n-7\n+seven\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.expected, tt.actual); got != tt.want {
+				t.Errorf("Diff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
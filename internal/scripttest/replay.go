@@ -0,0 +1,175 @@
+package scripttest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// ErrNotRecorded is returned in replay mode for a prompt without a recorded response.
+var ErrNotRecorded = errors.New("no recorded response for this prompt; run `dreampipe test --record` to record one")
+
+// Exchange is one recorded request and its response.
+type Exchange struct {
+	Provider string `json:"provider"`
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+}
+
+// Recording holds the responses recorded for a test file, so its cases can be
+// replayed without a provider.
+type Recording struct {
+	mu        sync.Mutex
+	Exchanges []Exchange     `json:"exchanges"`
+	index     map[string]int // Prompt hash to exchange
+}
+
+// LoadRecording reads the recording at path.
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no recording at %s; run `dreampipe test --record` first", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	rec := &Recording{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("failed to decode recording %s: %w", path, err)
+	}
+	rec.index = make(map[string]int, len(rec.Exchanges))
+	for i, exchange := range rec.Exchanges {
+		rec.index[promptKey(exchange.Prompt)] = i
+	}
+	return rec, nil
+}
+
+// Save writes the recording to path.
+func (rec *Recording) Save(path string) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// add records a response, replacing an earlier one for the same prompt.
+func (rec *Recording) add(exchange Exchange) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.index == nil {
+		rec.index = make(map[string]int)
+	}
+	key := promptKey(exchange.Prompt)
+	if i, ok := rec.index[key]; ok {
+		rec.Exchanges[i] = exchange
+		return
+	}
+	rec.index[key] = len(rec.Exchanges)
+	rec.Exchanges = append(rec.Exchanges, exchange)
+}
+
+// lookup returns the response recorded for prompt.
+func (rec *Recording) lookup(prompt string) (string, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	i, ok := rec.index[promptKey(prompt)]
+	if !ok {
+		return "", ErrNotRecorded
+	}
+	return rec.Exchanges[i].Response, nil
+}
+
+// promptKey identifies a prompt in the index.
+func promptKey(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// chatPrompt flattens a conversation into the text it is recorded under.
+func chatPrompt(messages []llm.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&sb, "[%s]\n%s\n", m.Role, m.Content)
+	}
+	return sb.String()
+}
+
+// recordingClient passes requests to the provider and records the responses.
+type recordingClient struct {
+	llm.Client
+	rec *Recording
+}
+
+// Generate sends the prompt to the provider and records the response.
+func (c *recordingClient) Generate(ctx context.Context, prompt string) (llm.Response, error) {
+	resp, err := c.Client.Generate(ctx, prompt)
+	if err == nil {
+		c.rec.add(Exchange{Provider: c.ProviderName(), Prompt: prompt, Response: resp.Text})
+	}
+	return resp, err
+}
+
+// Chat sends the conversation to the provider and records the response.
+func (c *recordingClient) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	resp, err := c.Client.Chat(ctx, messages)
+	if err == nil {
+		c.rec.add(Exchange{Provider: c.ProviderName(), Prompt: chatPrompt(messages), Response: resp.Text})
+	}
+	return resp, err
+}
+
+// replayClient answers from a recording without contacting a provider.
+type replayClient struct {
+	provider string
+	rec      *Recording
+}
+
+// Generate returns the response recorded for prompt.
+func (c *replayClient) Generate(ctx context.Context, prompt string) (llm.Response, error) {
+	text, err := c.rec.lookup(prompt)
+	return llm.Response{Text: text}, err
+}
+
+// Chat returns the response recorded for the conversation.
+func (c *replayClient) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	text, err := c.rec.lookup(chatPrompt(messages))
+	return llm.Response{Text: text}, err
+}
+
+// ProviderName returns the provider the responses are attributed to.
+func (c *replayClient) ProviderName() string {
+	return c.provider
+}
+
+// useClients replaces llm.GetClient for the duration of a suite, the way the
+// tests substitute a fake client, and returns a function restoring it.
+func useClients(mode Mode, rec *Recording) func() {
+	original := llm.GetClient
+	switch mode {
+	case ModeRecord:
+		llm.GetClient = func(cfg config.Config, debugMode bool) (llm.Client, error) {
+			client, err := original(cfg, debugMode)
+			if err != nil {
+				return nil, err
+			}
+			return &recordingClient{Client: client, rec: rec}, nil
+		}
+	case ModeReplay:
+		llm.GetClient = func(cfg config.Config, debugMode bool) (llm.Client, error) {
+			return &replayClient{provider: cfg.DefaultProvider, rec: rec}, nil
+		}
+	}
+	return func() { llm.GetClient = original }
+}
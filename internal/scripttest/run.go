@@ -0,0 +1,253 @@
+package scripttest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// Mode selects where the responses of a test run come from.
+type Mode int
+
+const (
+	// ModeLive sends every request to the configured provider.
+	ModeLive Mode = iota
+	// ModeRecord sends requests to the provider and saves the responses next to the test file.
+	ModeRecord
+	// ModeReplay answers requests from the saved responses, without a provider.
+	ModeReplay
+)
+
+// judgePrompt asks the LLM judge whether an output meets a case's criteria.
+const judgePrompt = `You are reviewing the output of a command line tool that uses a language model. Decide whether the output meets the criteria below.
+
+Criteria:
+
+%s
+
+---
+
+Input given to the tool:
+
+%s
+
+---
+
+Output of the tool:
+
+%s
+
+---
+
+Reply with PASS or FAIL on the first line, followed by one sentence explaining why.`
+
+// Options configure a test run.
+type Options struct {
+	Mode   Mode
+	Update bool           // Write the actual output to the expected_file of each case
+	Filter *regexp.Regexp // Only run cases whose name matches, if set
+	Debug  bool
+}
+
+// Failure is a check a case did not pass.
+type Failure struct {
+	Check   string // expected, contains, regex, json_schema, judge...
+	Message string
+	Diff    string // Line diff against the expected output, if any
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	Name     string
+	Output   string
+	Failures []Failure
+	Err      error  // The script itself failed
+	Stderr   string // What the script wrote to stderr, shown when it failed
+	Duration time.Duration
+}
+
+// Passed reports whether the case ran and passed every check.
+func (r CaseResult) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// SuiteResult is the outcome of a test file.
+type SuiteResult struct {
+	Suite  *Suite
+	Script string
+	Cases  []CaseResult
+}
+
+// Run runs the cases of suite against its script with cfg.
+func Run(cfg config.Config, suite *Suite, opts Options) (*SuiteResult, error) {
+	scriptPath, err := suite.ScriptPath()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recording{}
+	switch opts.Mode {
+	case ModeReplay:
+		if rec, err = LoadRecording(suite.RecordingPath()); err != nil {
+			return nil, err
+		}
+		// Replays cost nothing and shouldn't show up in `dreampipe usage`.
+		cfg.RecordUsage = false
+	case ModeRecord:
+		// Keep the responses of cases left out by opts.Filter.
+		if _, statErr := os.Stat(suite.RecordingPath()); statErr == nil {
+			if rec, err = LoadRecording(suite.RecordingPath()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	restore := useClients(opts.Mode, rec)
+	defer restore()
+
+	result := &SuiteResult{Suite: suite, Script: scriptPath}
+	for _, c := range suite.Cases {
+		if opts.Filter != nil && !opts.Filter.MatchString(c.Name) {
+			continue
+		}
+		result.Cases = append(result.Cases, runCase(cfg, suite, scriptPath, c, opts))
+	}
+
+	if opts.Mode == ModeRecord {
+		if err := rec.Save(suite.RecordingPath()); err != nil {
+			return result, fmt.Errorf("failed to save recording: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// runCase pipes the case's input through the script and checks the output.
+func runCase(cfg config.Config, suite *Suite, scriptPath string, c Case, opts Options) CaseResult {
+	result := CaseResult{Name: c.Name}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	input, err := readOr(suite, c.Input, c.InputFile)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	var stdout, stderr bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader(input), Out: &stdout, Err: &stderr}
+	runner := app.NewRunner(cfg, streams, opts.Debug)
+	if err := runner.Run(app.ModeScript, scriptPath, c.Context); err != nil {
+		result.Err = err
+		result.Stderr = stderr.String()
+		return result
+	}
+	result.Output = strings.TrimSpace(stdout.String())
+
+	if opts.Update && c.ExpectedFile != "" {
+		if err := os.WriteFile(suite.resolve(c.ExpectedFile), []byte(result.Output+"\n"), 0644); err != nil {
+			result.Err = fmt.Errorf("failed to update %s: %w", c.ExpectedFile, err)
+			return result
+		}
+	}
+	result.Failures, result.Err = check(cfg, suite, c, input, result.Output, opts.Debug)
+	return result
+}
+
+// check runs every check of c against output and returns the failed ones.
+func check(cfg config.Config, suite *Suite, c Case, input, output string, debug bool) ([]Failure, error) {
+	var failures []Failure
+
+	expected, err := readOr(suite, c.Expected, c.ExpectedFile)
+	if err != nil {
+		return nil, err
+	}
+	if expected != "" || c.ExpectedFile != "" {
+		expected = strings.TrimSpace(expected)
+		if expected != output {
+			failures = append(failures, Failure{Check: "expected", Message: "output differs from the expected output", Diff: Diff(expected, output)})
+		}
+	}
+	for _, s := range c.Contains {
+		if !strings.Contains(output, s) {
+			failures = append(failures, Failure{Check: "contains", Message: fmt.Sprintf("output does not contain %q", s)})
+		}
+	}
+	for _, s := range c.NotContains {
+		if strings.Contains(output, s) {
+			failures = append(failures, Failure{Check: "not_contains", Message: fmt.Sprintf("output contains %q", s)})
+		}
+	}
+	for _, pattern := range c.Regex {
+		if !regexp.MustCompile(pattern).MatchString(output) {
+			failures = append(failures, Failure{Check: "regex", Message: fmt.Sprintf("output does not match %q", pattern)})
+		}
+	}
+	schema, err := readOr(suite, c.JSONSchema, c.JSONSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	if schema != "" {
+		if err := ValidateJSON(schema, output); err != nil {
+			failures = append(failures, Failure{Check: "json_schema", Message: err.Error()})
+		}
+	}
+	if c.Judge != "" {
+		passed, reason, err := judge(cfg, c.Judge, input, output, debug)
+		if err != nil {
+			return nil, fmt.Errorf("LLM judge failed: %w", err)
+		}
+		if !passed {
+			failures = append(failures, Failure{Check: "judge", Message: reason})
+		}
+	}
+	return failures, nil
+}
+
+// judge asks the configured provider whether output meets criteria.
+func judge(cfg config.Config, criteria, input, output string, debug bool) (bool, string, error) {
+	client, err := llm.GetClient(cfg, debug)
+	if err != nil {
+		return false, "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.RequestTimeoutSeconds)*time.Second)
+	defer cancel()
+	resp, err := client.Generate(ctx, fmt.Sprintf(judgePrompt, strings.TrimSpace(criteria), strings.TrimSpace(input), output))
+	if err != nil {
+		return false, "", err
+	}
+
+	verdict, reason, _ := strings.Cut(strings.TrimSpace(resp.Text), "\n")
+	verdict = strings.ToUpper(strings.Trim(verdict, " *.:"))
+	reason = strings.TrimSpace(reason)
+	switch {
+	case strings.HasPrefix(verdict, "PASS"):
+		return true, reason, nil
+	case strings.HasPrefix(verdict, "FAIL"):
+		if reason == "" {
+			reason = "the judge found that the output does not meet the criteria"
+		}
+		return false, reason, nil
+	default:
+		return false, fmt.Sprintf("no PASS or FAIL verdict in the reply: %q", strings.TrimSpace(resp.Text)), nil
+	}
+}
+
+// readOr returns value, or the contents of file relative to the test file.
+func readOr(suite *Suite, value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(suite.resolve(file))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return string(data), nil
+}
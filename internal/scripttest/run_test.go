@@ -0,0 +1,159 @@
+package scripttest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// fakeClient answers like a provider that shouts the input and judges
+// everything loud.
+type fakeClient struct{}
+
+func (fakeClient) Generate(ctx context.Context, prompt string) (llm.Response, error) {
+	if strings.Contains(prompt, "Reply with PASS or FAIL") {
+		if strings.Contains(prompt, "quiet") {
+			return llm.Response{Text: "FAIL\nThe output is loud."}, nil
+		}
+		return llm.Response{Text: "PASS\nThe output is loud."}, nil
+	}
+	_, input, _ := strings.Cut(prompt, "Input:\n\n")
+	return llm.Response{Text: strings.ToUpper(input)}, nil
+}
+
+func (c fakeClient) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	return c.Generate(ctx, messages[len(messages)-1].Content)
+}
+
+func (fakeClient) ProviderName() string { return "fake" }
+
+func TestRun_RecordAndReplay(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("shout.md", "#!/usr/bin/env dreampipe\n\nShout the input.\n")
+	writeFile("shout.golden.txt", "GOLDEN\n")
+	writeFile("shout.test.toml", `
+[[cases]]
+name = "contains"
+input = "hello"
+contains = ["HELLO"]
+regex = ['^HEL+O$']
+
+[[cases]]
+name = "golden"
+input = "golden"
+expected_file = "shout.golden.txt"
+
+[[cases]]
+name = "json"
+input = '{"a": 1}'
+json_schema = '{"type": "object", "required": ["A"]}'
+
+[[cases]]
+name = "judge"
+input = "hello"
+judge = "The output is loud."
+
+[[cases]]
+name = "failing"
+input = "hello"
+expected = "HELLO\nWORLD"
+not_contains = ["HELLO"]
+judge = "The output is quiet."
+`)
+
+	suite, err := LoadSuite(filepath.Join(dir, "shout.test.toml"))
+	if err != nil {
+		t.Fatalf("LoadSuite() error = %v", err)
+	}
+	cfg := config.Config{
+		DefaultProvider:       "fake",
+		RequestTimeoutSeconds: 5,
+		LLMs:                  map[string]config.LLMConfig{"fake": {}},
+	}
+
+	check := func(result *SuiteResult) {
+		t.Helper()
+		if len(result.Cases) != 5 {
+			t.Fatalf("expected 5 case results, got %d", len(result.Cases))
+		}
+		for _, c := range result.Cases[:4] {
+			if !c.Passed() {
+				t.Errorf("case %q failed: %v %+v", c.Name, c.Err, c.Failures)
+			}
+		}
+		failing := result.Cases[4]
+		var checks []string
+		for _, f := range failing.Failures {
+			checks = append(checks, f.Check)
+		}
+		if got, want := strings.Join(checks, ","), "expected,not_contains,judge"; got != want {
+			t.Errorf("failing case failed %s, want %s", got, want)
+		}
+		if diff := failing.Failures[0].Diff; !strings.Contains(diff, "-WORLD") {
+			t.Errorf("expected a diff removing WORLD, got:\n%s", diff)
+		}
+	}
+
+	originalGetClient := llm.GetClient
+	defer func() { llm.GetClient = originalGetClient }()
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) { return fakeClient{}, nil }
+
+	result, err := Run(cfg, suite, Options{Mode: ModeRecord})
+	if err != nil {
+		t.Fatalf("Run(ModeRecord) error = %v", err)
+	}
+	check(result)
+
+	// Replaying needs no provider at all.
+	llm.GetClient = func(c config.Config, debugMode bool) (llm.Client, error) {
+		return nil, errors.New("provider unavailable")
+	}
+	result, err = Run(cfg, suite, Options{Mode: ModeReplay})
+	if err != nil {
+		t.Fatalf("Run(ModeReplay) error = %v", err)
+	}
+	check(result)
+
+	// A changed prompt has no recorded response.
+	writeFile("shout.md", "#!/usr/bin/env dreampipe\n\nWhisper the input.\n")
+	result, err = Run(cfg, suite, Options{Mode: ModeReplay})
+	if err != nil {
+		t.Fatalf("Run(ModeReplay) error = %v", err)
+	}
+	if c := result.Cases[0]; !errors.Is(c.Err, ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded for a changed prompt, got %v", c.Err)
+	}
+}
+
+func TestLoadSuite_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"No cases":        ``,
+		"No checks":       "[[cases]]\ninput = \"x\"\n",
+		"Unknown key":     "[[cases]]\ncontains = [\"x\"]\nexpect = \"x\"\n",
+		"Bad regex":       "[[cases]]\nregex = [\"(\"]\n",
+		"Duplicate names": "[[cases]]\nname = \"a\"\ncontains = [\"x\"]\n[[cases]]\nname = \"a\"\ncontains = [\"x\"]\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "x.test.toml")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadSuite(path); err == nil {
+				t.Errorf("LoadSuite() accepted an invalid test file")
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package scripttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ValidateJSON checks that data is JSON valid against schema. It supports the
+// subset of JSON Schema that describes the shape of LLM output: type, enum,
+// const, properties, required, additionalProperties, minProperties,
+// maxProperties, items, minItems, maxItems, minLength, maxLength, pattern,
+// minimum and maximum. Other keywords are ignored.
+func ValidateJSON(schema, data string) error {
+	var s map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("output has more than one JSON value")
+	}
+	return validateValue(s, v, "$")
+}
+
+// validateValue checks v against schema s; path names v in errors.
+func validateValue(s map[string]interface{}, v interface{}, path string) error {
+	if t, ok := s["type"]; ok {
+		if err := checkType(t, v, path); err != nil {
+			return err
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(allowed, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %s is not one of the allowed values", path, describeValue(v))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		return fmt.Errorf("%s: %s is not the expected constant", path, describeValue(v))
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return validateObject(s, value, path)
+	case []interface{}:
+		if n, ok := number(s["minItems"]); ok && float64(len(value)) < n {
+			return fmt.Errorf("%s: has %d items, fewer than minItems %v", path, len(value), n)
+		}
+		if n, ok := number(s["maxItems"]); ok && float64(len(value)) > n {
+			return fmt.Errorf("%s: has %d items, more than maxItems %v", path, len(value), n)
+		}
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(value)))
+		if n, ok := number(s["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: is %v characters, shorter than minLength %v", path, length, n)
+		}
+		if n, ok := number(s["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: is %v characters, longer than maxLength %v", path, length, n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid JSON schema: pattern %q: %w", pattern, err)
+			}
+			if !re.MatchString(value) {
+				return fmt.Errorf("%s: %q does not match pattern %q", path, value, pattern)
+			}
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if n, ok := number(s["minimum"]); ok && f < n {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, f, n)
+		}
+		if n, ok := number(s["maximum"]); ok && f > n {
+			return fmt.Errorf("%s: %v is greater than maximum %v", path, f, n)
+		}
+	}
+	return nil
+}
+
+// validateObject checks the object keywords of s against value.
+func validateObject(s map[string]interface{}, value map[string]interface{}, path string) error {
+	if n, ok := number(s["minProperties"]); ok && float64(len(value)) < n {
+		return fmt.Errorf("%s: has %d properties, fewer than minProperties %v", path, len(value), n)
+	}
+	if n, ok := number(s["maxProperties"]); ok && float64(len(value)) > n {
+		return fmt.Errorf("%s: has %d properties, more than maxProperties %v", path, len(value), n)
+	}
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, key := range required {
+			if name, ok := key.(string); ok {
+				if _, present := value[name]; !present {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+	}
+	properties, _ := s["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report the same error every time
+	for _, key := range keys {
+		propSchema, known := properties[key].(map[string]interface{})
+		if !known {
+			if allowed, ok := s["additionalProperties"].(bool); ok && !allowed {
+				return fmt.Errorf("%s: unexpected property %q", path, key)
+			}
+			continue
+		}
+		if err := validateValue(propSchema, value[key], path+"."+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkType checks v against a type keyword, a name or a list of names.
+func checkType(t interface{}, v interface{}, path string) error {
+	var allowed []string
+	switch types := t.(type) {
+	case string:
+		allowed = []string{types}
+	case []interface{}:
+		for _, name := range types {
+			if s, ok := name.(string); ok {
+				allowed = append(allowed, s)
+			}
+		}
+	}
+	actual := jsonType(v)
+	for _, name := range allowed {
+		if name == actual || (name == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(allowed, " or "), actual)
+}
+
+// jsonType returns the JSON Schema type name of a decoded value.
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) && !strings.ContainsAny(value.String(), ".eE") {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// number returns a schema keyword as a float64, if it is a number.
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// jsonEqual compares a schema value, decoded without UseNumber, with an output value.
+func jsonEqual(schemaValue, v interface{}) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return err == nil && reflect.DeepEqual(schemaValue, f)
+	}
+	return reflect.DeepEqual(schemaValue, v)
+}
+
+// describeValue formats a value for an error message.
+func describeValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
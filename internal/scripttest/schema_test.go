@@ -0,0 +1,46 @@
+package scripttest
+
+import "testing"
+
+func TestValidateJSON(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["name", "tags"],
+		"maxProperties": 4,
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+			"age": {"type": "integer", "minimum": 0},
+			"score": {"type": "number", "maximum": 1},
+			"tags": {"type": "array", "minItems": 1, "items": {"enum": ["a", "b"]}}
+		}
+	}`
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "Valid", data: `{"name": "Ada", "age": 36, "score": 0.5, "tags": ["a"]}`},
+		{name: "Not JSON", data: `Here is the JSON: {}`, wantErr: true},
+		{name: "Two values", data: `{} {}`, wantErr: true},
+		{name: "Wrong type", data: `[]`, wantErr: true},
+		{name: "Missing required", data: `{"name": "Ada"}`, wantErr: true},
+		{name: "Additional property", data: `{"name": "Ada", "tags": ["a"], "extra": 1}`, wantErr: true},
+		{name: "Pattern", data: `{"name": "ada", "tags": ["a"]}`, wantErr: true},
+		{name: "Integer", data: `{"name": "Ada", "age": 36.5, "tags": ["a"]}`, wantErr: true},
+		{name: "Minimum", data: `{"name": "Ada", "age": -1, "tags": ["a"]}`, wantErr: true},
+		{name: "Maximum", data: `{"name": "Ada", "score": 2, "tags": ["a"]}`, wantErr: true},
+		{name: "Min items", data: `{"name": "Ada", "tags": []}`, wantErr: true},
+		{name: "Max properties", data: `{"name": "Ada", "age": 36, "score": 0.5, "tags": ["a"], "name2": 1}`, wantErr: true},
+		{name: "Enum", data: `{"name": "Ada", "tags": ["c"]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Package scripttest runs the test cases kept next to dreampipe scripts: each
+// case pipes an input through the script and checks the output against an
+// expected (golden) output and assertions such as contains, regex, JSON
+// schema or an LLM judge.
+package scripttest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// TestFileSuffix replaces a script's .md extension, if any, to name its tests:
+	// the tests of eli5.md or eli5 are in eli5.test.toml.
+	TestFileSuffix = ".test.toml"
+	// recordingSuffix names the recorded responses of a test file.
+	recordingSuffix = ".replay.json"
+	scriptExt       = ".md"
+)
+
+// Suite is a test file: the script under test and its cases.
+type Suite struct {
+	Path   string `toml:"-"`      // Path of the test file
+	Script string `toml:"script"` // Script under test, relative to the test file; found by name if empty
+	Cases  []Case `toml:"cases"`
+}
+
+// Case is one test of a script. Files are relative to the test file.
+type Case struct {
+	Name           string   `toml:"name"`
+	Input          string   `toml:"input"`            // Piped to the script
+	InputFile      string   `toml:"input_file"`       // Read instead of Input
+	Context        string   `toml:"context"`          // Like --context
+	Expected       string   `toml:"expected"`         // Exact output, ignoring surrounding whitespace
+	ExpectedFile   string   `toml:"expected_file"`    // Golden file with the exact output, see --update
+	Contains       []string `toml:"contains"`         // Substrings the output must contain
+	NotContains    []string `toml:"not_contains"`     // Substrings the output must not contain
+	Regex          []string `toml:"regex"`            // Patterns the output must match
+	JSONSchema     string   `toml:"json_schema"`      // The output must be JSON valid against this schema
+	JSONSchemaFile string   `toml:"json_schema_file"` // Read instead of JSONSchema
+	Judge          string   `toml:"judge"`            // Criteria an LLM checks the output against
+}
+
+// LoadSuite reads and checks the test file at path.
+func LoadSuite(path string) (*Suite, error) {
+	suite := &Suite{Path: path}
+	meta, err := toml.DecodeFile(path, suite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test file %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("test file %s: unknown keys: %v", path, undecoded)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("test file %s has no [[cases]]", path)
+	}
+	names := make(map[string]bool)
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+			suite.Cases[i].Name = c.Name
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("test file %s: two cases are called %q", path, c.Name)
+		}
+		names[c.Name] = true
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("test file %s, case %q: %w", path, c.Name, err)
+		}
+	}
+	return suite, nil
+}
+
+// validate checks that the case checks something and that its patterns compile.
+func (c Case) validate() error {
+	if c.Input != "" && c.InputFile != "" {
+		return errors.New("set input or input_file, not both")
+	}
+	if c.Expected != "" && c.ExpectedFile != "" {
+		return errors.New("set expected or expected_file, not both")
+	}
+	if c.JSONSchema != "" && c.JSONSchemaFile != "" {
+		return errors.New("set json_schema or json_schema_file, not both")
+	}
+	if c.Expected == "" && c.ExpectedFile == "" && len(c.Contains) == 0 && len(c.NotContains) == 0 &&
+		len(c.Regex) == 0 && c.JSONSchema == "" && c.JSONSchemaFile == "" && c.Judge == "" {
+		return errors.New("no checks: set expected, expected_file, contains, not_contains, regex, json_schema or judge")
+	}
+	for _, pattern := range c.Regex {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ScriptPath returns the script the suite tests: the script key if set,
+// otherwise the file next to the test file with the same name, with or
+// without .md.
+func (s *Suite) ScriptPath() (string, error) {
+	if s.Script != "" {
+		return s.resolve(s.Script), nil
+	}
+	base := strings.TrimSuffix(s.Path, TestFileSuffix)
+	for _, candidate := range []string{base, base + scriptExt} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no script found for %s: expected %s or %s, or set script in the test file", s.Path, base, base+scriptExt)
+}
+
+// RecordingPath returns where the responses recorded for the suite are kept.
+func (s *Suite) RecordingPath() string {
+	return strings.TrimSuffix(s.Path, TestFileSuffix) + recordingSuffix
+}
+
+// resolve returns path relative to the test file's directory.
+func (s *Suite) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.Path), path)
+}
+
+// TestFileFor returns the test file of the script at scriptPath.
+func TestFileFor(scriptPath string) string {
+	return strings.TrimSuffix(scriptPath, scriptExt) + TestFileSuffix
+}
+
+// FindTestFiles returns the test files in dir and its subdirectories.
+func FindTestFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), TestFileSuffix) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s for test files: %w", dir, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+)
+
+// --- OpenAI-compatible API ---
+//
+// Only the parts of the chat completions API that dreampipe's providers can
+// serve are supported: the messages, the model and streaming. The model
+// selects the provider: "groq" uses the groq entry with its configured model
+// and "groq/llama3-70b-8192" a model of it. Other names are rejected rather
+// than sent to the default provider, so a typo doesn't become a provider
+// error and callers can only use the models of configured entries.
+
+// chatRequest is the body of POST /v1/chat/completions.
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+// chatMessage is a message of a chat request. Content is a string, or an
+// array of parts of which only the text parts are used.
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's content as text.
+func (m chatMessage) text() (string, error) {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", fmt.Errorf("content of a %s message must be a string or an array of parts", m.Role)
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// chatResponse is the body of a chat completion, and of each chunk of a
+// streamed one.
+type chatResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+}
+
+// chatChoice is the single choice of a response: Message when complete,
+// Delta in a chunk.
+type chatChoice struct {
+	Index        int           `json:"index"`
+	Message      *replyMessage `json:"message,omitempty"`
+	Delta        *replyMessage `json:"delta,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+// replyMessage is the assistant's reply.
+type replyMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// chatUsage holds the token counts of a response.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// modelList is the body of GET /v1/models.
+type modelList struct {
+	Object string      `json:"object"`
+	Data   []modelInfo `json:"data"`
+}
+
+// modelInfo is a model of GET /v1/models.
+type modelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// handleModels lists the configured providers, and each with its model, as
+// the models a chat request can ask for.
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	list := modelList{Object: "list", Data: []modelInfo{}}
+	for _, name := range llm.ConfiguredProviders(s.cfg) {
+		list.Data = append(list.Data, modelInfo{ID: name, Object: "model", OwnedBy: "dreampipe"})
+		if model := s.cfg.LLMs[name].Model; model != "" {
+			list.Data = append(list.Data, modelInfo{ID: name + "/" + model, Object: "model", OwnedBy: "dreampipe"})
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleChatCompletions sends a chat request to the provider the model
+// selects, with the limits, redaction and usage recording of a run.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", "messages must not be empty")
+		return
+	}
+	messages := make([]llm.Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		text, err := m.text()
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+			return
+		}
+		role := m.Role
+		if role == "developer" {
+			role = llm.RoleSystem
+		}
+		messages = append(messages, llm.Message{Role: role, Content: text})
+	}
+	cfg, err := s.configForModel(req.Model)
+	if err != nil {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found", err.Error())
+		return
+	}
+
+	streams := &iohandler.Streams{In: strings.NewReader(""), Out: io.Discard, Err: s.logOutput}
+	resp, err := s.newRunner(cfg, streams).Complete(r.Context(), messages)
+	if err != nil {
+		status := runStatus(err)
+		errType := "api_error"
+		if errors.Is(err, app.ErrLimitExceeded) {
+			errType = "rate_limit_error"
+		}
+		writeOpenAIError(w, status, errType, "", err.Error())
+		return
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = cfg.LLMs[cfg.DefaultProvider].Model
+	}
+	completion := chatResponse{ID: newCompletionID(), Created: time.Now().Unix(), Model: model}
+	stop := "stop"
+	if !req.Stream {
+		completion.Object = "chat.completion"
+		completion.Choices = []chatChoice{{Message: &replyMessage{Role: llm.RoleAssistant, Content: resp.Text}, FinishReason: &stop}}
+		completion.Usage = &chatUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	// Providers answer in one piece, so the stream has a single content chunk;
+	// the header tells clients not to expect more.
+	w.Header().Set("X-Dreampipe-Stream", "single-chunk")
+	events, ok := newEventWriter(w)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "api_error", "", "streaming is not supported by this connection")
+		return
+	}
+	completion.Object = "chat.completion.chunk"
+	for _, choice := range []chatChoice{
+		{Delta: &replyMessage{Role: llm.RoleAssistant, Content: resp.Text}},
+		{Delta: &replyMessage{}, FinishReason: &stop},
+	} {
+		completion.Choices = []chatChoice{choice}
+		data, _ := json.Marshal(completion)
+		events.sendData(string(data))
+	}
+	events.sendData("[DONE]")
+}
+
+// configForModel returns the configuration for a request asking for model.
+func (s *Server) configForModel(model string) (config.Config, error) {
+	if model == "" {
+		return s.cfg, nil
+	}
+	if _, exists := s.cfg.LLMs[model]; exists {
+		return app.ConfigWith(s.cfg, model, "")
+	}
+	if provider, providerModel, found := strings.Cut(model, "/"); found && providerModel != "" {
+		if _, exists := s.cfg.LLMs[provider]; exists {
+			return app.ConfigWith(s.cfg, provider, providerModel)
+		}
+	}
+	return config.Config{}, fmt.Errorf("the model %q does not exist: use a provider or provider/model from /v1/models", model)
+}
+
+// writeOpenAIError writes an error in the format of OpenAI's API, which its
+// client libraries understand; code is optional.
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	var body struct {
+		Error struct {
+			Message string  `json:"message"`
+			Type    string  `json:"type"`
+			Code    *string `json:"code"`
+		} `json:"error"`
+	}
+	body.Error.Message = message
+	body.Error.Type = errType
+	if code != "" {
+		body.Error.Code = &code
+	}
+	writeJSON(w, status, body)
+}
+
+// newCompletionID returns a random ID for a chat completion.
+func newCompletionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
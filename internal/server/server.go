@@ -0,0 +1,375 @@
+// Package server exposes dreampipe over HTTP: scripts as endpoints that
+// transform the request body, and an OpenAI-compatible chat completions proxy
+// to the configured providers.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+const (
+	// maxBodyBytes caps request bodies before [limits] max_input_bytes applies.
+	maxBodyBytes = 32 << 20
+	// heartbeatInterval is how often streamed responses send a comment while
+	// waiting, so proxies don't close idle connections.
+	heartbeatInterval = 15 * time.Second
+)
+
+// Server handles the HTTP API. It is safe for concurrent use; every request
+// is a separate run.
+type Server struct {
+	cfg     config.Config
+	library *script.Library
+	token   string
+	debug   bool
+	// logOutput receives the warnings and errors of runs, usually stderr.
+	logOutput io.Writer
+	// logger writes the access log to logOutput.
+	logger *log.Logger
+	// clientFactory creates the LLM clients; nil uses llm.GetClient.
+	clientFactory func(cfg config.Config, debugMode bool) (llm.Client, error)
+	// spend is shared by the runners of all requests, so that concurrent
+	// ones count against daily_spend_usd together.
+	spend *app.SpendGuard
+}
+
+// Options configure a Server.
+type Options struct {
+	// Token, when set, must be sent as "Authorization: Bearer <token>".
+	Token     string
+	Debug     bool
+	LogOutput io.Writer // Receives warnings and the access log; defaults to io.Discard
+}
+
+// New returns a server running the scripts of library with cfg.
+func New(cfg config.Config, library *script.Library, opts Options) *Server {
+	s := &Server{cfg: cfg, library: library, token: opts.Token, debug: opts.Debug, logOutput: opts.LogOutput, spend: app.NewSpendGuard()}
+	if s.logOutput == nil {
+		s.logOutput = io.Discard
+	}
+	s.logger = log.New(s.logOutput, "", log.LstdFlags)
+	return s
+}
+
+// SetClientFactory makes the server create its LLM clients with factory
+// instead of llm.GetClient.
+func (s *Server) SetClientFactory(factory func(cfg config.Config, debugMode bool) (llm.Client, error)) {
+	s.clientFactory = factory
+}
+
+// Handler returns the routes of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /scripts", s.handleScripts)
+	mux.HandleFunc("POST /run/{name}", s.handleRun)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	return s.authorize(mux)
+}
+
+// authorize rejects requests without the token, when one is set.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.Printf("%s %s %d %v", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// newRunner returns a runner for one request, reading input and writing
+// output through the given streams.
+func (s *Server) newRunner(cfg config.Config, streams *iohandler.Streams) *app.Runner {
+	runner := app.NewRunner(cfg, streams, s.debug)
+	runner.SetRecordLastRun(false)
+	runner.SetProgress(false)
+	runner.SetSpendGuard(s.spend)
+	if s.clientFactory != nil {
+		runner.SetClientFactory(s.clientFactory)
+	}
+	return runner
+}
+
+// --- Scripts ---
+
+// scriptInfo describes a script in the response of GET /scripts.
+type scriptInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// handleScripts lists the scripts that can be run.
+func (s *Server) handleScripts(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.library.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scripts := make([]scriptInfo, 0, len(entries))
+	for _, entry := range entries {
+		scripts = append(scripts, scriptInfo{Name: entry.Name, Description: entry.Description})
+	}
+	writeJSON(w, http.StatusOK, scripts)
+}
+
+// handleRun runs a script on the request body and returns its output, or
+// streams the run as server-sent events when the client asks for them. Query
+// parameters other than stream set the script's params.
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	path, err := s.library.Find(r.PathValue("name"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, script.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	params := runParams(r)
+	// Bad params are the client's mistake, not the provider's.
+	if err := checkParams(path, params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The body is read first: once a streamed response starts, it can't be.
+	input, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), runStatus(err))
+		return
+	}
+	if wantsStream(r) {
+		s.streamRun(w, r.Context(), path, params, bytes.NewReader(input))
+		return
+	}
+
+	var stdout bytes.Buffer
+	streams := &iohandler.Streams{In: bytes.NewReader(input), Out: &stdout, Err: s.logOutput}
+	runner := s.newRunner(s.cfg, streams)
+	runner.SetParams(params)
+	if err := runner.RunContext(r.Context(), app.ModeScript, path, ""); err != nil {
+		http.Error(w, err.Error(), runStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(stdout.Bytes())
+}
+
+// streamRun runs the script at path, sending its warnings and debug messages
+// as "log" events while it runs, then the output as an "output" event or the
+// failure as an "error" event, and finally a "done" event.
+func (s *Server) streamRun(w http.ResponseWriter, ctx context.Context, path string, params map[string]string, input io.Reader) {
+	events, ok := newEventWriter(w)
+	if !ok {
+		http.Error(w, "streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+	stop := events.heartbeat(heartbeatInterval)
+	defer stop()
+
+	var stdout bytes.Buffer
+	logs := &lineWriter{emit: func(line string) { events.send("log", line) }}
+	streams := &iohandler.Streams{In: input, Out: &stdout, Err: io.MultiWriter(logs, s.logOutput)}
+	runner := s.newRunner(s.cfg, streams)
+	runner.SetParams(params)
+	err := runner.RunContext(ctx, app.ModeScript, path, "")
+	logs.Flush()
+	if err != nil {
+		events.send("error", err.Error())
+	} else {
+		events.send("output", strings.TrimSuffix(stdout.String(), "\n"))
+	}
+	events.send("done", "")
+}
+
+// runParams returns the script params given as query parameters, all but
+// stream; the last value of a repeated one wins.
+func runParams(r *http.Request) map[string]string {
+	params := map[string]string{}
+	for name, values := range r.URL.Query() {
+		if name != "stream" {
+			params[name] = values[len(values)-1]
+		}
+	}
+	return params
+}
+
+// checkParams reports whether params are valid for the script at path.
+func checkParams(path string, params map[string]string) error {
+	s, err := script.Load(path)
+	if err != nil {
+		return err
+	}
+	_, err = s.WithParams(params)
+	return err
+}
+
+// wantsStream reports whether the client asked for server-sent events.
+func wantsStream(r *http.Request) bool {
+	switch r.URL.Query().Get("stream") {
+	case "1", "true":
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// runStatus maps the error of a run to an HTTP status.
+func runStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, app.ErrLimitExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// --- Server-sent events ---
+
+// eventWriter writes server-sent events, one at a time.
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newEventWriter starts an event stream on w.
+func newEventWriter(w http.ResponseWriter) (*eventWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventWriter{w: w, flusher: flusher}, true
+}
+
+// send writes one event; every line of data becomes a data field.
+func (e *eventWriter) send(event, data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(e.w, "data: %s\n", line)
+	}
+	fmt.Fprint(e.w, "\n")
+	e.flusher.Flush()
+}
+
+// sendData writes an unnamed event, as OpenAI's streaming API does.
+func (e *eventWriter) sendData(data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "data: %s\n\n", data)
+	e.flusher.Flush()
+}
+
+// heartbeat sends a comment every interval until the returned function is called.
+func (e *eventWriter) heartbeat(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				e.mu.Lock()
+				fmt.Fprint(e.w, ": waiting\n\n")
+				e.flusher.Flush()
+				e.mu.Unlock()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// lineWriter calls emit for every complete line written to it.
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	emit func(line string)
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Write(p)
+	for {
+		line, err := l.buf.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write.
+			l.buf.Reset()
+			l.buf.WriteString(line)
+			return len(p), nil
+		}
+		l.emit(strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// Flush emits what is left after the last newline.
+func (l *lineWriter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buf.Len() > 0 {
+		l.emit(l.buf.String())
+		l.buf.Reset()
+	}
+}
+
+// --- Helpers ---
+
+// statusRecorder remembers the status of a response for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed responses through the recorder.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
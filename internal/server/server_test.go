@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	_ "github.com/hiway/dreampipe/internal/llm/mock" // Registers the mock provider
+	"github.com/hiway/dreampipe/internal/prompt"
+	"github.com/hiway/dreampipe/internal/script"
+	"github.com/hiway/dreampipe/internal/tokens"
+)
+
+// newTestServer returns a server for a scripts directory with the script
+// "shout", using the mock provider in echo mode.
+func newTestServer(t *testing.T, opts Options, configure func(*config.Config)) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shout"), []byte("#!/usr/bin/env dreampipe\nRepeat the input.\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.DefaultProvider = "mock"
+	cfg.RecordUsage = false
+	if configure != nil {
+		configure(&cfg)
+	}
+	ts := httptest.NewServer(New(cfg, &script.Library{Dirs: []string{dir}}, opts).Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends a request and returns the response status and body.
+func do(t *testing.T, req *http.Request) (int, string) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func newRequest(t *testing.T, method, url, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRun(t *testing.T) {
+	ts := newTestServer(t, Options{}, func(cfg *config.Config) { cfg.Limits.MaxInputBytes = 100 })
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		accept     string
+		wantStatus int
+		wantBody   []string
+	}{
+		{name: "Output", path: "/run/shout", body: "hello", wantStatus: http.StatusOK, wantBody: []string{"hello\n"}},
+		{name: "Unknown script", path: "/run/whisper", body: "hello", wantStatus: http.StatusNotFound},
+		{name: "Limit", path: "/run/shout", body: strings.Repeat("x", 200), wantStatus: http.StatusTooManyRequests, wantBody: []string{"max_input_bytes"}},
+		{
+			name: "Stream", path: "/run/shout?stream=true", body: "line one\nline two", wantStatus: http.StatusOK,
+			wantBody: []string{"event: output\ndata: line one\ndata: line two\n\n", "event: done\n"},
+		},
+		{
+			name: "Stream error", path: "/run/shout", body: strings.Repeat("x", 200), accept: "text/event-stream", wantStatus: http.StatusOK,
+			wantBody: []string{"event: error\ndata: limit exceeded", "event: done\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(t, http.MethodPost, ts.URL+tt.path, tt.body)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			status, body := do(t, req)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", status, tt.wantStatus, body)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body = %q, want it to contain %q", body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Params(t *testing.T) {
+	dir := t.TempDir()
+	content := "#!/usr/bin/env dreampipe\n+++\n[[params]]\nname = \"lang\"\nvalues = [\"fr\", \"de\"]\ndefault = \"fr\"\n+++\nTranslate to {{lang}}.\n"
+	if err := os.WriteFile(filepath.Join(dir, "translate"), []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.DefaultProvider = "mock"
+	cfg.RecordUsage = false
+	if err := cfg.SetProviderSettings("mock", map[string]interface{}{"mode": "prompt"}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New(cfg, &script.Library{Dirs: []string{dir}}, Options{}).Handler())
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Default", query: "", wantStatus: http.StatusOK, wantBody: "Translate to fr."},
+		{name: "Given", query: "?lang=de", wantStatus: http.StatusOK, wantBody: "Translate to de."},
+		{name: "Given while streaming", query: "?lang=de&stream=true", wantStatus: http.StatusOK, wantBody: "Translate to de."},
+		{name: "Value not allowed", query: "?lang=es", wantStatus: http.StatusBadRequest, wantBody: "lang"},
+		{name: "Unknown param", query: "?tone=formal", wantStatus: http.StatusBadRequest, wantBody: "tone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, newRequest(t, http.MethodPost, ts.URL+"/run/translate"+tt.query, "bonjour"))
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status = %d, body = %q; want %d and %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRun_DailySpendShared(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	// At $1 a token the cap leaves room for one request's prompt but not two;
+	// the requests overlap, so none is recorded before the others are checked.
+	oneRequest := tokens.Estimate(prompt.Build(app.AgentPrompt, "Repeat the input.", "hi", ""))
+	ts := newTestServer(t, Options{}, func(cfg *config.Config) {
+		cfg.RecordUsage = true
+		cfg.Limits.DailySpendUSD = map[string]float64{"mock": float64(oneRequest) * 1.5}
+		cfg.Prices = map[string]config.ModelPrice{"tiny": {InputPerMillion: 1000000}}
+		cfg.SetProviderSettings("mock", map[string]interface{}{"model": "tiny", "latency": "200ms"})
+	})
+
+	const n = 4
+	statuses := make(chan int, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			resp, err := http.Post(ts.URL+"/run/shout", "text/plain", strings.NewReader("hi"))
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	counts := map[int]int{}
+	for i := 0; i < n; i++ {
+		counts[<-statuses]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusTooManyRequests] != n-1 {
+		t.Errorf("statuses = %v, want one request within the cap and the others rejected", counts)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	ts := newTestServer(t, Options{}, nil)
+	status, body := do(t, newRequest(t, http.MethodGet, ts.URL+"/scripts", ""))
+	var scripts []scriptInfo
+	if err := json.Unmarshal([]byte(body), &scripts); err != nil || status != http.StatusOK {
+		t.Fatalf("GET /scripts = %d %q", status, body)
+	}
+	if len(scripts) != 1 || scripts[0].Name != "shout" || scripts[0].Description != "Repeat the input." {
+		t.Errorf("GET /scripts = %+v", scripts)
+	}
+}
+
+func TestToken(t *testing.T) {
+	ts := newTestServer(t, Options{Token: "s3cret"}, nil)
+
+	if status, _ := do(t, newRequest(t, http.MethodGet, ts.URL+"/scripts", "")); status != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", status)
+	}
+	req := newRequest(t, http.MethodGet, ts.URL+"/scripts", "")
+	req.Header.Set("Authorization", "Bearer wrong")
+	if status, _ := do(t, req); status != http.StatusUnauthorized {
+		t.Errorf("with wrong token: status = %d, want 401", status)
+	}
+	req = newRequest(t, http.MethodGet, ts.URL+"/scripts", "")
+	req.Header.Set("Authorization", "Bearer s3cret")
+	if status, _ := do(t, req); status != http.StatusOK {
+		t.Errorf("with token: status = %d, want 200", status)
+	}
+}
+
+func TestChatCompletions(t *testing.T) {
+	ts := newTestServer(t, Options{}, func(cfg *config.Config) {
+		cfg.LLMs["mock"] = config.LLMConfig{Model: "configured"}
+	})
+
+	tests := []struct {
+		name      string
+		body      string
+		wantModel string
+		wantText  string
+	}{
+		{name: "Default provider", body: `{"messages": [{"role": "user", "content": "hi"}]}`, wantModel: "configured", wantText: "hi"},
+		{name: "Provider name", body: `{"model": "mock", "messages": [{"role": "user", "content": "hi"}]}`, wantModel: "configured", wantText: "hi"},
+		{name: "Provider and model", body: `{"model": "mock/tiny", "messages": [{"role": "user", "content": "hi"}]}`, wantModel: "tiny", wantText: "hi"},
+		{
+			name:      "Content parts",
+			body:      `{"messages": [{"role": "system", "content": "be brief"}, {"role": "user", "content": [{"type": "text", "text": "from parts"}]}]}`,
+			wantModel: "configured", wantText: "from parts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, newRequest(t, http.MethodPost, ts.URL+"/v1/chat/completions", tt.body))
+			var resp chatResponse
+			if err := json.Unmarshal([]byte(body), &resp); err != nil || status != http.StatusOK {
+				t.Fatalf("status = %d, body = %q", status, body)
+			}
+			if resp.Object != "chat.completion" || resp.Model != tt.wantModel || len(resp.Choices) != 1 ||
+				resp.Choices[0].Message.Content != tt.wantText || resp.Usage == nil {
+				t.Errorf("response = %s, want model %s and text %q", body, tt.wantModel, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestChatCompletions_Stream(t *testing.T) {
+	ts := newTestServer(t, Options{}, nil)
+	status, body := do(t, newRequest(t, http.MethodPost, ts.URL+"/v1/chat/completions",
+		`{"stream": true, "messages": [{"role": "user", "content": "streamed"}]}`))
+	if status != http.StatusOK || !strings.Contains(body, `"object":"chat.completion.chunk"`) ||
+		!strings.Contains(body, `"content":"streamed"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("status = %d, body = %q", status, body)
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"stream": true, "messages": [{"role": "user", "content": "x"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Dreampipe-Stream"); got != "single-chunk" {
+		t.Errorf("X-Dreampipe-Stream = %q, want the stream labeled as a single chunk", got)
+	}
+}
+
+func TestChatCompletions_Errors(t *testing.T) {
+	ts := newTestServer(t, Options{}, func(cfg *config.Config) {
+		cfg.SetProviderSettings("mock", map[string]interface{}{"error": "provider down"})
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErr    string
+		wantCode   string
+	}{
+		{name: "Invalid JSON", body: `{`, wantStatus: http.StatusBadRequest, wantErr: "invalid request body"},
+		{name: "No messages", body: `{"messages": []}`, wantStatus: http.StatusBadRequest, wantErr: "messages must not be empty"},
+		{name: "Provider error", body: `{"messages": [{"role": "user", "content": "hi"}]}`, wantStatus: http.StatusBadGateway, wantErr: "provider down"},
+		{
+			name:       "Model of no entry",
+			body:       `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`,
+			wantStatus: http.StatusNotFound, wantErr: `"gpt-4o" does not exist`, wantCode: "model_not_found",
+		},
+		{
+			name:       "Model of a misspelt entry",
+			body:       `{"model": "mokc/tiny", "messages": [{"role": "user", "content": "hi"}]}`,
+			wantStatus: http.StatusNotFound, wantErr: `"mokc/tiny" does not exist`, wantCode: "model_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, newRequest(t, http.MethodPost, ts.URL+"/v1/chat/completions", tt.body))
+			var resp struct {
+				Error struct{ Message, Code string } `json:"error"`
+			}
+			json.Unmarshal([]byte(body), &resp)
+			if status != tt.wantStatus || !strings.Contains(resp.Error.Message, tt.wantErr) || resp.Error.Code != tt.wantCode {
+				t.Errorf("status = %d, body = %q, want %d with %q", status, body, tt.wantStatus, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	ts := newTestServer(t, Options{}, func(cfg *config.Config) {
+		cfg.LLMs["mock"] = config.LLMConfig{Model: "tiny"}
+	})
+	_, body := do(t, newRequest(t, http.MethodGet, ts.URL+"/v1/models", ""))
+	if !strings.Contains(body, `"id":"mock"`) || !strings.Contains(body, `"id":"mock/tiny"`) {
+		t.Errorf("GET /v1/models = %s", body)
+	}
+}
@@ -0,0 +1,148 @@
+// Package tokens provides rough token estimates and context window sizes for LLM models.
+// The estimates are intentionally conservative: dreampipe has no access to each
+// provider's tokenizer, so it errs on the side of counting too many tokens.
+package tokens
+
+import (
+	"strings"
+	"unicode"
+)
+
+// charsPerToken is the average number of ASCII letters or digits per token
+// for English-like text with common BPE tokenizers.
+const charsPerToken = 4
+
+// knownContextWindows maps model names to their context window sizes in tokens.
+var knownContextWindows = map[string]int{
+	"llama3":                  8192,
+	"llama3:8b":               8192,
+	"llama3:70b":              8192,
+	"llama3.1":                131072,
+	"llama3.2":                131072,
+	"mistral":                 32768,
+	"llama3-8b-8192":          8192,
+	"llama3-70b-8192":         8192,
+	"llama-3.1-8b-instant":    131072,
+	"llama-3.3-70b-versatile": 131072,
+	"mixtral-8x7b-32768":      32768,
+	"gemma2-9b-it":            8192,
+	"gemini-1.5-flash-latest": 1048576,
+	"gemini-1.5-pro-latest":   2097152,
+	"gemini-2.0-flash":        1048576,
+	"gemini-2.0-flash-lite":   1048576,
+}
+
+// providerDefaultContextWindows holds the context window of each provider's
+// default model, used when no model override is configured.
+var providerDefaultContextWindows = map[string]int{
+	"ollama": 8192,    // llama3
+	"groq":   8192,    // llama3-8b-8192
+	"gemini": 1048576, // gemini-1.5-flash-latest
+}
+
+// Estimate returns an approximate token count for text.
+// Runs of ASCII letters and digits count as one token per charsPerToken characters,
+// while punctuation, symbols and non-ASCII characters count as one token each.
+func Estimate(text string) int {
+	count := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			count += (wordLen + charsPerToken - 1) / charsPerToken
+			wordLen = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			count++
+		}
+	}
+	flush()
+	return count
+}
+
+// ContextWindow returns the context window size in tokens for the given provider and model.
+// An empty model means the provider's default model. It returns 0 if the size is unknown.
+func ContextWindow(provider, model string) int {
+	if model == "" {
+		return providerDefaultContextWindows[provider]
+	}
+	if size, ok := knownContextWindows[model]; ok {
+		return size
+	}
+	// Ollama tags such as "llama3:latest" share the base model's window.
+	if base, _, found := strings.Cut(model, ":"); found {
+		return knownContextWindows[base]
+	}
+	return 0
+}
+
+// Split divides text into chunks whose estimated token count does not exceed maxTokens.
+// Chunks are cut at line boundaries where possible; lines that are too long on their
+// own are cut into pieces of at most maxTokens characters.
+func Split(text string, maxTokens int) []string {
+	if maxTokens <= 0 || Estimate(text) <= maxTokens {
+		return []string{text}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		lineTokens := Estimate(line)
+		if lineTokens > maxTokens {
+			flush()
+			chunks = append(chunks, splitLine(line, maxTokens)...)
+			continue
+		}
+		if currentTokens+lineTokens > maxTokens {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+		currentTokens += lineTokens
+	}
+	flush()
+	return chunks
+}
+
+// splitLine cuts a single line into pieces of at most maxTokens runes.
+// Every rune contributes at most one token to Estimate, so each piece fits.
+func splitLine(line string, maxTokens int) []string {
+	runes := []rune(line)
+	var pieces []string
+	for start := 0; start < len(runes); start += maxTokens {
+		end := start + maxTokens
+		if end > len(runes) {
+			end = len(runes)
+		}
+		pieces = append(pieces, string(runes[start:end]))
+	}
+	return pieces
+}
+
+// Truncate returns the leading part of text that fits within maxTokens,
+// and whether anything was cut off.
+func Truncate(text string, maxTokens int) (string, bool) {
+	chunks := Split(text, maxTokens)
+	if len(chunks) <= 1 {
+		return text, false
+	}
+	return chunks[0], true
+}
@@ -0,0 +1,93 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "Empty input", input: "", want: 0},
+		{name: "Short words", input: "the cat sat", want: 3},
+		{name: "Long word", input: "storage", want: 2},
+		{name: "Punctuation", input: "Hello, World!", want: 6},
+		{name: "Non-ASCII characters", input: "வணக்கம்", want: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Estimate(tt.input); got != tt.want {
+				t.Errorf("Estimate(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+		want     int
+	}{
+		{name: "Provider default", provider: "groq", model: "", want: 8192},
+		{name: "Known model", provider: "groq", model: "mixtral-8x7b-32768", want: 32768},
+		{name: "Ollama tag", provider: "ollama", model: "llama3:latest", want: 8192},
+		{name: "Unknown model", provider: "ollama", model: "my-finetune", want: 0},
+		{name: "Unknown provider", provider: "other", model: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContextWindow(tt.provider, tt.model); got != tt.want {
+				t.Errorf("ContextWindow(%q, %q) = %d, want %d", tt.provider, tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	input := strings.Repeat("one two three four\n", 50)
+	chunks := Split(input, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("Split() returned %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if got := Estimate(chunk); got > 20 {
+			t.Errorf("chunk %d has %d tokens, want at most 20", i, got)
+		}
+	}
+	if joined := strings.Join(chunks, "\n"); joined != input {
+		t.Errorf("joined chunks do not reproduce the input")
+	}
+
+	long := strings.Repeat("x", 100)
+	for i, piece := range Split(long, 10) {
+		if got := Estimate(piece); got > 10 {
+			t.Errorf("piece %d of long line has %d tokens, want at most 10", i, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	short := "fits easily"
+	if got, truncated := Truncate(short, 100); truncated || got != short {
+		t.Errorf("Truncate(%q, 100) = %q, %v; want unchanged", short, got, truncated)
+	}
+
+	input := strings.Repeat("line of text\n", 100)
+	got, truncated := Truncate(input, 30)
+	if !truncated {
+		t.Fatalf("Truncate() did not report truncation")
+	}
+	if !strings.HasPrefix(input, got) {
+		t.Errorf("Truncate() result is not a prefix of the input")
+	}
+	if Estimate(got) > 30 {
+		t.Errorf("Truncate() result has %d tokens, want at most 30", Estimate(got))
+	}
+}
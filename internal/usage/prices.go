@@ -0,0 +1,41 @@
+package usage
+
+import (
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+// knownPrices holds list prices in US dollars per million tokens for common
+// hosted models. They change over time; override them with [prices] in config.toml.
+var knownPrices = map[string]config.ModelPrice{
+	"llama3-8b-8192":          {InputPerMillion: 0.05, OutputPerMillion: 0.08},
+	"llama3-70b-8192":         {InputPerMillion: 0.59, OutputPerMillion: 0.79},
+	"llama-3.1-8b-instant":    {InputPerMillion: 0.05, OutputPerMillion: 0.08},
+	"llama-3.3-70b-versatile": {InputPerMillion: 0.59, OutputPerMillion: 0.79},
+	"mixtral-8x7b-32768":      {InputPerMillion: 0.24, OutputPerMillion: 0.24},
+	"gemma2-9b-it":            {InputPerMillion: 0.20, OutputPerMillion: 0.20},
+	"gemini-1.5-flash-latest": {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+	"gemini-1.5-pro-latest":   {InputPerMillion: 1.25, OutputPerMillion: 5.00},
+	"gemini-2.0-flash":        {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.0-flash-lite":   {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+}
+
+// freeProviders run models locally and never cost anything per token.
+var freeProviders = map[string]bool{
+	"ollama": true,
+}
+
+// Cost returns the price in US dollars of a request, and whether the model's
+// price is known. Prices from overrides take precedence over the built-in table.
+func Cost(provider, model string, promptTokens, completionTokens int, overrides map[string]config.ModelPrice) (float64, bool) {
+	price, ok := overrides[model]
+	if !ok {
+		if freeProviders[provider] {
+			return 0, true
+		}
+		price, ok = knownPrices[model]
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.InputPerMillion + float64(completionTokens)*price.OutputPerMillion) / 1e6, true
+}
@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Report groupings accepted by Summarize.
+const (
+	ByDay      = "day"
+	ByProvider = "provider"
+	ByModel    = "model"
+	ByScript   = "script"
+)
+
+// adHocScriptKey labels requests that did not come from a script.
+const adHocScriptKey = "(ad-hoc)"
+
+// Summary aggregates the records that share a grouping key.
+type Summary struct {
+	Key              string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+}
+
+// Summarize groups records by day, provider, model or script, sorted by key.
+// Records before since are ignored; a zero since includes everything.
+func Summarize(records []Record, by string, since time.Time) ([]Summary, error) {
+	keyOf, err := groupingKey(by)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*Summary)
+	for _, rec := range records {
+		if rec.Time.Before(since) {
+			continue
+		}
+		key := keyOf(rec)
+		s, ok := byKey[key]
+		if !ok {
+			s = &Summary{Key: key}
+			byKey[key] = s
+		}
+		s.Requests++
+		s.PromptTokens += rec.PromptTokens
+		s.CompletionTokens += rec.CompletionTokens
+		s.TotalTokens += rec.TotalTokens
+		s.CostUSD += rec.CostUSD
+	}
+
+	summaries := make([]Summary, 0, len(byKey))
+	for _, s := range byKey {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+	return summaries, nil
+}
+
+// groupingKey returns the function extracting the grouping key from a record.
+func groupingKey(by string) (func(Record) string, error) {
+	switch by {
+	case ByDay:
+		return func(rec Record) string { return rec.Time.Local().Format("2006-01-02") }, nil
+	case ByProvider:
+		return func(rec Record) string { return rec.Provider }, nil
+	case ByModel:
+		return func(rec Record) string { return rec.Provider + "/" + rec.Model }, nil
+	case ByScript:
+		return func(rec Record) string {
+			if rec.Script == "" {
+				return adHocScriptKey
+			}
+			return rec.Script
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown grouping '%s': must be one of %s, %s, %s or %s", by, ByDay, ByProvider, ByModel, ByScript)
+	}
+}
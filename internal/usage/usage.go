@@ -0,0 +1,110 @@
+// Package usage records token usage and cost of LLM requests in a local ledger
+// and summarizes it for reporting.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+const (
+	appName        = "dreampipe"
+	ledgerFileName = "usage.jsonl"
+)
+
+// Record is a single entry in the usage ledger, one per LLM request.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Script           string    `json:"script,omitempty"` // Script file name, empty for ad-hoc instructions
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Estimated        bool      `json:"estimated,omitempty"` // Token counts are estimates, the provider reported none
+	CostUSD          float64   `json:"cost_usd"`
+}
+
+// Ledger is an append-only JSON Lines file of usage records.
+type Ledger struct {
+	path string
+}
+
+// DefaultLedgerPath returns the ledger location based on XDG specs:
+// $XDG_STATE_HOME/dreampipe/usage.jsonl, or ~/.local/state/dreampipe/usage.jsonl.
+func DefaultLedgerPath() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home directory: %w", err)
+		}
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, appName, ledgerFileName), nil
+}
+
+// NewLedger returns a Ledger stored at path.
+func NewLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Path returns the location of the ledger file.
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Append adds a record to the ledger, creating the file and its directory if needed.
+func (l *Ledger) Append(rec Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), config.DefaultDirPerm); err != nil {
+		return fmt.Errorf("failed to create usage ledger directory: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, config.DefaultFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger %s: %w", l.path, err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage record: %w", err)
+	}
+	// A single write keeps concurrent dreampipe processes from interleaving lines.
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage ledger %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Records reads all records in the ledger. A missing ledger has no records.
+// Lines that cannot be decoded are skipped.
+func (l *Ledger) Records() ([]Record, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open usage ledger %s: %w", l.path, err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec Record
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger %s: %w", l.path, err)
+	}
+	return records, nil
+}
@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+)
+
+func TestLedger_AppendAndRecords(t *testing.T) {
+	ledger := NewLedger(filepath.Join(t.TempDir(), "state", "usage.jsonl"))
+
+	records, err := ledger.Records()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Records() on missing ledger = %v, %v; want no records and no error", records, err)
+	}
+
+	want := []Record{
+		{Time: time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC), Provider: "groq", Model: "llama3-8b-8192", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		{Time: time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC), Provider: "ollama", Model: "llama3", Script: "to-json.md", Estimated: true},
+	}
+	for _, rec := range want {
+		if err := ledger.Append(rec); err != nil {
+			t.Fatalf("Append() failed: %v", err)
+		}
+	}
+
+	got, err := ledger.Records()
+	if err != nil {
+		t.Fatalf("Records() failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Records() returned %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Provider != want[i].Provider || got[i].Script != want[i].Script || got[i].Estimated != want[i].Estimated {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		model     string
+		overrides map[string]config.ModelPrice
+		want      float64
+		wantKnown bool
+	}{
+		{name: "Known model", provider: "groq", model: "mixtral-8x7b-32768", want: 0.00048, wantKnown: true},
+		{name: "Local provider", provider: "ollama", model: "llama3", want: 0, wantKnown: true},
+		{name: "Unknown model", provider: "groq", model: "new-model", want: 0, wantKnown: false},
+		{
+			name:      "Override",
+			provider:  "ollama",
+			model:     "llama3",
+			overrides: map[string]config.ModelPrice{"llama3": {InputPerMillion: 1, OutputPerMillion: 2}},
+			want:      0.003,
+			wantKnown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known := Cost(tt.provider, tt.model, 1000, 1000, tt.overrides)
+			if known != tt.wantKnown || got < tt.want-1e-12 || got > tt.want+1e-12 {
+				t.Errorf("Cost() = %v, %v; want %v, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	records := []Record{
+		{Time: time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local), Provider: "groq", Script: "to-json.md", TotalTokens: 100, CostUSD: 0.01},
+		{Time: time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local), Provider: "groq", TotalTokens: 50, CostUSD: 0.02},
+		{Time: time.Date(2026, 1, 2, 13, 0, 0, 0, time.Local), Provider: "ollama", Script: "to-json.md", TotalTokens: 10},
+	}
+
+	byScript, err := Summarize(records, ByScript, time.Time{})
+	if err != nil {
+		t.Fatalf("Summarize() failed: %v", err)
+	}
+	if len(byScript) != 2 || byScript[0].Key != adHocScriptKey || byScript[1].Key != "to-json.md" || byScript[1].Requests != 2 || byScript[1].TotalTokens != 110 {
+		t.Errorf("Summarize(by script) = %+v", byScript)
+	}
+
+	byDay, err := Summarize(records, ByDay, time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("Summarize() failed: %v", err)
+	}
+	if len(byDay) != 1 || byDay[0].Key != "2026-01-02" || byDay[0].Requests != 2 {
+		t.Errorf("Summarize(by day, since) = %+v", byDay)
+	}
+
+	if _, err := Summarize(records, "week", time.Time{}); err == nil {
+		t.Errorf("Summarize() with unknown grouping should fail")
+	}
+}
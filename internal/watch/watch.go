@@ -0,0 +1,237 @@
+// Package watch re-runs a transformation when its input files change, for
+// outputs that should follow their sources, like a translated README.
+//
+// Files are polled rather than watched through the operating system, so it
+// works the same everywhere, including on network file systems and with
+// editors that replace files instead of writing them.
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Defaults for Job.
+const (
+	DefaultInterval = 250 * time.Millisecond
+	DefaultDebounce = 500 * time.Millisecond
+)
+
+// Job writes the transformation of Input to Output, again each time Input,
+// Context or Watch change.
+type Job struct {
+	Input  string
+	Output string
+	// Context files are passed to Transform as context, in order.
+	Context []string
+	// Watch lists more files whose changes trigger a run, e.g. the script.
+	Watch []string
+	// Interval is how often the files are checked.
+	Interval time.Duration
+	// Debounce is how long the files must stay unchanged before a run, so
+	// a save that writes in several steps triggers a single run.
+	Debounce time.Duration
+	// SkipUnchanged skips runs when the contents of the files are the same
+	// as for the last successful run, e.g. when a file was only touched.
+	SkipUnchanged bool
+	// Transform returns the output for input.
+	Transform func(ctx context.Context, input []byte, contextData string) ([]byte, error)
+	// Log receives a line for every run; defaults to io.Discard.
+	Log io.Writer
+}
+
+// Run runs the transformation once, then again on every change, until ctx
+// is done. A failed run is logged and the next change tries again.
+func (j *Job) Run(ctx context.Context) error {
+	if err := j.validate(); err != nil {
+		return err
+	}
+	interval, debounce := j.Interval, j.Debounce
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if debounce < 0 {
+		debounce = 0
+	}
+
+	fmt.Fprintf(j.log(), "Watching %s, writing %s\n", j.Input, j.Output)
+	files := j.files()
+	var lastHash string
+	run := func() {
+		hash, err := j.runOnce(ctx, lastHash)
+		switch {
+		case ctx.Err() != nil:
+		case errors.Is(err, errUnchanged):
+			fmt.Fprintf(j.log(), "Contents of %s unchanged, skipping\n", j.Input)
+		case err != nil:
+			fmt.Fprintf(j.log(), "❌ %v\n", err)
+		default:
+			lastHash = hash
+		}
+	}
+
+	snapshot := stat(files)
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var changedAt time.Time // When the files last changed; zero after a run
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if current := stat(files); current != snapshot {
+				snapshot = current
+				changedAt = now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= debounce {
+				changedAt = time.Time{}
+				run()
+			}
+		}
+	}
+}
+
+// errUnchanged is returned by runOnce when the files are as they were.
+var errUnchanged = errors.New("unchanged")
+
+// runOnce reads the files and, unless their hash is lastHash, transforms the
+// input and writes the output. It returns the hash of the files it read.
+func (j *Job) runOnce(ctx context.Context, lastHash string) (string, error) {
+	input, err := os.ReadFile(j.Input)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	h := sha256.New()
+	writeChunk := func(data []byte) {
+		binary.Write(h, binary.BigEndian, uint64(len(data)))
+		h.Write(data)
+	}
+	writeChunk(input)
+	var contextParts []string
+	for _, path := range j.Context {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read context file: %w", err)
+		}
+		writeChunk(data)
+		contextParts = append(contextParts, string(data))
+	}
+	for _, path := range j.Watch {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read watched file: %w", err)
+		}
+		writeChunk(data)
+	}
+	hash := fmt.Sprintf("%x", h.Sum(nil))
+	if j.SkipUnchanged && hash == lastHash {
+		return hash, errUnchanged
+	}
+
+	start := time.Now()
+	output, err := j.Transform(ctx, input, strings.Join(contextParts, "\n\n"))
+	if err != nil {
+		return "", fmt.Errorf("run failed: %w", err)
+	}
+	if err := WriteFileAtomic(j.Output, output, 0644); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(j.log(), "✅ Wrote %s (%v)\n", j.Output, time.Since(start).Round(time.Millisecond))
+	return hash, nil
+}
+
+// validate checks that the job has its files and that the output isn't one
+// of them, which would make every run trigger the next.
+func (j *Job) validate() error {
+	if j.Input == "" || j.Output == "" {
+		return fmt.Errorf("watch needs an input and an output file")
+	}
+	if j.Transform == nil {
+		return fmt.Errorf("watch needs a transformation")
+	}
+	out, err := filepath.Abs(j.Output)
+	if err != nil {
+		return err
+	}
+	for _, path := range j.files() {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs == out {
+			return fmt.Errorf("output %s is also watched, so every run would trigger another", j.Output)
+		}
+	}
+	return nil
+}
+
+// files returns every watched file.
+func (j *Job) files() []string {
+	files := append([]string{j.Input}, j.Context...)
+	return append(files, j.Watch...)
+}
+
+// stat returns a fingerprint of the files' sizes and modification times.
+// Missing files have their own fingerprint, so they're noticed when created.
+func stat(files []string) string {
+	var b strings.Builder
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			b.WriteString("-\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d %d\n", info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// log returns where to log runs.
+func (j *Job) log() io.Writer {
+	if j.Log == nil {
+		return io.Discard
+	}
+	return j.Log
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it over path, so readers see the old or the new contents, never a partial
+// file. An existing file keeps its permissions; a new one gets perm.
+func WriteFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly after the rename
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
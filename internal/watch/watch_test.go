@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a transformation that upper-cases its input and records it.
+type recorder struct {
+	mu     sync.Mutex
+	inputs []string
+}
+
+func (r *recorder) transform(ctx context.Context, input []byte, contextData string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inputs = append(r.inputs, string(input)+"|"+contextData)
+	return bytes.ToUpper(input), nil
+}
+
+func (r *recorder) runs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.inputs...)
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJob(t *testing.T) {
+	dir := t.TempDir()
+	input, ctxFile, output := filepath.Join(dir, "in.txt"), filepath.Join(dir, "glossary.txt"), filepath.Join(dir, "out.txt")
+	writeFile(t, input, "hello")
+	writeFile(t, ctxFile, "terms")
+
+	rec := &recorder{}
+	job := &Job{
+		Input:         input,
+		Output:        output,
+		Context:       []string{ctxFile},
+		Interval:      5 * time.Millisecond,
+		Debounce:      30 * time.Millisecond,
+		SkipUnchanged: true,
+		Transform:     rec.transform,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- job.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	readOutput := func() string {
+		data, _ := os.ReadFile(output)
+		return string(data)
+	}
+	waitFor(t, "the first run", func() bool { return readOutput() == "HELLO" })
+	if runs := rec.runs(); len(runs) != 1 || runs[0] != "hello|terms" {
+		t.Fatalf("runs = %q, want one with the input and context", runs)
+	}
+
+	// Several writes in a row make a single run with the last contents.
+	for _, content := range []string{"w", "wo", "world"} {
+		writeFile(t, input, content)
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitFor(t, "the second run", func() bool { return readOutput() == "WORLD" })
+	if runs := rec.runs(); len(runs) != 2 {
+		t.Errorf("runs = %q, want writes within the debounce to make one run", runs)
+	}
+
+	// Rewriting the same contents doesn't make a run.
+	time.Sleep(5 * time.Millisecond)
+	writeFile(t, input, "world")
+	time.Sleep(100 * time.Millisecond)
+	if runs := rec.runs(); len(runs) != 2 {
+		t.Errorf("runs = %q, want no run for unchanged contents", runs)
+	}
+
+	// A changed context file makes a run.
+	writeFile(t, ctxFile, "more terms")
+	waitFor(t, "the run for the context", func() bool { return len(rec.runs()) == 3 })
+}
+
+func TestJob_OutputWatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	job := &Job{Input: path, Output: path, Transform: (&recorder{}).transform}
+	if err := job.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "also watched") {
+		t.Errorf("Run() error = %v, want the output rejected", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+	if err := WriteFileAtomic(path, []byte("one"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("two"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "two" {
+		t.Errorf("contents = %q, %v, want two", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want the existing 0640 kept", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want no temporary files left", len(entries))
+	}
+}
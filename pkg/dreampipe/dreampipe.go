@@ -0,0 +1,184 @@
+// Package dreampipe runs dreampipe's natural language transformations in
+// process: the same runner, providers, prompts and output filters as the
+// dreampipe command, without shelling out to it.
+//
+//	client, err := dreampipe.NewOllama("http://localhost:11434", dreampipe.WithModel("llama3"))
+//	if err != nil {
+//		return err
+//	}
+//	runner := dreampipe.NewRunner(dreampipe.WithClient(client))
+//	haiku, err := runner.Run(ctx, "Write a haiku about the storage situation", dfOutput)
+package dreampipe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/hiway/dreampipe/internal/app"
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/filters"
+	"github.com/hiway/dreampipe/internal/iohandler"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/prompt"
+)
+
+// ErrLimitExceeded is returned when a run would exceed one of the limits in
+// Config.Limits.
+var ErrLimitExceeded = app.ErrLimitExceeded
+
+// --- Prompts and filters ---
+
+// AgentPrompt is the prefix of every prompt, defining the LLM's role.
+const AgentPrompt = app.AgentPrompt
+
+// BuildPrompt returns the prompt dreampipe sends for instruction applied to
+// input, with optional context data.
+func BuildPrompt(instruction, input, contextData string) string {
+	return prompt.Build(AgentPrompt, instruction, input, contextData)
+}
+
+// LookupFilter returns the filter called name, as scripts name them.
+func LookupFilter(name string) (Filter, error) {
+	filter, err := filters.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// FilterNames returns the names of all filters, sorted.
+func FilterNames() []string {
+	return filters.Names()
+}
+
+// DefaultFilters returns the names of the filters applied to output when
+// nothing else is chosen.
+func DefaultFilters() []string {
+	return append([]string(nil), filters.DefaultFilters...)
+}
+
+// ApplyFilters applies the named filters to output, in order.
+func ApplyFilters(output string, names ...string) (string, error) {
+	for _, name := range names {
+		filter, err := filters.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		output = filter.Apply(output)
+	}
+	return output, nil
+}
+
+// --- Runner ---
+
+// Runner applies instructions and scripts to input, with the context window
+// handling, limits, redaction, multi-step scripts and map-reduce of the
+// command. A Runner is safe for concurrent use; each call is a separate run.
+type Runner struct {
+	cfg         Config
+	client      Client
+	contextData string
+	mapReduce   *MapReduce
+	params      map[string]string
+	stderr      io.Writer
+	debug       bool
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithConfig uses cfg instead of DefaultConfig, e.g. the result of LoadConfig.
+// Without WithClient, requests go to cfg's default provider.
+func WithConfig(cfg Config) Option {
+	return func(r *Runner) { r.cfg = cfg }
+}
+
+// WithClient sends every request to client, including those of script steps
+// that name another provider.
+func WithClient(client Client) Option {
+	return func(r *Runner) { r.client = client }
+}
+
+// WithContextData adds reference material to every prompt, like the
+// command's --context flag.
+func WithContextData(data string) Option {
+	return func(r *Runner) { r.contextData = data }
+}
+
+// WithMapReduce always processes input with map-reduce, like the command's
+// --map-reduce flag. Zero fields keep the script's settings or the defaults.
+func WithMapReduce(mr MapReduce) Option {
+	return func(r *Runner) { r.mapReduce = &mr }
+}
+
+// WithParams sets the values of the params scripts declare in their
+// front-matter, like the command's --param flag.
+func WithParams(params map[string]string) Option {
+	return func(r *Runner) { r.params = params }
+}
+
+// WithStderr receives the warnings and errors the command prints on stderr.
+// They are discarded by default.
+func WithStderr(w io.Writer) Option {
+	return func(r *Runner) { r.stderr = w }
+}
+
+// WithDebug writes the command's --debug messages to the WithStderr writer.
+func WithDebug(debug bool) Option {
+	return func(r *Runner) { r.debug = debug }
+}
+
+// NewRunner returns a Runner configured by opts.
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{cfg: DefaultConfig(), stderr: io.Discard}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run applies instruction to input and returns the filtered output.
+func (r *Runner) Run(ctx context.Context, instruction, input string) (string, error) {
+	if strings.TrimSpace(instruction) == "" {
+		return "", errors.New("instruction is empty")
+	}
+	return r.run(ctx, app.ModeAdHoc, instruction, input)
+}
+
+// RunScript runs the script at path, a dreampipe script with optional
+// front-matter, on input and returns its output.
+func (r *Runner) RunScript(ctx context.Context, path, input string) (string, error) {
+	return r.run(ctx, app.ModeScript, path, input)
+}
+
+// run runs the command's runner with input as stdin and returns its stdout.
+func (r *Runner) run(ctx context.Context, mode app.RunMode, instructionOrPath, input string) (string, error) {
+	var stdout bytes.Buffer
+	streams := &iohandler.Streams{In: strings.NewReader(input), Out: &stdout, Err: r.stderr}
+	cfg, err := r.cfg.toConfig()
+	if err != nil {
+		return "", err
+	}
+	// The status line is for the command; programs draw their own output.
+	cfg.Progress = false
+	runner := app.NewRunner(cfg, streams, r.debug)
+	runner.SetRecordLastRun(false)
+	if r.client != nil {
+		client := toLLMClient(r.client)
+		runner.SetClientFactory(func(config.Config, bool) (llm.Client, error) { return client, nil })
+	}
+	if r.mapReduce != nil {
+		runner.SetMapReduce(r.mapReduce.toMapReduce())
+	}
+	if mode == app.ModeScript {
+		runner.SetParams(r.params)
+	}
+	if err := runner.RunContext(ctx, mode, instructionOrPath, r.contextData); err != nil {
+		return "", err
+	}
+	// The runner ends the output with a newline, as on a terminal.
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
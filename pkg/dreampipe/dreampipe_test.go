@@ -0,0 +1,222 @@
+package dreampipe
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunner_Run(t *testing.T) {
+	tests := []struct {
+		name        string
+		mock        MockOptions
+		opts        []Option
+		instruction string
+		input       string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "Echo",
+			instruction: "repeat",
+			input:       "hello\nworld\n",
+			want:        "hello\nworld",
+		},
+		{
+			name:        "Default filters remove code fences",
+			mock:        MockOptions{Mode: MockSequence, Responses: []string{"```json\n{\"a\": 1}\n```"}},
+			instruction: "to JSON",
+			input:       "a=1",
+			want:        "{\"a\": 1}",
+		},
+		{
+			name: "Context data is part of the prompt",
+			mock: MockOptions{Mode: MockRules, Rules: []MockRule{
+				{Pattern: `Context:\n\n(\w+)`, Response: "context was $1"},
+			}},
+			opts:        []Option{WithContextData("glossary")},
+			instruction: "use the context",
+			input:       "x",
+			want:        "context was glossary",
+		},
+		{
+			name:        "Provider error",
+			mock:        MockOptions{Error: "down"},
+			instruction: "anything",
+			input:       "x",
+			wantErr:     true,
+		},
+		{
+			name:        "Empty instruction",
+			instruction: "  ",
+			input:       "x",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewMock(tt.mock)
+			if err != nil {
+				t.Fatalf("NewMock() error = %v", err)
+			}
+			runner := NewRunner(append([]Option{WithClient(client)}, tt.opts...)...)
+			got, err := runner.Run(context.Background(), tt.instruction, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Limits(t *testing.T) {
+	client, err := NewMock(MockOptions{})
+	if err != nil {
+		t.Fatalf("NewMock() error = %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.Limits.MaxInputBytes = 4
+	runner := NewRunner(WithConfig(cfg), WithClient(client))
+	if _, err := runner.Run(context.Background(), "repeat", "too long"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Run() error = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestRunner_Run_Canceled(t *testing.T) {
+	client, err := NewMock(MockOptions{Latency: "10s"})
+	if err != nil {
+		t.Fatalf("NewMock() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewRunner(WithClient(client)).Run(ctx, "repeat", "x"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %v after its context ended", elapsed)
+	}
+}
+
+func TestRunner_RunScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shout")
+	scriptText := `#!/usr/bin/env dreampipe
++++
+[[steps]]
+name = "first"
+instruction = "uppercase"
+
+[[steps]]
+name = "second"
+instruction = "add a title"
++++
+`
+	if err := os.WriteFile(path, []byte(scriptText), 0755); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewMock(MockOptions{Mode: MockRules, Rules: []MockRule{
+		{Pattern: `uppercase\n\n---\n\nInput:\n\n(.*)`, Response: "SHOUTED ${1}"},
+		{Pattern: `add a title\n\n---\n\nInput:\n\n(.*)`, Response: "# Title\n${1}"},
+	}})
+	if err != nil {
+		t.Fatalf("NewMock() error = %v", err)
+	}
+
+	got, err := NewRunner(WithClient(client)).RunScript(context.Background(), path, "hello")
+	if err != nil {
+		t.Fatalf("RunScript() error = %v", err)
+	}
+	if want := "# Title\nSHOUTED hello"; got != want {
+		t.Errorf("RunScript() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	got := BuildPrompt("summarize", "some text", "")
+	if !strings.HasPrefix(got, AgentPrompt) || !strings.Contains(got, "summarize") || !strings.HasSuffix(got, "some text") {
+		t.Errorf("BuildPrompt() = %q", got)
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	got, err := ApplyFilters("```\n  fenced  \n```", "markdown_code_block", "trim_space")
+	if err != nil {
+		t.Fatalf("ApplyFilters() error = %v", err)
+	}
+	if got != "fenced" {
+		t.Errorf("ApplyFilters() = %q, want %q", got, "fenced")
+	}
+	if _, err := ApplyFilters("x", "no_such_filter"); err == nil {
+		t.Errorf("ApplyFilters() with an unknown filter succeeded")
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	RegisterProvider("test-fixed", func(cfg ProviderConfig) (Client, error) {
+		return NewMock(MockOptions{Mode: MockSequence, Responses: []string{"fixed " + cfg.String("flavor")}})
+	})
+	cfg := DefaultConfig()
+	cfg.DefaultProvider = "fixed"
+	cfg.LLMs["fixed"] = LLMConfig{Type: "test-fixed", Settings: map[string]interface{}{"flavor": "vanilla"}}
+	client, err := NewClientFromConfig(cfg, "fixed")
+	if err != nil {
+		t.Fatalf("NewClientFromConfig() error = %v", err)
+	}
+	resp, err := client.Generate(context.Background(), "x")
+	if err != nil || resp.Text != "fixed vanilla" {
+		t.Errorf("Generate() = %q, %v, want the registered provider's answer", resp.Text, err)
+	}
+}
+
+// upperClient is a Client written outside the package.
+type upperClient struct{}
+
+func (upperClient) Generate(ctx context.Context, prompt string) (Response, error) {
+	return Response{Text: strings.ToUpper(prompt[strings.LastIndex(prompt, "\n")+1:])}, nil
+}
+
+func (c upperClient) Chat(ctx context.Context, messages []Message) (Response, error) {
+	return c.Generate(ctx, messages[len(messages)-1].Content)
+}
+
+func (upperClient) ProviderName() string { return "upper" }
+
+func TestRunner_Run_OwnClient(t *testing.T) {
+	got, err := NewRunner(WithClient(upperClient{})).Run(context.Background(), "shout", "hello")
+	if err != nil || got != "HELLO" {
+		t.Errorf("Run() = %q, %v, want the client's answer", got, err)
+	}
+}
+
+func TestConfig_RoundTrip(t *testing.T) {
+	redact := true
+	cfg := DefaultConfig()
+	cfg.Limits.DailySpendUSD = map[string]float64{"groq": 1}
+	cfg.Redaction.Rules = []RedactionRule{{Name: "ticket", Pattern: `T-\d+`}}
+	cfg.Prices = map[string]ModelPrice{"m": {InputPerMillion: 1, OutputPerMillion: 2}}
+	cfg.LLMs["acme"] = LLMConfig{Type: "plugin", Model: "big", Redact: &redact, Settings: map[string]interface{}{"region": "eu"}}
+	cfg.LLMs["mock"] = LLMConfig{Settings: map[string]interface{}{"mode": "sequence", "responses": []interface{}{"a", "b"}}}
+
+	converted, err := cfg.toConfig()
+	if err != nil {
+		t.Fatalf("toConfig() error = %v", err)
+	}
+	if converted.LLMs["acme"].Model != "big" || converted.ProviderSettings("acme")["region"] != "eu" {
+		t.Errorf("toConfig() acme = %+v, %v", converted.LLMs["acme"], converted.ProviderSettings("acme"))
+	}
+	back, err := fromConfig(converted)
+	if err != nil {
+		t.Fatalf("fromConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(back, cfg) {
+		t.Errorf("round trip = %+v\nwant %+v", back, cfg)
+	}
+}
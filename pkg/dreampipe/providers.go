@@ -0,0 +1,144 @@
+package dreampipe
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+	_ "github.com/hiway/dreampipe/internal/llm/builtin" // Registers the providers for NewClientFromConfig
+	"github.com/hiway/dreampipe/internal/llm/gemini"
+	"github.com/hiway/dreampipe/internal/llm/groq"
+	"github.com/hiway/dreampipe/internal/llm/mock"
+	"github.com/hiway/dreampipe/internal/llm/ollama"
+)
+
+// defaultRequestTimeout matches the request_timeout_seconds default of the command.
+const defaultRequestTimeout = 60 * time.Second
+
+// ProviderOption configures a provider client.
+type ProviderOption func(*providerOptions)
+
+// providerOptions are the settings shared by the provider constructors.
+type providerOptions struct {
+	model     string
+	timeout   time.Duration
+	transport http.RoundTripper
+	debug     bool
+}
+
+// WithModel selects the model instead of the provider's default.
+func WithModel(name string) ProviderOption {
+	return func(o *providerOptions) { o.model = name }
+}
+
+// WithRequestTimeout limits how long each HTTP request may take. It does not
+// apply to Gemini, whose requests are limited by their context only.
+func WithRequestTimeout(d time.Duration) ProviderOption {
+	return func(o *providerOptions) { o.timeout = d }
+}
+
+// WithHTTPTransport sends the provider's HTTP requests through rt, e.g. to
+// add tracing or to serve canned responses in tests.
+func WithHTTPTransport(rt http.RoundTripper) ProviderOption {
+	return func(o *providerOptions) { o.transport = rt }
+}
+
+// WithProviderDebug logs the provider's decisions with the log package.
+func WithProviderDebug(debug bool) ProviderOption {
+	return func(o *providerOptions) { o.debug = debug }
+}
+
+// applyProviderOptions returns the settings of opts over the defaults.
+func applyProviderOptions(opts []ProviderOption) providerOptions {
+	o := providerOptions{timeout: defaultRequestTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// timeoutSeconds converts the timeout to the whole seconds the clients take,
+// rounding up so that short timeouts don't become unlimited.
+func (o providerOptions) timeoutSeconds() int {
+	return int((o.timeout + time.Second - 1) / time.Second)
+}
+
+// NewOllama returns a client for the Ollama server at baseURL, e.g.
+// "http://localhost:11434".
+func NewOllama(baseURL string, opts ...ProviderOption) (Client, error) {
+	o := applyProviderOptions(opts)
+	return newClient(ollama.NewClient(baseURL, o.model, o.timeoutSeconds(), o.debug, ollama.Options{Transport: o.transport}))
+}
+
+// NewGemini returns a client for Google's Gemini API.
+func NewGemini(ctx context.Context, apiKey string, opts ...ProviderOption) (Client, error) {
+	o := applyProviderOptions(opts)
+	return newClient(gemini.NewClient(ctx, apiKey, o.model, o.debug, gemini.Options{Transport: o.transport}))
+}
+
+// NewGroq returns a client for Groq's API.
+func NewGroq(apiKey string, opts ...ProviderOption) (Client, error) {
+	o := applyProviderOptions(opts)
+	return newClient(groq.NewClient(apiKey, o.model, o.timeoutSeconds(), o.debug, groq.Options{Transport: o.transport}))
+}
+
+// Modes of the mock client.
+const (
+	MockEcho     = mock.ModeEcho
+	MockPrompt   = mock.ModePrompt
+	MockFile     = mock.ModeFile
+	MockRules    = mock.ModeRules
+	MockSequence = mock.ModeSequence
+)
+
+// NewMock returns a client that answers deterministically without a model,
+// for tests of code that uses dreampipe.
+func NewMock(mockOpts MockOptions, opts ...ProviderOption) (Client, error) {
+	o := applyProviderOptions(opts)
+	return newClient(mock.NewClient(o.model, o.debug, mockOpts.toMockOptions()))
+}
+
+// NewClientFromConfig returns a client for the named provider as configured
+// in cfg, the way the command creates it.
+func NewClientFromConfig(cfg Config, provider string) (Client, error) {
+	converted, err := cfg.toConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newClient(llm.NewProviderClient(converted, provider, false))
+}
+
+// RegisterProvider makes a provider available to NewClientFromConfig and
+// WithConfig under name, the type of the entries it serves. settings are the
+// keys its entries read beyond those of LLMConfig, so that loading the
+// configuration doesn't warn about them. Call it from an init function; it
+// panics when name is already registered.
+func RegisterProvider(name string, c ProviderConstructor, settings ...string) {
+	llm.Register(name, c.toConstructor(), settings...)
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	return llm.Providers()
+}
+
+// LoadConfig loads the configuration the command would use: the user
+// configuration file, the project .dreampipe.toml and DREAMPIPE_*
+// environment variables. Unlike the command, it never prompts.
+func LoadConfig() (Config, error) {
+	cfg, _, err := config.LoadWithOrigins(config.Flags{})
+	if err != nil {
+		return Config{}, err
+	}
+	return fromConfig(cfg)
+}
+
+// DefaultConfig returns the built-in configuration, with usage recording off.
+func DefaultConfig() Config {
+	// The built-in configuration always converts.
+	cfg, _ := fromConfig(config.Default())
+	cfg.RecordUsage = false
+	return cfg
+}
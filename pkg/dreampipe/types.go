@@ -0,0 +1,469 @@
+package dreampipe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/hiway/dreampipe/internal/config"
+	"github.com/hiway/dreampipe/internal/llm"
+	"github.com/hiway/dreampipe/internal/llm/mock"
+	"github.com/hiway/dreampipe/internal/script"
+)
+
+// The package's types are its own, converted to and from the command's
+// internal types, so that the command can change without breaking programs.
+
+// --- Clients ---
+
+// Client sends prompts to an LLM provider.
+type Client interface {
+	// Generate sends a single prompt and returns the model's response.
+	Generate(ctx context.Context, prompt string) (Response, error)
+	// Chat sends a conversation and returns the model's next reply. Messages
+	// alternate between RoleUser and RoleAssistant, optionally preceded by a
+	// RoleSystem message, and end with a RoleUser message.
+	Chat(ctx context.Context, messages []Message) (Response, error)
+	// ProviderName returns the name of the provider, or of the [llms] entry,
+	// the client serves; limits and usage are kept under it.
+	ProviderName() string
+}
+
+// Message is one turn of a conversation sent with Client.Chat.
+type Message struct {
+	Role    string // One of RoleSystem, RoleUser and RoleAssistant
+	Content string
+}
+
+// Response is the result of a request.
+type Response struct {
+	Text  string // The generated text
+	Model string // The model that produced the response
+	Usage Usage  // Token usage reported by the provider, zero if unavailable
+}
+
+// Usage holds the token counts reported by a provider for one request.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Roles of the messages in a conversation.
+const (
+	RoleSystem    = "system"    // Instructions and data that frame the whole conversation
+	RoleUser      = "user"      // What the user asked
+	RoleAssistant = "assistant" // What the model answered
+)
+
+// providerClient is a Client for one of the command's provider clients.
+type providerClient struct {
+	client llm.Client
+}
+
+// newClient wraps a provider client, passing on the constructor's error.
+func newClient(client llm.Client, err error) (Client, error) {
+	if err != nil {
+		return nil, err
+	}
+	return providerClient{client: client}, nil
+}
+
+func (c providerClient) Generate(ctx context.Context, prompt string) (Response, error) {
+	resp, err := c.client.Generate(ctx, prompt)
+	return fromLLMResponse(resp), err
+}
+
+func (c providerClient) Chat(ctx context.Context, messages []Message) (Response, error) {
+	resp, err := c.client.Chat(ctx, toLLMMessages(messages))
+	return fromLLMResponse(resp), err
+}
+
+func (c providerClient) ProviderName() string {
+	return c.client.ProviderName()
+}
+
+// llmClient serves a Client to the command's runner.
+type llmClient struct {
+	client Client
+}
+
+func (c llmClient) Generate(ctx context.Context, prompt string) (llm.Response, error) {
+	resp, err := c.client.Generate(ctx, prompt)
+	return toLLMResponse(resp), err
+}
+
+func (c llmClient) Chat(ctx context.Context, messages []llm.Message) (llm.Response, error) {
+	resp, err := c.client.Chat(ctx, fromLLMMessages(messages))
+	return toLLMResponse(resp), err
+}
+
+func (c llmClient) ProviderName() string {
+	return c.client.ProviderName()
+}
+
+// toLLMClient returns client as the runner takes it, unwrapping the
+// package's own provider clients.
+func toLLMClient(client Client) llm.Client {
+	if c, ok := client.(providerClient); ok {
+		return c.client
+	}
+	return llmClient{client: client}
+}
+
+func fromLLMResponse(resp llm.Response) Response {
+	return Response{Text: resp.Text, Model: resp.Model, Usage: Usage(resp.Usage)}
+}
+
+func toLLMResponse(resp Response) llm.Response {
+	return llm.Response{Text: resp.Text, Model: resp.Model, Usage: llm.Usage(resp.Usage)}
+}
+
+func toLLMMessages(messages []Message) []llm.Message {
+	converted := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		converted[i] = llm.Message(m)
+	}
+	return converted
+}
+
+func fromLLMMessages(messages []llm.Message) []Message {
+	converted := make([]Message, len(messages))
+	for i, m := range messages {
+		converted[i] = Message(m)
+	}
+	return converted
+}
+
+// --- Configuration ---
+
+// Config is the configuration of the dreampipe command, see
+// config.toml.sample for the meaning of each setting.
+type Config struct {
+	DefaultProvider       string
+	RequestTimeoutSeconds int
+	ContextOverflow       string // warn, truncate, chunk, error or map_reduce
+	RecordUsage           bool
+	Progress              bool
+	ScriptsDir            string
+	ScriptPaths           []string
+	Limits                Limits
+	Redaction             RedactionConfig
+	LLMs                  map[string]LLMConfig
+	Prices                map[string]ModelPrice // By model name
+}
+
+// Limits are hard caps enforced before a request is sent; zero means no limit.
+type Limits struct {
+	MaxInputBytes       int64
+	MaxTokensPerRequest int
+	MaxRequestsPerRun   int
+	DailySpendUSD       map[string]float64 // By provider, requires RecordUsage
+}
+
+// RedactionConfig controls replacing secrets and personal information in
+// the input with placeholders before it is sent to a provider.
+type RedactionConfig struct {
+	Enabled      bool
+	Restore      bool
+	DisableRules []string
+	Rules        []RedactionRule
+}
+
+// RedactionRule replaces matches of Pattern, a Go regular expression, with
+// placeholders named after Name.
+type RedactionRule struct {
+	Name    string
+	Pattern string
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens.
+type ModelPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// LLMConfig is the configuration of one provider in Config.LLMs. Settings
+// holds the entry's other keys, e.g. those of the mock provider or of
+// providers registered with RegisterProvider.
+type LLMConfig struct {
+	Type          string                 `toml:"type,omitempty"`
+	Plugin        string                 `toml:"plugin,omitempty"`
+	BaseURL       string                 `toml:"base_url,omitempty"`
+	APIKey        string                 `toml:"api_key,omitempty"`
+	Model         string                 `toml:"model,omitempty"`
+	APIKeyCmd     string                 `toml:"api_key_cmd,omitempty"`
+	APIKeyEnv     string                 `toml:"api_key_env,omitempty"`
+	APIKeyFile    string                 `toml:"api_key_file,omitempty"`
+	Redact        *bool                  `toml:"redact,omitempty"`
+	ContextWindow int                    `toml:"context_window,omitzero"`
+	AutoPull      bool                   `toml:"auto_pull,omitzero"`
+	KeepAlive     string                 `toml:"keep_alive,omitempty"`
+	Command       []string               `toml:"command,omitempty"`
+	Timeout       string                 `toml:"timeout,omitempty"`
+	Settings      map[string]interface{} `toml:"-"`
+}
+
+// fromConfig converts the command's configuration.
+func fromConfig(cfg config.Config) (Config, error) {
+	converted := Config{
+		DefaultProvider:       cfg.DefaultProvider,
+		RequestTimeoutSeconds: cfg.RequestTimeoutSeconds,
+		ContextOverflow:       cfg.ContextOverflow,
+		RecordUsage:           cfg.RecordUsage,
+		Progress:              cfg.Progress,
+		ScriptsDir:            cfg.ScriptsDir,
+		ScriptPaths:           cfg.ScriptPaths,
+		Limits:                Limits(cfg.Limits),
+		Redaction: RedactionConfig{
+			Enabled:      cfg.Redaction.Enabled,
+			Restore:      cfg.Redaction.Restore,
+			DisableRules: cfg.Redaction.DisableRules,
+		},
+		LLMs:   make(map[string]LLMConfig, len(cfg.LLMs)),
+		Prices: make(map[string]ModelPrice, len(cfg.Prices)),
+	}
+	for _, rule := range cfg.Redaction.Rules {
+		converted.Redaction.Rules = append(converted.Redaction.Rules, RedactionRule(rule))
+	}
+	for model, price := range cfg.Prices {
+		converted.Prices[model] = ModelPrice(price)
+	}
+	for name := range cfg.LLMs {
+		llmCfg, err := fromProviderSettings(cfg.ProviderSettings(name))
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		converted.LLMs[name] = llmCfg
+	}
+	return converted, nil
+}
+
+// toConfig converts the configuration to the command's.
+func (c Config) toConfig() (config.Config, error) {
+	converted := config.Config{
+		DefaultProvider:       c.DefaultProvider,
+		RequestTimeoutSeconds: c.RequestTimeoutSeconds,
+		ContextOverflow:       c.ContextOverflow,
+		RecordUsage:           c.RecordUsage,
+		Progress:              c.Progress,
+		ScriptsDir:            c.ScriptsDir,
+		ScriptPaths:           c.ScriptPaths,
+		Limits:                config.Limits(c.Limits),
+		Redaction: config.RedactionConfig{
+			Enabled:      c.Redaction.Enabled,
+			Restore:      c.Redaction.Restore,
+			DisableRules: c.Redaction.DisableRules,
+		},
+		Prices: make(map[string]config.ModelPrice, len(c.Prices)),
+	}
+	for _, rule := range c.Redaction.Rules {
+		converted.Redaction.Rules = append(converted.Redaction.Rules, config.RedactionRule(rule))
+	}
+	for model, price := range c.Prices {
+		converted.Prices[model] = config.ModelPrice(price)
+	}
+	for name, llmCfg := range c.LLMs {
+		settings, err := llmCfg.settings()
+		if err != nil {
+			return config.Config{}, fmt.Errorf("invalid settings for %s: %w", name, err)
+		}
+		if err := converted.SetProviderSettings(name, settings); err != nil {
+			return config.Config{}, err
+		}
+	}
+	return converted, nil
+}
+
+// fromProviderSettings returns the entry with the keys given, putting those
+// LLMConfig has no field for into Settings.
+func fromProviderSettings(settings map[string]interface{}) (LLMConfig, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(settings); err != nil {
+		return LLMConfig{}, err
+	}
+	var llmCfg LLMConfig
+	meta, err := toml.Decode(buf.String(), &llmCfg)
+	if err != nil {
+		return LLMConfig{}, err
+	}
+	for _, key := range meta.Undecoded() {
+		if llmCfg.Settings == nil {
+			llmCfg.Settings = map[string]interface{}{}
+		}
+		llmCfg.Settings[key[0]] = settings[key[0]]
+	}
+	return llmCfg, nil
+}
+
+// settings returns all keys of the entry, the fields' over Settings.
+func (l LLMConfig) settings() (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(l); err != nil {
+		return nil, err
+	}
+	settings := map[string]interface{}{}
+	if _, err := toml.Decode(buf.String(), &settings); err != nil {
+		return nil, err
+	}
+	for key, value := range l.Settings {
+		if _, isField := settings[key]; !isField {
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
+
+// MapReduce configures map-reduce processing of large inputs: Reduce is the
+// instruction combining partial results, Parallel the number of chunks sent
+// at once and ChunkTokens the size of the chunks.
+type MapReduce struct {
+	Reduce      string
+	Parallel    int
+	ChunkTokens int
+}
+
+func (m MapReduce) toMapReduce() script.MapReduce {
+	return script.MapReduce(m)
+}
+
+// --- Mock provider ---
+
+// MockOptions configure the answers of a mock client; the zero value echoes
+// the input.
+type MockOptions struct {
+	Mode         string   // One of the Mock* modes; empty means MockEcho
+	ResponseFile string   // Read once, for MockFile
+	Responses    []string // Returned in turn, for MockSequence
+	Rules        []MockRule
+	// Latency is a delay before each answer, e.g. "500ms", cut short when
+	// the request is canceled.
+	Latency string
+	// Error fails requests with this message: every request, or every
+	// FailEvery-th one when FailEvery is set.
+	Error     string
+	FailEvery int
+}
+
+// MockRule answers prompts matching Pattern, a Go regular expression, with
+// Response, in which $1 or ${name} expand to the groups of the match, or
+// fails them with Error.
+type MockRule struct {
+	Pattern  string
+	Response string
+	Error    string
+}
+
+func (o MockOptions) toMockOptions() mock.Options {
+	converted := mock.Options{
+		Mode:         o.Mode,
+		ResponseFile: o.ResponseFile,
+		Responses:    o.Responses,
+		Latency:      o.Latency,
+		Error:        o.Error,
+		FailEvery:    o.FailEvery,
+	}
+	for _, rule := range o.Rules {
+		converted.Rules = append(converted.Rules, mock.Rule(rule))
+	}
+	return converted
+}
+
+// --- Provider registration ---
+
+// ProviderConfig is what a ProviderConstructor gets: the name and settings of
+// an [llms] entry plus the options that apply to every provider.
+type ProviderConfig struct {
+	// Name is the entry's name in [llms], which may differ from the
+	// registered provider when the entry sets type.
+	Name string
+	// Settings holds every key of the entry, e.g. "model" or "base_url".
+	Settings map[string]interface{}
+	// RequestTimeoutSeconds limits each HTTP request; it is always positive.
+	RequestTimeoutSeconds int
+	// Transport, when not nil, carries the provider's HTTP requests, e.g. to
+	// record or replay them.
+	Transport http.RoundTripper
+	Debug     bool
+
+	// llm is the configuration converted, for what it keeps beyond the
+	// fields above, e.g. whether requests are replayed.
+	llm llm.ProviderConfig
+}
+
+func fromProviderConfig(cfg llm.ProviderConfig) ProviderConfig {
+	return ProviderConfig{
+		Name:                  cfg.Name,
+		Settings:              cfg.Settings,
+		RequestTimeoutSeconds: cfg.RequestTimeoutSeconds,
+		Transport:             cfg.Transport,
+		Debug:                 cfg.Debug,
+		llm:                   cfg,
+	}
+}
+
+// toProviderConfig returns the configuration with the fields as they are now.
+func (p ProviderConfig) toProviderConfig() llm.ProviderConfig {
+	cfg := p.llm
+	cfg.Name = p.Name
+	cfg.Settings = p.Settings
+	cfg.RequestTimeoutSeconds = p.RequestTimeoutSeconds
+	cfg.Transport = p.Transport
+	cfg.Debug = p.Debug
+	return cfg
+}
+
+// String returns the string setting key, or "" when it is missing.
+func (p ProviderConfig) String(key string) string {
+	return p.toProviderConfig().String(key)
+}
+
+// Bool returns the boolean setting key, or false when it is missing.
+func (p ProviderConfig) Bool(key string) bool {
+	return p.toProviderConfig().Bool(key)
+}
+
+// Int returns the integer setting key, or 0 when it is missing.
+func (p ProviderConfig) Int(key string) int {
+	return p.toProviderConfig().Int(key)
+}
+
+// Strings returns the string array setting key, skipping other values.
+func (p ProviderConfig) Strings(key string) []string {
+	return p.toProviderConfig().Strings(key)
+}
+
+// Decode decodes the settings into v, a pointer to a struct with toml tags.
+func (p ProviderConfig) Decode(v interface{}) error {
+	return p.toProviderConfig().Decode(v)
+}
+
+// APIKey resolves the entry's API key from api_key, api_key_cmd, api_key_env
+// or api_key_file.
+func (p ProviderConfig) APIKey() (string, error) {
+	return p.toProviderConfig().APIKey()
+}
+
+// ProviderConstructor creates a client for an [llms] entry.
+type ProviderConstructor func(cfg ProviderConfig) (Client, error)
+
+// toConstructor returns c as the command's registry takes it.
+func (c ProviderConstructor) toConstructor() llm.Constructor {
+	return func(cfg llm.ProviderConfig) (llm.Client, error) {
+		client, err := c(fromProviderConfig(cfg))
+		if err != nil {
+			return nil, err
+		}
+		return toLLMClient(client), nil
+	}
+}
+
+// --- Filters ---
+
+// Filter cleans up LLM output, e.g. by removing Markdown code fences.
+type Filter interface {
+	Apply(output string) string
+}